@@ -32,6 +32,15 @@ func (b *Briefcase) AWSCredentialShouldRefreshBefore(awsConfig config.AWSType, r
 	return entry.RefreshExpiry != nil && !entry.RefreshExpiry.IsZero() && refreshBefore.After(*entry.RefreshExpiry)
 }
 
+// AWSCredentialOutputsDrifted returns true if the files of a set of AWS credentials were removed or changed since
+// they were written. The credentials themselves aren't kept, so new ones are fetched to replace them.
+func (b *Briefcase) AWSCredentialOutputsDrifted(awsConfig config.AWSType) bool {
+	if _, ok := b.AWSCredentialLeases[awsConfig.OutputPath]; !ok {
+		return false
+	}
+	return b.outputsDrifted(awsOutputs(awsConfig)...)
+}
+
 // EnrollAWSCredenntial adds or replaces a managed AWS credential to briefcase. If forceRefreshTTL is not zero then it will associate
 // refresh expirty time with the certificate.
 func (b *Briefcase) EnrollAWSCredential(ctx context.Context, awsCreds *api.Secret, awsConfig config.AWSType, forceRefreshTTL time.Duration) {
@@ -59,5 +68,7 @@ func (b *Briefcase) EnrollAWSCredential(ctx context.Context, awsCreds *api.Secre
 		AWSCredential: awsConfig,
 		Expiry:        expiry,
 		RefreshExpiry: refreshExpiry,
+		LeaseID:       awsCreds.LeaseID,
 	}
+	b.enrollOutputs(awsOutputs(awsConfig)...)
 }
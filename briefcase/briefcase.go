@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"time"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/config"
@@ -20,20 +21,31 @@ import (
 // to keep all the associated leases, secrets, etc refreshed. It also keeps a non-serialized copy of secrets that
 // are used to populate templates.
 type Briefcase struct {
-	AuthTokenLease         LeasedAuthToken                `json:"auth"`
-	SSHCertificates        map[string]sshCert             `json:"ssh,omitempty"`
-	AWSCredentialLeases    map[string]leasedAWSCredential `json:"aws,omitempty"`
-	TokenScopedTemplates   map[string]bool                `json:"tokenscoped_templates,omitempty"`
-	StaticTemplates        map[string]bool                `json:"static_templates,omitempty"`
-	TokenScopedSecrets     map[string]bool                `json:"tokenscoped_secrets,omitempty"`
-	StaticScopedSecrets    map[string]bool                `json:"static_secrets,omitempty"`
-	VersionScopedSecrets   map[string]int64               `json:"versioned_secrets,omitempty"`
-	TokenScopedComposites  map[string]bool                `json:"tokenscoped_composites,omitempty"`
-	StaticScopedComposites map[string]bool                `json:"static_composites,omitempty"`
+	SchemaVersion           int                                 `json:"schema_version"`
+	AuthTokenLease          LeasedAuthToken                     `json:"auth"`
+	SSHCertificates         map[string]sshCert                  `json:"ssh,omitempty"`
+	PKICertificates         map[string]pkiCert                  `json:"pki,omitempty"`
+	AWSCredentialLeases     map[string]leasedAWSCredential      `json:"aws,omitempty"`
+	TokenScopedTemplates    map[string]bool                     `json:"tokenscoped_templates,omitempty"`
+	StaticTemplates         map[string]bool                     `json:"static_templates,omitempty"`
+	VersionScopedTemplates  map[string]map[string]int64         `json:"versioned_templates,omitempty"`
+	TokenScopedSecrets      map[string]bool                     `json:"tokenscoped_secrets,omitempty"`
+	StaticScopedSecrets     map[string]bool                     `json:"static_secrets,omitempty"`
+	VersionScopedSecrets    map[string]int64                    `json:"versioned_secrets,omitempty"`
+	TokenScopedComposites   map[string]bool                     `json:"tokenscoped_composites,omitempty"`
+	StaticScopedComposites  map[string]bool                     `json:"static_composites,omitempty"`
+	VersionScopedComposites map[string]map[string]int64         `json:"versioned_composites,omitempty"`
+	ConnectionTokenLeases   map[string]LeasedAuthToken          `json:"connections,omitempty"`
+	DatabaseCredentials     map[string]leasedDatabaseCredential `json:"databases,omitempty"`
+	DynamicSecrets          map[string]leasedDynamicSecret      `json:"dynamic,omitempty"`
+	OutputHashes            map[string]string                   `json:"output_hashes,omitempty"`
 
 	// cache of secrets, not persisted
 	secretCache map[util.SecretLifetime][]SimpleSecret
 
+	// how the briefcase is encrypted when saved, nil if it isn't
+	encryption *encryption
+
 	log     zerolog.Logger
 	metrics *metrics.Metrics
 }
@@ -54,34 +66,45 @@ type sshCert struct {
 }
 
 type LeasedAuthToken struct {
-	Accessor    string    `json:"accessor"`
-	Renewable   bool      `json:"renewable"`
-	Token       string    `json:"token"`
-	ExpiresAt   time.Time `json:"expiry"`
-	NextRefresh time.Time `json:"next_refresh"`
+	Accessor      string    `json:"accessor"`
+	Renewable     bool      `json:"renewable"`
+	Token         string    `json:"token"`
+	ExpiresAt     time.Time `json:"expiry"`
+	NextRefresh   time.Time `json:"next_refresh"`
+	AuthMechanism string    `json:"auth_mechanism,omitempty"`
+	Namespace     string    `json:"namespace,omitempty"`
 }
 
 type leasedAWSCredential struct {
 	AWSCredential config.AWSType `json:"role"`
 	Expiry        time.Time      `json:"expiry"`
 	RefreshExpiry *time.Time     `json:"refresh_expiry,omitempty"`
+	LeaseID       string         `json:"lease_id,omitempty"`
 }
 
 // NewBriefcase creates an empty briefcase.
 func NewBriefcase(mtrics *metrics.Metrics) *Briefcase {
 	return &Briefcase{
-		AWSCredentialLeases:    make(map[string]leasedAWSCredential),
-		SSHCertificates:        make(map[string]sshCert),
-		TokenScopedTemplates:   make(map[string]bool),
-		StaticTemplates:        make(map[string]bool),
-		TokenScopedSecrets:     make(map[string]bool),
-		StaticScopedSecrets:    make(map[string]bool),
-		VersionScopedSecrets:   make(map[string]int64),
-		TokenScopedComposites:  make(map[string]bool),
-		StaticScopedComposites: make(map[string]bool),
-		log:                    zlog.Logger,
-		metrics:                mtrics,
-		secretCache:            make(map[util.SecretLifetime][]SimpleSecret),
+		SchemaVersion:           SchemaVersion,
+		AWSCredentialLeases:     make(map[string]leasedAWSCredential),
+		SSHCertificates:         make(map[string]sshCert),
+		PKICertificates:         make(map[string]pkiCert),
+		TokenScopedTemplates:    make(map[string]bool),
+		StaticTemplates:         make(map[string]bool),
+		VersionScopedTemplates:  make(map[string]map[string]int64),
+		TokenScopedSecrets:      make(map[string]bool),
+		StaticScopedSecrets:     make(map[string]bool),
+		VersionScopedSecrets:    make(map[string]int64),
+		TokenScopedComposites:   make(map[string]bool),
+		StaticScopedComposites:  make(map[string]bool),
+		VersionScopedComposites: make(map[string]map[string]int64),
+		ConnectionTokenLeases:   make(map[string]LeasedAuthToken),
+		DatabaseCredentials:     make(map[string]leasedDatabaseCredential),
+		DynamicSecrets:          make(map[string]leasedDynamicSecret),
+		OutputHashes:            make(map[string]string),
+		log:                     zlog.Logger,
+		metrics:                 mtrics,
+		secretCache:             make(map[util.SecretLifetime][]SimpleSecret),
 	}
 }
 
@@ -93,6 +116,8 @@ func (b *Briefcase) ResetBriefcase() *Briefcase {
 	b.metrics.Increment(metrics.BriefcaseReset)
 
 	newBriefcase := NewBriefcase(b.metrics)
+	newBriefcase.encryption = b.encryption
+
 	// AWS Credentials is done through sts:AssumeRole which currently has no reasonable
 	// revocation mechanism, so credentials remain valid across tokens.
 	newBriefcase.AWSCredentialLeases = b.AWSCredentialLeases
@@ -101,14 +126,124 @@ func (b *Briefcase) ResetBriefcase() *Briefcase {
 	// remain valid across tokens.
 	newBriefcase.SSHCertificates = b.SSHCertificates
 
+	// PKI certificates are likewise valid until they expire.
+	newBriefcase.PKICertificates = b.PKICertificates
+
 	newBriefcase.StaticScopedSecrets = b.StaticScopedSecrets
 	newBriefcase.VersionScopedSecrets = b.VersionScopedSecrets
 	newBriefcase.StaticScopedComposites = b.StaticScopedComposites
 	newBriefcase.StaticTemplates = b.StaticTemplates
+	newBriefcase.VersionScopedTemplates = b.VersionScopedTemplates
+	newBriefcase.VersionScopedComposites = b.VersionScopedComposites
+
+	// What was written to each output is kept. Outputs that need rewriting with the new token are no longer
+	// enrolled, so they're rewritten (and recorded again) regardless.
+	newBriefcase.OutputHashes = b.OutputHashes
+
+	// Tokens for other Vault connections are unaffected by the default token changing.
+	newBriefcase.ConnectionTokenLeases = b.ConnectionTokenLeases
+
+	// Leases are revoked along with the token that created them, so only the ones created through other Vault
+	// connections remain valid.
+	for key, entry := range b.DatabaseCredentials {
+		if entry.Cfg.Vault != "" {
+			newBriefcase.DatabaseCredentials[key] = entry
+		}
+	}
+	for key, entry := range b.DynamicSecrets {
+		if entry.Cfg.Vault != "" {
+			newBriefcase.DynamicSecrets[key] = entry
+		}
+	}
 	return newBriefcase
 }
 
-func LoadBriefcase(filename string, mtrics *metrics.Metrics) (*Briefcase, error) {
+// ResetConnection is used when the vault token of the named Vault connection changes. Token-scoped secrets and
+// composites that read from that connection are forgotten so they are recreated with the new token. Templates can
+// use secrets from any connection, so every token-scoped template is forgotten. Database credentials and dynamic
+// secrets from the connection are issued again with the new token, so their leases are returned to be revoked once
+// they have been replaced.
+func (b *Briefcase) ResetConnection(connection string, cfg *config.ControlToolConfig) []TrackedLease {
+
+	b.metrics.Increment(metrics.BriefcaseReset)
+
+	for _, secret := range cfg.VaultConfig.Secrets {
+		if secret.Vault == connection {
+			delete(b.TokenScopedSecrets, secret.VaultLocation())
+		}
+	}
+
+	b.TokenScopedTemplates = make(map[string]bool)
+
+	for _, composite := range cfg.Composites {
+		for _, secret := range composite.Secrets {
+			if secret.Vault == connection {
+				delete(b.TokenScopedComposites, composite.Filename)
+			}
+		}
+	}
+
+	var replaced []TrackedLease
+
+	for key, entry := range b.DatabaseCredentials {
+		if entry.Cfg.Vault == connection {
+			lease, _ := b.DatabaseCredentialLease(entry.Cfg)
+			replaced = append(replaced, lease)
+			delete(b.DatabaseCredentials, key)
+		}
+	}
+
+	for key, entry := range b.DynamicSecrets {
+		if entry.Cfg.Vault == connection {
+			lease, _ := b.DynamicSecretLease(entry.Cfg)
+			replaced = append(replaced, lease)
+			delete(b.DynamicSecrets, key)
+		}
+	}
+
+	return replaced
+}
+
+// EncryptWith has the briefcase encrypted with keys from the KeySource whenever it is saved. A nil KeySource saves
+// the briefcase unencrypted.
+func (b *Briefcase) EncryptWith(keys KeySource) {
+	if keys == nil {
+		b.encryption = nil
+	} else {
+		b.encryption = &encryption{keys: keys}
+	}
+}
+
+// LoadBriefcase reads a briefcase, decrypting it with keys from the KeySource if it is encrypted. An unencrypted
+// briefcase is still read when there is a KeySource, and is encrypted the next time it is saved. If the briefcase
+// exists but can't be read, the backup made when it was last saved is used instead.
+func LoadBriefcase(filename string, mtrics *metrics.Metrics, keys KeySource) (*Briefcase, error) {
+	bc, err := readBriefcase(filename, mtrics, keys)
+	if err == nil || errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrUnsupportedSchema) || errors.Is(err, ErrBriefcaseEncrypted) {
+		return bc, err
+	}
+
+	// The briefcase is there but can't be read, so it was likely only partly written. Rather than starting over
+	// (and re-issuing every credential), use the previous one.
+	backup := BackupFilename(filename)
+	bc, backupErr := readBriefcase(backup, mtrics, keys)
+	if backupErr != nil {
+		zlog.Debug().Err(backupErr).Str("filename", backup).Msg("could not read briefcase backup")
+		return nil, err
+	}
+
+	zlog.Warn().Err(err).Str("filename", filename).Str("backup", backup).Msg("could not read briefcase, using its backup instead")
+	mtrics.BriefcaseBackupLoaded()
+
+	return bc, nil
+}
+
+// BackupFilename is where the previous briefcase is kept when filename is saved.
+func BackupFilename(filename string) string {
+	return filename + ".bak"
+}
+
+func readBriefcase(filename string, mtrics *metrics.Metrics, keys KeySource) (*Briefcase, error) {
 	zlog.Info().Str("filename", filename).Msg("reading briefcase")
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -116,6 +251,22 @@ func LoadBriefcase(filename string, mtrics *metrics.Metrics) (*Briefcase, error)
 	}
 
 	bc := NewBriefcase(mtrics)
+	bc.EncryptWith(keys)
+
+	bytes, encrypted, err := bc.encryption.open(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt briefcase data: %w", err)
+	}
+
+	if keys != nil && !encrypted {
+		zlog.Info().Str("filename", filename).Msg("briefcase is not encrypted, it will be encrypted when it is next saved")
+	}
+
+	bytes, err = migrate(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not read briefcase %q: %w", filename, err)
+	}
+
 	err = json.Unmarshal(bytes, bc)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse briefcase data: %w", err)
@@ -124,9 +275,22 @@ func LoadBriefcase(filename string, mtrics *metrics.Metrics) (*Briefcase, error)
 	return bc, nil
 }
 
+// AuthToken returns the leased auth token for the named Vault connection. The default Vault server is "".
+func (b *Briefcase) AuthToken(connection string) LeasedAuthToken {
+	if connection == "" {
+		return b.AuthTokenLease
+	}
+	return b.ConnectionTokenLeases[connection]
+}
+
 // EnrollVaultToken adds the specified vault token (from Vault) to the briefcase. It captures some expiry information
 // so it knows when it needs to be refreshed.
 func (b *Briefcase) EnrollVaultToken(ctx context.Context, token *util.WrappedToken) error {
+	return b.EnrollConnectionVaultToken(ctx, "", token)
+}
+
+// EnrollConnectionVaultToken is EnrollVaultToken for the token of the named Vault connection.
+func (b *Briefcase) EnrollConnectionVaultToken(ctx context.Context, connection string, token *util.WrappedToken) error {
 
 	if token == nil {
 		return errors.New("can only enroll non-nil tokens")
@@ -150,39 +314,93 @@ func (b *Briefcase) EnrollVaultToken(ctx context.Context, token *util.WrappedTok
 	now := clock.Now(ctx)
 
 	authToken := LeasedAuthToken{
-		Token:       tokenID,
-		Accessor:    accessor,
-		Renewable:   token.Renewable,
-		ExpiresAt:   now.Add(ttl),
-		NextRefresh: now.Add(ttl / 3),
+		Token:         tokenID,
+		Accessor:      accessor,
+		Renewable:     token.Renewable,
+		ExpiresAt:     now.Add(ttl),
+		NextRefresh:   now.Add(ttl / 3),
+		AuthMechanism: token.AuthMechanism,
+		Namespace:     token.Namespace,
 	}
 
-	if b.AuthTokenLease.Token != tokenID {
-		b.log = zlog.With().Str("accessor", accessor).Bool("renewable", authToken.Renewable).Logger()
-		b.log.Info().Str("ttl", ttl.String()).Str("nextRefresh", authToken.NextRefresh.String()).Msg("enrolling vault token with specified ttl into briefcase")
+	// Tokens with a TTL of zero, such as root tokens, never expire, which is recorded as no expiry at all.
+	if ttl == 0 {
+		authToken.ExpiresAt = time.Time{}
+	}
+
+	current := b.AuthToken(connection)
+
+	// Refreshing a token doesn't change how it was obtained, or where it lives.
+	if current.Token == tokenID {
+		if authToken.AuthMechanism == "" {
+			authToken.AuthMechanism = current.AuthMechanism
+		}
+		if authToken.Namespace == "" {
+			authToken.Namespace = current.Namespace
+		}
+	}
+
+	log := b.log
+	if connection != "" {
+		log = zlog.With().Str("connection", connection).Str("accessor", accessor).Logger()
+	}
+
+	if current.Token != tokenID {
+		log = zlog.With().Str("accessor", accessor).Bool("renewable", authToken.Renewable).Logger()
+		if connection != "" {
+			log = log.With().Str("connection", connection).Logger()
+		}
+		if authToken.AuthMechanism != "" {
+			log = log.With().Str("authMechanism", authToken.AuthMechanism).Logger()
+		}
+		log.Info().Str("ttl", ttl.String()).Str("nextRefresh", authToken.NextRefresh.String()).Msg("enrolling vault token with specified ttl into briefcase")
 	} else {
-		b.log.Info().Time("expiresAt", authToken.ExpiresAt).Time("nextRefresh", authToken.NextRefresh).Msg("vault token refreshed")
+		log.Info().Time("expiresAt", authToken.ExpiresAt).Time("nextRefresh", authToken.NextRefresh).Msg("vault token refreshed")
 	}
 
-	if authToken.ExpiresAt.Before(now.Add(5 * time.Minute)) {
-		b.log.Warn().Time("expiresAt", authToken.ExpiresAt).Msg("token expires in less than five minutes, setting next refresh to now")
+	if !authToken.ExpiresAt.IsZero() && authToken.ExpiresAt.Before(now.Add(5*time.Minute)) {
+		log.Warn().Time("expiresAt", authToken.ExpiresAt).Msg("token expires in less than five minutes, setting next refresh to now")
 		authToken.NextRefresh = now
 	}
 
-	b.AuthTokenLease = authToken
+	if connection == "" {
+		b.log = log
+		b.AuthTokenLease = authToken
+	} else {
+		b.ConnectionTokenLeases[connection] = authToken
+	}
 
 	return nil
 }
 
 func (b *Briefcase) SaveAs(filename string) error {
-	bytes, err := json.Marshal(b)
+	b.SchemaVersion = SchemaVersion
+
+	saved := b
+	if b.encryption == nil {
+		saved = b.withoutLeaseData()
+	}
+
+	bytes, err := json.Marshal(saved)
 	if err != nil {
 		return err
 	}
 
+	if b.encryption != nil {
+		if bytes, err = b.encryption.seal(bytes); err != nil {
+			b.log.Error().Err(err).Str("filename", filename).Msg("failed to encrypt briefcase")
+			return err
+		}
+	}
+
 	b.log.Info().Str("filename", filename).Msg("storing briefcase")
 	util.MustMkdirAllForFile(filename)
-	if err := ioutil.WriteFile(filename, bytes, 0600); err != nil {
+
+	if err := backupBriefcase(filename, b.encryption != nil); err != nil {
+		b.log.Warn().Err(err).Str("filename", filename).Msg("failed to back up briefcase file")
+	}
+
+	if err := util.WriteFileAtomic(filename, bytes, 0600, util.NoFileOwner); err != nil {
 		b.log.Error().Err(err).Str("filename", filename).Msg("failed to write briefcase file")
 		return err
 	}
@@ -190,23 +408,52 @@ func (b *Briefcase) SaveAs(filename string) error {
 	return nil
 }
 
+// VaultTokenOutputDrifted returns true if the file the Vault token is written to was removed or changed since it was
+// written.
+func (b *Briefcase) VaultTokenOutputDrifted(tokenCfg config.VaultTokenType) bool {
+	return tokenCfg.Output != "" && b.outputsDrifted(tokenCfg.Output)
+}
+
+// EnrollVaultTokenOutput records what was written to the file the Vault token is written to.
+func (b *Briefcase) EnrollVaultTokenOutput(tokenCfg config.VaultTokenType) {
+	if tokenCfg.Output != "" {
+		b.enrollOutputs(tokenCfg.Output)
+	}
+}
+
 // ShouldRefreshVaultToken will return true if it's time to do periodic refresh of the Vault token being
 // used by the tool. This time is established when the token is enrolled into the briefcase. It will return
 // false if the token is not renewable. If the token is needs a refresh but is non-renewable, then it will
 // log (but not throw) an error.
 func (b *Briefcase) ShouldRefreshVaultToken(ctx context.Context) bool {
+	return b.ShouldRefreshConnectionVaultToken(ctx, "")
+}
 
-	expiring := clock.Now(ctx).After(b.AuthTokenLease.NextRefresh)
+// ShouldRefreshConnectionVaultToken is ShouldRefreshVaultToken for the token of the named Vault connection.
+func (b *Briefcase) ShouldRefreshConnectionVaultToken(ctx context.Context, connection string) bool {
 
-	if expiring && !b.AuthTokenLease.Renewable {
+	lease := b.AuthToken(connection)
+	log := b.log
+	if connection != "" {
+		log = log.With().Str("connection", connection).Logger()
+	}
+
+	// A token that never expires never needs refreshing.
+	if lease.ExpiresAt.IsZero() {
+		return false
+	}
+
+	expiring := clock.Now(ctx).After(lease.NextRefresh)
+
+	if expiring && !lease.Renewable {
 		// now >= expiredAt
-		if !clock.Now(ctx).Before(b.AuthTokenLease.ExpiresAt) {
-			b.log.Error().Time("expiresAt", b.AuthTokenLease.ExpiresAt).
-				Time("nextRefresh", b.AuthTokenLease.NextRefresh).
+		if !clock.Now(ctx).Before(lease.ExpiresAt) {
+			log.Error().Time("expiresAt", lease.ExpiresAt).
+				Time("nextRefresh", lease.NextRefresh).
 				Msg("token has expired and is not renewable - results are unpredictable")
 		} else {
-			b.log.Error().Time("expiresAt", b.AuthTokenLease.ExpiresAt).
-				Time("nextRefresh", b.AuthTokenLease.NextRefresh).
+			log.Error().Time("expiresAt", lease.ExpiresAt).
+				Time("nextRefresh", lease.NextRefresh).
 				Msg("token is expiring, but is set to be non-renewable - unpredictable results will occur once it expires.")
 		}
 		return false
@@ -214,3 +461,26 @@ func (b *Briefcase) ShouldRefreshVaultToken(ctx context.Context) bool {
 
 	return expiring
 }
+
+// backupBriefcase copies the briefcase about to be replaced to its backup, so there is something to fall back to if
+// the new one is lost. A briefcase that isn't even JSON is never good, so it doesn't replace the backup. When the
+// briefcase is now encrypted, a plaintext briefcase is not kept around as the backup.
+func backupBriefcase(filename string, encrypted bool) error {
+	current, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(current) {
+		return fmt.Errorf("briefcase %q is corrupt, keeping the previous backup", filename)
+	}
+	if encrypted && !sealed(current) {
+		if err := os.Remove(BackupFilename(filename)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return util.WriteFileAtomic(BackupFilename(filename), current, 0600, util.NoFileOwner)
+}
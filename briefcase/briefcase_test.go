@@ -3,12 +3,15 @@ package briefcase
 import (
 	"context"
 	"encoding/json"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
 	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"io/ioutil"
 	testing2 "k8s.io/utils/clock/testing"
 	"os"
 	"path"
+	"syscall"
 	"testing"
 	"time"
 
@@ -73,6 +76,33 @@ func TestSavePermissions(t *testing.T) {
 	assert.Zero(t, stat.Mode()&0077, "briefcase must only be accessible to owner")
 }
 
+// The briefcase is saved by whoever runs the tool, which usually isn't root, and is never given to another user.
+func TestSaveWithoutRoot(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	bc := NewBriefcase(nil)
+	assert.NoError(t, bc.SaveAs(filename), "must be able to save briefcase")
+
+	uid, gid := os.Geteuid(), os.Getegid()
+	if uid == 0 {
+		// As root, give the briefcase to someone else first, which saving it must not undo.
+		uid, gid = 65534, 65534
+		assert.NoError(t, os.Chown(filename, uid, gid))
+	}
+
+	assert.NoError(t, bc.SaveAs(filename), "must be able to replace briefcase")
+
+	info, err := os.Stat(filename)
+	if assert.NoError(t, err) {
+		stat := info.Sys().(*syscall.Stat_t)
+		assert.Equal(t, uid, int(stat.Uid), "owner of briefcase must not change")
+		assert.Equal(t, gid, int(stat.Gid), "group of briefcase must not change")
+	}
+
+	_, err = os.Stat(BackupFilename(filename))
+	assert.NoError(t, err, "must be able to back up briefcase")
+}
+
 func TestSaveAndLoadEmpty(t *testing.T) {
 	tempDir := t.TempDir()
 	defer os.RemoveAll(tempDir)
@@ -82,7 +112,7 @@ func TestSaveAndLoadEmpty(t *testing.T) {
 	err := emptyBriefcase.SaveAs(filename)
 	assert.NoError(t, err, "must be able to save empty briefcase. filename=%q", filename)
 
-	loadedBriefcase, err := LoadBriefcase(filename, nil)
+	loadedBriefcase, err := LoadBriefcase(filename, nil, nil)
 	assert.NoError(t, err, "must be able to load empty briefcase. filename=%q", filename)
 
 	assert.EqualValues(t, emptyBriefcase, loadedBriefcase, "empty briefcase and loaded empty briefcase must be the same")
@@ -100,7 +130,7 @@ func TestSaveAndLoadEnrolledToken(t *testing.T) {
 	assert.NoError(t, bc.EnrollVaultToken(context.Background(), util.NewWrappedToken(&token, true)), "must be able to enroll example token in briefcase")
 	assert.NoError(t, bc.SaveAs(filename), "must be able to save briefcase")
 
-	loadedBriefcase, err := LoadBriefcase(filename, nil)
+	loadedBriefcase, err := LoadBriefcase(filename, nil, nil)
 	assert.NoError(t, err, "must be able to reload briefcase")
 
 	assert.False(t, loadedBriefcase.ShouldRefreshVaultToken(context.TODO()), "must not need to refresh a token with a TTL")
@@ -193,3 +223,120 @@ func TestResetBriefcase(t *testing.T) {
 	assert.EqualValues(t, small, resetBig, "resetting a briefcase should leave non-token scoped data")
 	assert.Equal(t, 1, mtrcs.Counter(metrics.BriefcaseReset))
 }
+
+func TestResetConnection(t *testing.T) {
+	ctx := context.TODO()
+
+	cfg := &config.ControlToolConfig{VaultConfig: config.VaultConfig{
+		Secrets: []config.SecretType{
+			{Key: "global", Path: "shared/keys", Vault: "global"},
+			{Key: "local", Path: "local/keys"},
+		},
+	}}
+
+	bc := NewBriefcase(nil)
+	bc.TokenScopedSecrets = map[string]bool{"global@shared/keys": true, "local/keys": true}
+	bc.TokenScopedTemplates = map[string]bool{"uses-global.txt": true}
+
+	globalDB := config.DatabaseType{Key: "global-db", Vault: "global"}
+	localDB := config.DatabaseType{Key: "local-db"}
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{LeaseID: "database/creds/global/1", LeaseDuration: 60}, globalDB)
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{LeaseID: "database/creds/local/1", LeaseDuration: 60}, localDB)
+	bc.EnrollDynamicSecret(ctx, &api.Secret{LeaseID: "rabbitmq/creds/global/1", LeaseDuration: 60},
+		config.DynamicType{Key: "rabbit", Vault: "global"})
+	bc.StoreSecrets(util.LifetimeToken, []SimpleSecret{{Key: "local", Field: "api_key", Value: "abc"}})
+
+	replaced := bc.ResetConnection("global", cfg)
+
+	assert.Equal(t, map[string]bool{"local/keys": true}, bc.TokenScopedSecrets)
+	assert.Empty(t, bc.TokenScopedTemplates, "templates can use secrets from any connection")
+	assert.NotEmpty(t, bc.GetSecrets(util.LifetimeToken), "secrets from other connections must stay cached")
+
+	assert.Contains(t, bc.DatabaseCredentials, "local-db")
+	assert.NotContains(t, bc.DatabaseCredentials, "global-db")
+	assert.Empty(t, bc.DynamicSecrets)
+	assert.ElementsMatch(t, []TrackedLease{
+		{Kind: "database", Name: "global-db", LeaseID: "database/creds/global/1", Vault: "global"},
+		{Kind: "dynamic", Name: "rabbit", LeaseID: "rabbitmq/creds/global/1", Vault: "global"},
+	}, replaced, "leases from the connection must be returned so they can be revoked")
+}
+
+func TestRefreshedTokenKeepsAuthMechanism(t *testing.T) {
+	bc := NewBriefcase(nil)
+	token := myToken(t)
+
+	wrapped := util.NewWrappedToken(&token, true)
+	wrapped.AuthMechanism = "approle"
+	assert.NoError(t, bc.EnrollVaultToken(context.TODO(), wrapped))
+	assert.Equal(t, "approle", bc.AuthTokenLease.AuthMechanism)
+
+	// A refresh of the same token does not know how the token was obtained.
+	assert.NoError(t, bc.EnrollVaultToken(context.TODO(), util.NewWrappedToken(&token, true)))
+	assert.Equal(t, "approle", bc.AuthTokenLease.AuthMechanism, "refreshing a token must not forget its auth mechanism")
+}
+
+func TestSaveKeepsBackup(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	bc := NewBriefcase(nil)
+	token := myToken(t)
+	assert.NoError(t, bc.EnrollVaultToken(context.Background(), util.NewWrappedToken(&token, true)))
+	assert.NoError(t, bc.SaveAs(filename))
+
+	_, err := os.Stat(BackupFilename(filename))
+	assert.True(t, os.IsNotExist(err), "there is no backup until a briefcase is replaced")
+
+	first, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+
+	bc.AuthTokenLease.Accessor = "replaced"
+	assert.NoError(t, bc.SaveAs(filename))
+
+	backup, err := ioutil.ReadFile(BackupFilename(filename))
+	assert.NoError(t, err)
+	assert.Equal(t, first, backup, "backup must be the briefcase that was replaced")
+
+	stat, err := os.Stat(BackupFilename(filename))
+	assert.NoError(t, err)
+	assert.Zero(t, stat.Mode()&0077, "briefcase backup must only be accessible to owner")
+
+	// A corrupt briefcase never replaces a good backup.
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(`{"auth": {"acc`), 0600))
+	assert.NoError(t, bc.SaveAs(filename))
+
+	backup, err = ioutil.ReadFile(BackupFilename(filename))
+	assert.NoError(t, err)
+	assert.Equal(t, first, backup, "corrupt briefcase must not replace the backup")
+}
+
+func TestLoadFallsBackToBackup(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	bc := NewBriefcase(nil)
+	token := myToken(t)
+	assert.NoError(t, bc.EnrollVaultToken(context.Background(), util.NewWrappedToken(&token, true)))
+	assert.NoError(t, bc.SaveAs(filename))
+	assert.NoError(t, bc.SaveAs(filename))
+
+	// A briefcase cut short by a crash or a full disk.
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(`{"auth": {"acc`), 0600))
+
+	mtrics := metrics.NewMetrics()
+	before := mtrics.Counter(metrics.BriefcaseBackupUsed)
+
+	loaded, err := LoadBriefcase(filename, mtrics, nil)
+	assert.NoError(t, err, "must load the backup when the briefcase is corrupt")
+	assert.Equal(t, "8FvDM61Vc23jht83if5bFWlC", loaded.AuthTokenLease.Accessor)
+	assert.Equal(t, before+1, mtrics.Counter(metrics.BriefcaseBackupUsed))
+
+	// Without a good backup, the briefcase's own error is returned.
+	assert.NoError(t, ioutil.WriteFile(BackupFilename(filename), []byte("not json"), 0600))
+	_, err = LoadBriefcase(filename, mtrics, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected end of JSON input")
+
+	// A missing briefcase is a fresh start, not a reason to use the backup.
+	assert.NoError(t, os.Remove(filename))
+	_, err = LoadBriefcase(filename, mtrics, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,118 @@
+package briefcase
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+// Database credentials are leased. The lease is kept in the briefcase along with the credential itself, so
+// templates can be rendered without issuing a new credential.
+type leasedDatabaseCredential struct {
+	Cfg config.DatabaseType `json:"cfg"`
+	lease
+}
+
+// ShouldIssueDatabaseCredential returns true if there is no database credential for the stanza, or if the current
+// one expires before the specified time.
+func (b *Briefcase) ShouldIssueDatabaseCredential(db config.DatabaseType, expiresBefore time.Time) bool {
+	entry, ok := b.DatabaseCredentials[db.Key]
+	if !ok {
+		return true
+	}
+
+	// Without its data (as it came from an unencrypted briefcase), nothing can be written from it.
+	return entry.Data == nil || entry.expiresBefore(expiresBefore)
+}
+
+// ShouldRenewDatabaseCredential returns the lease ID of the database credential if it is renewable and due to be
+// renewed, either because it is half way through its lease or because it expires before the specified time.
+func (b *Briefcase) ShouldRenewDatabaseCredential(ctx context.Context, db config.DatabaseType, expiresBefore time.Time) (string, bool) {
+	entry, ok := b.DatabaseCredentials[db.Key]
+	if !ok {
+		return "", false
+	}
+
+	return entry.LeaseID, entry.dueForRenewal(ctx, expiresBefore)
+}
+
+// DatabaseOutputsDrifted returns true if the field outputs of a database credential were removed or changed since
+// they were written. They are rewritten from the credential in the briefcase, rather than issuing a new one.
+func (b *Briefcase) DatabaseOutputsDrifted(db config.DatabaseType) bool {
+	entry, ok := b.DatabaseCredentials[db.Key]
+	if !ok || entry.Data == nil {
+		return false
+	}
+	return b.outputsDrifted(fieldOutputs(db.Fields)...)
+}
+
+// EnrollDatabaseOutputs records what was written to the field outputs of a database credential.
+func (b *Briefcase) EnrollDatabaseOutputs(db config.DatabaseType) {
+	b.enrollOutputs(fieldOutputs(db.Fields)...)
+}
+
+// DatabaseCredentialLease returns the lease of the database credential for the stanza, if there is one, such as to
+// revoke it once it has been replaced.
+func (b *Briefcase) DatabaseCredentialLease(db config.DatabaseType) (TrackedLease, bool) {
+	entry, ok := b.DatabaseCredentials[db.Key]
+	if !ok {
+		return TrackedLease{}, false
+	}
+
+	return TrackedLease{
+		Kind:      "database",
+		Name:      db.Key,
+		LeaseID:   entry.LeaseID,
+		Vault:     entry.Cfg.Vault,
+		Namespace: entry.Cfg.Namespace,
+	}, true
+}
+
+// EnrollDatabaseCredential adds or replaces a database credential in the briefcase.
+func (b *Briefcase) EnrollDatabaseCredential(ctx context.Context, secret *api.Secret, db config.DatabaseType) {
+	entry := leasedDatabaseCredential{
+		Cfg:   db,
+		lease: newLease(ctx, secret),
+	}
+
+	b.log.Info().Str("key", db.Key).Time("expiry", entry.Expiry).Bool("renewable", entry.Renewable).
+		Msg("enrolling database credential")
+
+	b.DatabaseCredentials[db.Key] = entry
+
+	b.forgetTokenScopedOutputs()
+}
+
+// RenewedDatabaseCredential records the new lease duration of a renewed database credential.
+func (b *Briefcase) RenewedDatabaseCredential(ctx context.Context, secret *api.Secret, db config.DatabaseType) {
+	entry, ok := b.DatabaseCredentials[db.Key]
+	if !ok {
+		return
+	}
+
+	entry.extend(ctx, secret)
+
+	b.log.Info().Str("key", db.Key).Time("expiry", entry.Expiry).Msg("database credential renewed")
+
+	b.DatabaseCredentials[db.Key] = entry
+}
+
+// DatabaseCredentialFields returns the fields of every database credential in the briefcase, for use by templates and
+// field outputs.
+func (b *Briefcase) DatabaseCredentialFields() []SimpleSecret {
+	var simpleSecrets []SimpleSecret
+	for key, entry := range b.DatabaseCredentials {
+		simpleSecrets = append(simpleSecrets, entry.simpleSecrets(key)...)
+	}
+	return simpleSecrets
+}
+
+// forgetTokenScopedOutputs causes every token-scoped template to be rewritten, as any of them could use a
+// leased secret that was just issued.
+func (b *Briefcase) forgetTokenScopedOutputs() {
+	b.TokenScopedTemplates = make(map[string]bool)
+	delete(b.secretCache, util.LifetimeToken)
+}
@@ -0,0 +1,109 @@
+package briefcase
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+)
+
+// Dynamic secrets are any leased secret from Vault. Like database credentials, the lease and data are kept in the
+// briefcase so they can be renewed, and outputs written, without fetching a new secret.
+type leasedDynamicSecret struct {
+	Cfg config.DynamicType `json:"cfg"`
+	lease
+}
+
+// ShouldFetchDynamicSecret returns true if there is no secret for the dynamic stanza, or if the current one expires
+// before the specified time.
+func (b *Briefcase) ShouldFetchDynamicSecret(dyn config.DynamicType, expiresBefore time.Time) bool {
+	entry, ok := b.DynamicSecrets[dyn.Key]
+	if !ok {
+		return true
+	}
+
+	// Without its data (as it came from an unencrypted briefcase), nothing can be written from it.
+	return entry.Data == nil || entry.expiresBefore(expiresBefore)
+}
+
+// ShouldRenewDynamicSecret returns the lease ID of the dynamic secret if it is renewable and due to be renewed.
+func (b *Briefcase) ShouldRenewDynamicSecret(ctx context.Context, dyn config.DynamicType, expiresBefore time.Time) (string, bool) {
+	entry, ok := b.DynamicSecrets[dyn.Key]
+	if !ok {
+		return "", false
+	}
+
+	return entry.LeaseID, entry.dueForRenewal(ctx, expiresBefore)
+}
+
+// DynamicOutputsDrifted returns true if the outputs of a dynamic secret were removed or changed since they were
+// written. They are rewritten from the secret in the briefcase, rather than fetching a new one.
+func (b *Briefcase) DynamicOutputsDrifted(dyn config.DynamicType) bool {
+	entry, ok := b.DynamicSecrets[dyn.Key]
+	if !ok || entry.Data == nil {
+		return false
+	}
+	return b.outputsDrifted(dynamicOutputs(dyn)...)
+}
+
+// EnrollDynamicOutputs records what was written to the outputs of a dynamic secret.
+func (b *Briefcase) EnrollDynamicOutputs(dyn config.DynamicType) {
+	b.enrollOutputs(dynamicOutputs(dyn)...)
+}
+
+// DynamicSecretLease returns the lease of the dynamic secret for the stanza, if there is one, such as to revoke it
+// once it has been replaced.
+func (b *Briefcase) DynamicSecretLease(dyn config.DynamicType) (TrackedLease, bool) {
+	entry, ok := b.DynamicSecrets[dyn.Key]
+	if !ok {
+		return TrackedLease{}, false
+	}
+
+	return TrackedLease{
+		Kind:      "dynamic",
+		Name:      dyn.Key,
+		LeaseID:   entry.LeaseID,
+		Vault:     entry.Cfg.Vault,
+		Namespace: entry.Cfg.Namespace,
+	}, true
+}
+
+// EnrollDynamicSecret adds or replaces a dynamic secret in the briefcase.
+func (b *Briefcase) EnrollDynamicSecret(ctx context.Context, secret *api.Secret, dyn config.DynamicType) {
+	entry := leasedDynamicSecret{
+		Cfg:   dyn,
+		lease: newLease(ctx, secret),
+	}
+
+	b.log.Info().Str("key", dyn.Key).Str("path", dyn.Path).Time("expiry", entry.Expiry).Bool("renewable", entry.Renewable).
+		Msg("enrolling dynamic secret")
+
+	b.DynamicSecrets[dyn.Key] = entry
+
+	b.forgetTokenScopedOutputs()
+}
+
+// RenewedDynamicSecret records the new lease duration of a renewed dynamic secret.
+func (b *Briefcase) RenewedDynamicSecret(ctx context.Context, secret *api.Secret, dyn config.DynamicType) {
+	entry, ok := b.DynamicSecrets[dyn.Key]
+	if !ok {
+		return
+	}
+
+	entry.extend(ctx, secret)
+
+	b.log.Info().Str("key", dyn.Key).Time("expiry", entry.Expiry).Msg("dynamic secret renewed")
+
+	b.DynamicSecrets[dyn.Key] = entry
+}
+
+// DynamicSecretFields returns the fields of every dynamic secret in the briefcase, for use by templates and
+// field outputs.
+func (b *Briefcase) DynamicSecretFields() []SimpleSecret {
+	var simpleSecrets []SimpleSecret
+	for key, entry := range b.DynamicSecrets {
+		simpleSecrets = append(simpleSecrets, entry.simpleSecrets(key)...)
+	}
+	return simpleSecrets
+}
@@ -0,0 +1,217 @@
+package briefcase
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The briefcase holds live Vault tokens, so it can be encrypted at rest. Encrypted briefcases are stored as an
+// envelope: the briefcase is encrypted with AES-256-GCM using a data key, and the data key is stored alongside
+// it in whatever form the KeySource needs to get it back (nothing, for keys from a file or the environment, or
+// encrypted by Vault's transit secrets engine).
+
+// ErrBriefcaseEncrypted is returned when reading an encrypted briefcase without a key.
+var ErrBriefcaseEncrypted = errors.New("briefcase is encrypted, but no briefcase key was given")
+
+// envelopeVersion is incremented if the envelope changes in a way older releases can't read.
+const envelopeVersion = 1
+
+type envelope struct {
+	Encrypted  int    `json:"vct_encrypted"`
+	Source     string `json:"source"`
+	DataKey    string `json:"data_key,omitempty"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// A KeySource provides the data keys a briefcase is encrypted with.
+type KeySource interface {
+	// Name describes where keys come from, and is kept in the envelope.
+	Name() string
+	// NewDataKey returns a 256 bit key to encrypt the briefcase with, and the form of it to store in the envelope.
+	NewDataKey() ([]byte, string, error)
+	// DataKey returns the key for the form stored in the envelope by NewDataKey.
+	DataKey(stored string) ([]byte, error)
+}
+
+// staticKey is a key read from a file or the environment, used as the data key.
+type staticKey struct {
+	name string
+	key  []byte
+}
+
+// NewStaticKey is a KeySource using a base64 encoded 256 bit key, such as one made by "openssl rand -base64 32".
+func NewStaticKey(name, encoded string) (KeySource, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("briefcase key from %s is not base64 encoded: %w", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("briefcase key from %s must be 256 bits, not %d", name, len(key)*8)
+	}
+	return &staticKey{name: name, key: key}, nil
+}
+
+func (k *staticKey) Name() string {
+	return k.name
+}
+
+func (k *staticKey) NewDataKey() ([]byte, string, error) {
+	return k.key, "", nil
+}
+
+func (k *staticKey) DataKey(string) ([]byte, error) {
+	return k.key, nil
+}
+
+// TransitClient is the part of a Vault client needed to use a transit key.
+type TransitClient interface {
+	TransitDataKey(mount, name string) ([]byte, string, error)
+	TransitDecrypt(mount, name string, ciphertext string) ([]byte, error)
+}
+
+// transitKey gets data keys from Vault's transit secrets engine. Only the encrypted data key is stored. Decrypted
+// data keys are remembered, so a sidecar only asks Vault once.
+type transitKey struct {
+	client    TransitClient
+	mount     string
+	name      string
+	decrypted map[string][]byte
+}
+
+// NewTransitKey is a KeySource using data keys made by the named key of the transit secrets engine at mount.
+func NewTransitKey(client TransitClient, mount, name string) KeySource {
+	return &transitKey{client: client, mount: mount, name: name, decrypted: make(map[string][]byte)}
+}
+
+func (k *transitKey) Name() string {
+	return "transit:" + strings.Trim(k.mount, "/") + "/" + k.name
+}
+
+func (k *transitKey) NewDataKey() ([]byte, string, error) {
+	key, stored, err := k.client.TransitDataKey(k.mount, k.name)
+	if err != nil {
+		return nil, "", err
+	}
+	k.decrypted[stored] = key
+	return key, stored, nil
+}
+
+func (k *transitKey) DataKey(stored string) ([]byte, error) {
+	if key, ok := k.decrypted[stored]; ok {
+		return key, nil
+	}
+	key, err := k.client.TransitDecrypt(k.mount, k.name, stored)
+	if err != nil {
+		return nil, err
+	}
+	k.decrypted[stored] = key
+	return key, nil
+}
+
+// encryption is how a briefcase is encrypted. The data key is kept so a sidecar doesn't ask Vault for a new one
+// every time it saves the briefcase.
+type encryption struct {
+	keys    KeySource
+	dataKey []byte
+	stored  string
+}
+
+func (e *encryption) seal(plaintext []byte) ([]byte, error) {
+	if e.dataKey == nil {
+		dataKey, stored, err := e.keys.NewDataKey()
+		if err != nil {
+			return nil, fmt.Errorf("could not get a key to encrypt the briefcase with: %w", err)
+		}
+		e.dataKey, e.stored = dataKey, stored
+	}
+
+	gcm, err := newGCM(e.dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Encrypted:  envelopeVersion,
+		Source:     e.keys.Name(),
+		DataKey:    e.stored,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	})
+}
+
+// open returns the briefcase JSON in data, decrypting it if needed. It returns true if data was encrypted.
+func (e *encryption) open(data []byte) ([]byte, bool, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Encrypted == 0 {
+		// Not an envelope, so a briefcase that hasn't been encrypted (yet).
+		return data, false, nil
+	}
+
+	if env.Encrypted > envelopeVersion {
+		return nil, true, fmt.Errorf("briefcase was encrypted by a newer release (envelope version %d)", env.Encrypted)
+	}
+
+	if e == nil {
+		return nil, true, ErrBriefcaseEncrypted
+	}
+
+	dataKey, err := e.keys.DataKey(env.DataKey)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not get the key the briefcase was encrypted with (%s): %w", env.Source, err)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not decode briefcase nonce: %w", err)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not decode encrypted briefcase: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, true, errors.New("briefcase nonce is the wrong size")
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not decrypt briefcase (encrypted with %s) - is it the right key?: %w", env.Source, err)
+	}
+
+	e.dataKey, e.stored = dataKey, env.DataKey
+
+	return plaintext, true, nil
+}
+
+// sealed returns true if data is an encrypted briefcase.
+func sealed(data []byte) bool {
+	var env envelope
+	return json.Unmarshal(data, &env) == nil && env.Encrypted != 0
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,120 @@
+package briefcase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBriefcaseKey = "5CzlsaPWyY0k0OcmJEJRUtZsGgA5m8yFH5JTHbyqKCU="
+
+// the token in myToken
+const testTokenID = "s.eD8onDKEpvQqNCrSZDwxPLld"
+
+func TestEncryptedBriefcase(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	keys, err := NewStaticKey("test", testBriefcaseKey)
+	assert.NoError(t, err)
+
+	bc := NewBriefcase(nil)
+	bc.EncryptWith(keys)
+	token := myToken(t)
+	assert.NoError(t, bc.EnrollVaultToken(context.Background(), util.NewWrappedToken(&token, true)))
+	assert.NoError(t, bc.SaveAs(filename))
+
+	saved, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(saved), testTokenID, "the vault token must not be saved in plaintext")
+
+	loaded, err := LoadBriefcase(filename, nil, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, testTokenID, loaded.AuthTokenLease.Token)
+
+	_, err = LoadBriefcase(filename, nil, nil)
+	assert.True(t, errors.Is(err, ErrBriefcaseEncrypted), "an encrypted briefcase needs a key")
+
+	otherKeys, err := NewStaticKey("other", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	assert.NoError(t, err)
+	_, err = LoadBriefcase(filename, nil, otherKeys)
+	assert.Error(t, err, "the wrong key must not decrypt the briefcase")
+}
+
+func TestPlaintextBriefcaseEncryptedOnSave(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	bc := NewBriefcase(nil)
+	token := myToken(t)
+	assert.NoError(t, bc.EnrollVaultToken(context.Background(), util.NewWrappedToken(&token, true)))
+	assert.NoError(t, bc.SaveAs(filename))
+
+	keys, err := NewStaticKey("test", testBriefcaseKey)
+	assert.NoError(t, err)
+
+	loaded, err := LoadBriefcase(filename, nil, keys)
+	assert.NoError(t, err, "a plaintext briefcase must still be read when there is a key")
+	assert.NoError(t, loaded.SaveAs(filename))
+
+	saved, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(saved), testTokenID, "the briefcase must be encrypted when next saved")
+
+	_, err = os.Stat(BackupFilename(filename))
+	assert.True(t, os.IsNotExist(err), "the plaintext briefcase must not be kept as the backup")
+
+	_, err = LoadBriefcase(filename, nil, nil)
+	assert.True(t, errors.Is(err, ErrBriefcaseEncrypted))
+}
+
+func TestStaticKeyMustBe256Bits(t *testing.T) {
+	_, err := NewStaticKey("test", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.Error(t, err)
+
+	_, err = NewStaticKey("test", "not base64!")
+	assert.Error(t, err)
+}
+
+type fakeTransit struct {
+	dataKeys int
+	decrypts int
+}
+
+func (f *fakeTransit) TransitDataKey(mount, name string) ([]byte, string, error) {
+	f.dataKeys++
+	return make([]byte, 32), "vault:v1:wrapped", nil
+}
+
+func (f *fakeTransit) TransitDecrypt(mount, name string, ciphertext string) ([]byte, error) {
+	f.decrypts++
+	if ciphertext != "vault:v1:wrapped" {
+		return nil, errors.New("unknown ciphertext")
+	}
+	return make([]byte, 32), nil
+}
+
+func TestTransitEncryptedBriefcase(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+
+	transit := &fakeTransit{}
+	bc := NewBriefcase(nil)
+	bc.EncryptWith(NewTransitKey(transit, "transit", "briefcase"))
+	assert.NoError(t, bc.SaveAs(filename))
+	assert.NoError(t, bc.SaveAs(filename))
+	assert.Equal(t, 1, transit.dataKeys, "the data key must be kept between saves")
+
+	restarted := &fakeTransit{}
+	keys := NewTransitKey(restarted, "transit", "briefcase")
+	_, err := LoadBriefcase(filename, nil, keys)
+	assert.NoError(t, err)
+	_, err = LoadBriefcase(filename, nil, keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, restarted.decrypts, "decrypted data keys must be remembered")
+	assert.Equal(t, 0, restarted.dataKeys)
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 )
 
+// ShouldRefreshSecret returns true if the secret hasn't been written, or one of the outputs of its fields was removed
+// or changed since.
 func (b *Briefcase) ShouldRefreshSecret(secret config.SecretType) bool {
 	var exists bool
 
@@ -13,29 +15,47 @@ func (b *Briefcase) ShouldRefreshSecret(secret config.SecretType) bool {
 
 	switch secret.Lifetime {
 	case util.LifetimeToken:
-		_, exists = b.TokenScopedSecrets[secret.Path]
+		_, exists = b.TokenScopedSecrets[secret.VaultLocation()]
 	case util.LifetimeStatic:
-		_, exists = b.StaticScopedSecrets[secret.Path]
+		_, exists = b.StaticScopedSecrets[secret.VaultLocation()]
 	default:
 		panic(fmt.Sprintf("briefcase does not manage refresh of %q lifetime secrets", secret.Lifetime))
 	}
 
-	return !exists
+	return !exists || b.outputsDrifted(secretOutputs(secret)...)
 }
 
 func (b *Briefcase) EnrollSecret(secret config.SecretType) {
-	b.log.Info().Str("vaultPath", secret.Path).Interface("lifetime", secret.Lifetime).Msg("enrolling secret")
+	b.log.Info().Str("vaultPath", secret.Path).Str("namespace", secret.Namespace).Interface("lifetime", secret.Lifetime).Msg("enrolling secret")
 
 	switch secret.Lifetime {
 	case util.LifetimeToken:
-		b.TokenScopedSecrets[secret.Path] = true
+		b.TokenScopedSecrets[secret.VaultLocation()] = true
 	case util.LifetimeStatic:
-		b.StaticScopedSecrets[secret.Path] = true
+		b.StaticScopedSecrets[secret.VaultLocation()] = true
 	default:
 		panic(fmt.Sprintf("lifetime of %q cannot be enrolled in briefcase", secret.Lifetime))
 	}
+	b.enrollOutputs(secretOutputs(secret)...)
 }
 
+// SecretVersion returns the version of a secret with a lifetime of "version" that its fields were last written
+// with. It returns 0 if they haven't been written, or one of their outputs was removed or changed since.
+func (b *Briefcase) SecretVersion(secret config.SecretType) int64 {
+	version := b.VersionScopedSecrets[secret.VaultLocation()]
+	if version != 0 && b.outputsDrifted(secretOutputs(secret)...) {
+		return 0
+	}
+	return version
+}
+
+// EnrollVersionedSecret records the version of a secret with a lifetime of "version" its fields were written with.
+func (b *Briefcase) EnrollVersionedSecret(secret config.SecretType, version int64) {
+	b.VersionScopedSecrets[secret.VaultLocation()] = version
+	b.enrollOutputs(secretOutputs(secret)...)
+}
+
+// ShouldRefreshComposite returns true if the composite hasn't been written, or its file was removed or changed since.
 func (b *Briefcase) ShouldRefreshComposite(composite config.CompositeSecretFile) bool {
 	var exists bool
 
@@ -49,7 +69,7 @@ func (b *Briefcase) ShouldRefreshComposite(composite config.CompositeSecretFile)
 
 	}
 
-	return !exists
+	return !exists || b.outputsDrifted(composite.Filename)
 }
 
 func (b *Briefcase) EnrollComposite(composite config.CompositeSecretFile) {
@@ -63,5 +83,23 @@ func (b *Briefcase) EnrollComposite(composite config.CompositeSecretFile) {
 	default:
 		panic(fmt.Sprintf("enrolling composites of lifetime %q is not supported", composite.Lifetime))
 	}
+	b.enrollOutputs(composite.Filename)
+
+}
+
+// CompositeVersions returns the versions of the secrets a composite with a lifetime of "version" was last written
+// with, keyed by where they are in Vault. It returns false if the composite hasn't been written, or its file was
+// removed or changed since.
+func (b *Briefcase) CompositeVersions(composite config.CompositeSecretFile) (map[string]int64, bool) {
+	versions, exists := b.VersionScopedComposites[composite.Filename]
+	return versions, exists && !b.outputsDrifted(composite.Filename)
+}
+
+// EnrollVersionedComposite records the versions of the secrets a composite with a lifetime of "version" was
+// written with.
+func (b *Briefcase) EnrollVersionedComposite(composite config.CompositeSecretFile, versions map[string]int64) {
+	b.log.Info().Str("filename", composite.Filename).Interface("versions", versions).Msg("enrolling versioned composite secret")
 
+	b.VersionScopedComposites[composite.Filename] = versions
+	b.enrollOutputs(composite.Filename)
 }
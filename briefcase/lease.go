@@ -0,0 +1,161 @@
+package briefcase
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+)
+
+// lease is a Vault lease on a dynamic secret, along with the data it was issued with. The data is kept so outputs
+// and templates can be written without asking Vault for a new secret, but as it is a secret, it is only saved in
+// an encrypted briefcase. Leases are renewed half way through their duration.
+type lease struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Expiry        time.Time              `json:"expiry"`
+	NextRenewal   time.Time              `json:"next_renewal"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+}
+
+// TrackedLease describes a lease held in the briefcase, along with the Vault connection and namespace it was
+// created in, so it can be revoked.
+type TrackedLease struct {
+	Kind      string
+	Name      string
+	LeaseID   string
+	Vault     string
+	Namespace string
+}
+
+// TrackedLeases returns every lease in the briefcase, ordered by kind and name.
+func (b *Briefcase) TrackedLeases() []TrackedLease {
+	var leases []TrackedLease
+
+	for outputPath, entry := range b.AWSCredentialLeases {
+		if entry.LeaseID != "" {
+			leases = append(leases, TrackedLease{
+				Kind:      "aws",
+				Name:      outputPath + ":" + entry.AWSCredential.Profile,
+				LeaseID:   entry.LeaseID,
+				Vault:     entry.AWSCredential.Vault,
+				Namespace: entry.AWSCredential.Namespace,
+			})
+		}
+	}
+
+	for key, entry := range b.DatabaseCredentials {
+		leases = append(leases, TrackedLease{
+			Kind:      "database",
+			Name:      key,
+			LeaseID:   entry.LeaseID,
+			Vault:     entry.Cfg.Vault,
+			Namespace: entry.Cfg.Namespace,
+		})
+	}
+
+	for key, entry := range b.DynamicSecrets {
+		leases = append(leases, TrackedLease{
+			Kind:      "dynamic",
+			Name:      key,
+			LeaseID:   entry.LeaseID,
+			Vault:     entry.Cfg.Vault,
+			Namespace: entry.Cfg.Namespace,
+		})
+	}
+
+	sort.Slice(leases, func(i, j int) bool {
+		if leases[i].Kind != leases[j].Kind {
+			return leases[i].Kind < leases[j].Kind
+		}
+		return leases[i].Name < leases[j].Name
+	})
+
+	return leases
+}
+
+func newLease(ctx context.Context, secret *api.Secret) lease {
+	l := lease{
+		LeaseID: secret.LeaseID,
+		Data:    secret.Data,
+	}
+	l.extend(ctx, secret)
+	return l
+}
+
+// extend records the lease duration Vault gave when issuing or renewing the lease. Vault caps renewals at the
+// max TTL of the lease, so the new expiry may be sooner than hoped.
+func (l *lease) extend(ctx context.Context, secret *api.Secret) {
+	now := clock.Now(ctx)
+	duration := time.Duration(secret.LeaseDuration) * time.Second
+
+	l.LeaseDuration = secret.LeaseDuration
+	l.Renewable = secret.Renewable
+	l.Expiry = now.Add(duration)
+	l.NextRenewal = now.Add(duration / 2)
+}
+
+// expiresBefore is true if the lease will have expired by the specified time.
+func (l lease) expiresBefore(t time.Time) bool {
+	return !l.Expiry.After(t)
+}
+
+// dueForRenewal is true if the lease is renewable, and is either half way through its duration or expires before
+// the specified time.
+func (l lease) dueForRenewal(ctx context.Context, expiresBefore time.Time) bool {
+	return l.Renewable && (!clock.Now(ctx).Before(l.NextRenewal) || l.expiresBefore(expiresBefore))
+}
+
+// withoutLeaseData returns a copy of the briefcase without the data of its leases, for saving it unencrypted.
+func (b *Briefcase) withoutLeaseData() *Briefcase {
+	stripped := *b
+
+	stripped.DatabaseCredentials = make(map[string]leasedDatabaseCredential, len(b.DatabaseCredentials))
+	for key, entry := range b.DatabaseCredentials {
+		entry.Data = nil
+		stripped.DatabaseCredentials[key] = entry
+	}
+
+	stripped.DynamicSecrets = make(map[string]leasedDynamicSecret, len(b.DynamicSecrets))
+	for key, entry := range b.DynamicSecrets {
+		entry.Data = nil
+		stripped.DynamicSecrets[key] = entry
+	}
+
+	return &stripped
+}
+
+// RestoreLeaseData copies the data of leases from previous, the briefcase of an earlier sync by the same process,
+// into the same leases loaded without it. An unencrypted briefcase is saved without the data, so without this a long
+// running sidecar would replace every database credential and dynamic secret on each sync.
+func (b *Briefcase) RestoreLeaseData(previous *Briefcase) {
+	for key, entry := range b.DatabaseCredentials {
+		if kept, ok := previous.DatabaseCredentials[key]; ok && entry.Data == nil && kept.LeaseID == entry.LeaseID {
+			entry.Data = kept.Data
+			b.DatabaseCredentials[key] = entry
+		}
+	}
+
+	for key, entry := range b.DynamicSecrets {
+		if kept, ok := previous.DynamicSecrets[key]; ok && entry.Data == nil && kept.LeaseID == entry.LeaseID {
+			entry.Data = kept.Data
+			b.DynamicSecrets[key] = entry
+		}
+	}
+}
+
+// simpleSecrets turns the data of the lease into fields of a secret with the specified key.
+func (l lease) simpleSecrets(key string) []SimpleSecret {
+	var simpleSecrets []SimpleSecret
+	for field, value := range l.Data {
+		simpleSecrets = append(simpleSecrets, SimpleSecret{
+			Key:   key,
+			Field: field,
+			Value: value,
+		})
+	}
+	return simpleSecrets
+}
@@ -0,0 +1,93 @@
+package briefcase
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseDataOnlySavedEncrypted(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+	ctx := context.Background()
+
+	db := config.DatabaseType{Key: "db"}
+	dyn := config.DynamicType{Key: "rabbit"}
+
+	bc := NewBriefcase(nil)
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{
+		LeaseID: "database/creds/readonly/abc", LeaseDuration: 3600, Renewable: true,
+		Data: map[string]interface{}{"username": "v-readonly", "password": "db-password"},
+	}, db)
+	bc.EnrollDynamicSecret(ctx, &api.Secret{
+		LeaseID: "rabbitmq/creds/producer/abc", LeaseDuration: 3600, Renewable: true,
+		Data: map[string]interface{}{"username": "producer", "password": "rabbit-password"},
+	}, dyn)
+
+	assert.NoError(t, bc.SaveAs(filename))
+
+	saved, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(saved), "db-password", "credentials must not be saved in an unencrypted briefcase")
+	assert.NotContains(t, string(saved), "rabbit-password", "secrets must not be saved in an unencrypted briefcase")
+	assert.Contains(t, string(saved), "database/creds/readonly/abc", "leases must still be saved")
+	assert.Equal(t, "db-password", bc.DatabaseCredentials["db"].Data["password"], "saving must not forget the credential")
+
+	loaded, err := LoadBriefcase(filename, nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, loaded.ShouldIssueDatabaseCredential(db, time.Now()), "a lease without its credential must be replaced")
+	assert.True(t, loaded.ShouldFetchDynamicSecret(dyn, time.Now()), "a lease without its secret must be replaced")
+
+	keys, err := NewStaticKey("test", testBriefcaseKey)
+	assert.NoError(t, err)
+	bc.EncryptWith(keys)
+	assert.NoError(t, bc.SaveAs(filename))
+
+	loaded, err = LoadBriefcase(filename, nil, keys)
+	assert.NoError(t, err)
+	assert.False(t, loaded.ShouldIssueDatabaseCredential(db, time.Now()))
+	assert.False(t, loaded.ShouldFetchDynamicSecret(dyn, time.Now()))
+	assert.Equal(t, "db-password", loaded.DatabaseCredentials["db"].Data["password"])
+	assert.Equal(t, "rabbit-password", loaded.DynamicSecrets["rabbit"].Data["password"])
+}
+
+func TestRestoreLeaseData(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+	ctx := context.Background()
+
+	db := config.DatabaseType{Key: "db"}
+	dyn := config.DynamicType{Key: "rabbit"}
+
+	bc := NewBriefcase(nil)
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{
+		LeaseID: "database/creds/readonly/abc", LeaseDuration: 3600, Renewable: true,
+		Data: map[string]interface{}{"password": "db-password"},
+	}, db)
+	bc.EnrollDynamicSecret(ctx, &api.Secret{
+		LeaseID: "rabbitmq/creds/producer/abc", LeaseDuration: 3600, Renewable: true,
+		Data: map[string]interface{}{"password": "rabbit-password"},
+	}, dyn)
+	assert.NoError(t, bc.SaveAs(filename))
+
+	loaded, err := LoadBriefcase(filename, nil, nil)
+	assert.NoError(t, err)
+	loaded.RestoreLeaseData(bc)
+	assert.False(t, loaded.ShouldIssueDatabaseCredential(db, time.Now()))
+	assert.False(t, loaded.ShouldFetchDynamicSecret(dyn, time.Now()))
+	assert.Equal(t, "db-password", loaded.DatabaseCredentials["db"].Data["password"])
+
+	// Data is only restored to the same lease.
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{
+		LeaseID: "database/creds/readonly/def", LeaseDuration: 3600, Renewable: true,
+		Data: map[string]interface{}{"password": "other-password"},
+	}, db)
+	loaded, err = LoadBriefcase(filename, nil, nil)
+	assert.NoError(t, err)
+	loaded.RestoreLeaseData(bc)
+	assert.True(t, loaded.ShouldIssueDatabaseCredential(db, time.Now()), "data of another lease must not be restored")
+}
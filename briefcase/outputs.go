@@ -0,0 +1,130 @@
+package briefcase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+// Output files drift when they are removed or changed outside of the tool.
+const (
+	driftMissing  = "missing"
+	driftModified = "modified"
+)
+
+// enrollOutputs records what is in each output file now that it has been written, so later syncs can tell if it
+// was removed or changed. Outputs that weren't written (such as fields of a secret that is missingOk) are recorded
+// as such, so they aren't mistaken for outputs that were removed.
+func (b *Briefcase) enrollOutputs(filenames ...string) {
+	for _, filename := range filenames {
+		hash, err := hashFile(filename)
+		if err != nil && !os.IsNotExist(err) {
+			b.log.Warn().Err(err).Str("filename", filename).Msg("could not read output file, it will be rewritten on the next sync")
+			delete(b.OutputHashes, filename)
+			continue
+		}
+		b.OutputHashes[filename] = hash
+	}
+}
+
+// outputsDrifted returns true if any of the output files were removed or changed since they were written. Each
+// output that drifted is logged and counted. Outputs from a briefcase that didn't record what was written to them
+// are taken as they are, unless they're missing.
+func (b *Briefcase) outputsDrifted(filenames ...string) bool {
+	drifted := false
+
+	for _, filename := range filenames {
+		recorded, ok := b.OutputHashes[filename]
+		if ok && recorded == "" {
+			// Nothing was written, so there is nothing to drift.
+			continue
+		}
+
+		hash, err := hashFile(filename)
+
+		var reason string
+		switch {
+		case os.IsNotExist(err):
+			reason = driftMissing
+		case err != nil:
+			b.log.Warn().Err(err).Str("filename", filename).Msg("could not read output file to check it")
+			continue
+		case !ok:
+			b.OutputHashes[filename] = hash
+			continue
+		case hash != recorded:
+			reason = driftModified
+		default:
+			continue
+		}
+
+		b.log.Warn().Str("filename", filename).Str("drift", reason).Msg("output file was changed outside of vault-ctrl-tool, it will be rewritten")
+		b.metrics.OutputDrifted(reason)
+		drifted = true
+	}
+
+	return drifted
+}
+
+// fieldOutputs are the files the fields of a secret are written to.
+func fieldOutputs(fields []config.SecretFieldType) []string {
+	var outputs []string
+	for _, field := range fields {
+		if field.Output != "" {
+			outputs = append(outputs, field.Output)
+		}
+	}
+	return outputs
+}
+
+// secretOutputs are the files the fields of a secret are written to.
+func secretOutputs(secret config.SecretType) []string {
+	return fieldOutputs(secret.Fields)
+}
+
+// dynamicOutputs are the files the fields of a dynamic secret are written to, along with the output of the stanza.
+func dynamicOutputs(dyn config.DynamicType) []string {
+	outputs := fieldOutputs(dyn.Fields)
+	if dyn.Output != "" {
+		outputs = append(outputs, dyn.Output)
+	}
+	return outputs
+}
+
+// awsOutputs are the files AWS credentials are written to.
+func awsOutputs(aws config.AWSType) []string {
+	return []string{filepath.Join(aws.OutputPath, "config"), filepath.Join(aws.OutputPath, "credentials")}
+}
+
+// sshOutputs are the key pair and certificate written for an SSH certificate.
+func sshOutputs(ssh config.SSHCertificateType) []string {
+	return []string{
+		filepath.Join(ssh.OutputPath, util.SSHPrivateKey),
+		filepath.Join(ssh.OutputPath, util.SSHPublicKey),
+		filepath.Join(ssh.OutputPath, util.SSHCertificate),
+	}
+}
+
+// pkiOutputs are the files written for a PKI certificate.
+func pkiOutputs(pki config.PKICertificateType) []string {
+	return []string{
+		filepath.Join(pki.OutputPath, util.PKICertificate),
+		filepath.Join(pki.OutputPath, util.PKIPrivateKey),
+		filepath.Join(pki.OutputPath, util.PKIChain),
+		filepath.Join(pki.OutputPath, util.PKICABundle),
+	}
+}
+
+func hashFile(filename string) (string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
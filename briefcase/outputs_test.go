@@ -0,0 +1,118 @@
+package briefcase
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/stretchr/testify/assert"
+	testing2 "k8s.io/utils/clock/testing"
+)
+
+func TestTemplateOutputDrift(t *testing.T) {
+	output := path.Join(t.TempDir(), "app.conf")
+	tmpl := config.TemplateType{Output: output, Lifetime: util.LifetimeStatic}
+
+	mtrics := metrics.NewMetrics()
+	bc := NewBriefcase(mtrics)
+
+	assert.NoError(t, ioutil.WriteFile(output, []byte("a=1\n"), 0600))
+	bc.EnrollTemplate(tmpl)
+	assert.False(t, bc.ShouldRefreshTemplate(tmpl), "unchanged output must not be refreshed")
+
+	assert.NoError(t, ioutil.WriteFile(output, []byte("a=2\n"), 0600))
+	assert.True(t, bc.ShouldRefreshTemplate(tmpl), "modified output must be refreshed")
+
+	bc.EnrollTemplate(tmpl)
+	assert.False(t, bc.ShouldRefreshTemplate(tmpl))
+
+	assert.NoError(t, os.Remove(output))
+	assert.True(t, bc.ShouldRefreshTemplate(tmpl), "missing output must be refreshed")
+
+	assert.Equal(t, 2, mtrics.Counter(metrics.OutputDrift))
+}
+
+func TestSecretOutputNotWritten(t *testing.T) {
+	output := path.Join(t.TempDir(), "password")
+	secret := config.SecretType{
+		Key:         "example",
+		Path:        "path/in/vault",
+		Lifetime:    util.LifetimeStatic,
+		IsMissingOk: true,
+		Fields:      []config.SecretFieldType{{Name: "password", Output: output}},
+	}
+
+	bc := NewBriefcase(nil)
+
+	// A missingOk secret that wasn't there, so its field wasn't written.
+	bc.EnrollSecret(secret)
+	assert.False(t, bc.ShouldRefreshSecret(secret), "output that was never written has not drifted")
+}
+
+func TestOutputsFromOlderBriefcase(t *testing.T) {
+	dir := t.TempDir()
+	present := path.Join(dir, "present.conf")
+	missing := path.Join(dir, "missing.conf")
+	assert.NoError(t, ioutil.WriteFile(present, []byte("a=1\n"), 0600))
+
+	// Written by a release that didn't record what it wrote to each output.
+	bc := NewBriefcase(nil)
+	bc.StaticTemplates[present] = true
+	bc.StaticTemplates[missing] = true
+
+	presentTmpl := config.TemplateType{Output: present, Lifetime: util.LifetimeStatic}
+	assert.False(t, bc.ShouldRefreshTemplate(presentTmpl), "existing output is taken as it is")
+
+	assert.NoError(t, ioutil.WriteFile(present, []byte("a=2\n"), 0600))
+	assert.True(t, bc.ShouldRefreshTemplate(presentTmpl), "output changed after it was taken must be refreshed")
+
+	assert.True(t, bc.ShouldRefreshTemplate(config.TemplateType{Output: missing, Lifetime: util.LifetimeStatic}),
+		"missing output must be refreshed")
+}
+
+func TestAWSCredentialOutputDrift(t *testing.T) {
+	dir := t.TempDir()
+	awsCreds := mySTSCreds(t)
+	awsConfig := config.AWSType{OutputPath: dir, Profile: "default", Region: "us-east-1"}
+
+	ctx := clock.Set(context.Background(), testing2.NewFakeClock(testTime))
+	bc := NewBriefcase(nil)
+
+	assert.False(t, bc.AWSCredentialOutputsDrifted(awsConfig), "credentials that were never fetched have not drifted")
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "config"), []byte("[default]\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(path.Join(dir, "credentials"), []byte("[default]\n"), 0600))
+	bc.EnrollAWSCredential(ctx, &awsCreds, awsConfig, 0)
+	assert.False(t, bc.AWSCredentialOutputsDrifted(awsConfig))
+
+	assert.NoError(t, os.Remove(path.Join(dir, "credentials")))
+	assert.True(t, bc.AWSCredentialOutputsDrifted(awsConfig), "missing credentials must be fetched again")
+}
+
+func TestCertificateOutputDrift(t *testing.T) {
+	ctx := clock.Set(context.Background(), testing2.NewFakeClock(testTime))
+	bc := NewBriefcase(nil)
+
+	pkiConfig := config.PKICertificateType{OutputPath: t.TempDir()}
+	createPKICertificate(testTime, pkiConfig.OutputPath, 4*time.Hour, t)
+	assert.NoError(t, bc.EnrollPKICertificate(pkiConfig))
+	assert.False(t, bc.ShouldRefreshPKICertificate(ctx, pkiConfig, testTime.Add(time.Minute)))
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(pkiConfig.OutputPath, util.PKICertificate), []byte("edited\n"), 0600))
+	assert.True(t, bc.ShouldRefreshPKICertificate(ctx, pkiConfig, testTime.Add(time.Minute)), "modified certificate must be reissued")
+
+	sshConfig := config.SSHCertificateType{OutputPath: t.TempDir()}
+	createSSHSignedPublicKey(testTime, sshConfig.OutputPath, time.Hour, t)
+	assert.NoError(t, bc.EnrollSSHCertificate(ctx, sshConfig, 0))
+	assert.False(t, bc.ShouldRefreshSSHCertificate(sshConfig, testTime.Add(time.Minute)))
+
+	assert.NoError(t, os.Remove(path.Join(sshConfig.OutputPath, util.SSHCertificate)))
+	assert.True(t, bc.ShouldRefreshSSHCertificate(sshConfig, testTime.Add(time.Minute)), "missing certificate must be reissued")
+}
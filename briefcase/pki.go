@@ -0,0 +1,91 @@
+package briefcase
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+)
+
+// PKI certificates are reissued once a fraction of their lifetime has passed, so services always have time to
+// pick up the new certificate before the old one expires.
+type pkiCert struct {
+	Expiry    time.Time                 `json:"expiry"`
+	ReissueAt time.Time                 `json:"reissue_at"`
+	Cfg       config.PKICertificateType `json:"cfg"`
+}
+
+// ShouldRefreshPKICertificate returns true if there is no certificate for the stanza, if it is time to reissue it,
+// if it expires before the specified time, or if its files were removed or changed since they were written.
+func (b *Briefcase) ShouldRefreshPKICertificate(ctx context.Context, pkiConfig config.PKICertificateType, expiresBefore time.Time) bool {
+	entry, ok := b.PKICertificates[pkiConfig.OutputPath]
+	if !ok {
+		return true
+	}
+
+	b.log.Debug().Time("expiry", entry.Expiry).Time("reissueAt", entry.ReissueAt).Str("outputPath", pkiConfig.OutputPath).
+		Msg("determined expiry of pki certificate")
+
+	return !clock.Now(ctx).Before(entry.ReissueAt) || entry.Expiry.Before(expiresBefore) ||
+		b.outputsDrifted(pkiOutputs(pkiConfig)...)
+}
+
+// EnrollPKICertificate adds a managed PKI certificate to the briefcase, reading its lifetime from the certificate
+// that was written out.
+func (b *Briefcase) EnrollPKICertificate(pkiConfig config.PKICertificateType) error {
+	certificateFilename := filepath.Join(pkiConfig.OutputPath, util.PKICertificate)
+
+	log := b.log.With().Str("filename", certificateFilename).Logger()
+
+	log.Debug().Msg("enrolling pki certificate")
+
+	certificate, err := readPEMCertificate(certificateFilename)
+	if err != nil {
+		log.Debug().Err(err).Msg("failed to read pki certificate")
+		return err
+	}
+
+	fraction := pkiConfig.ReissueFraction
+	if fraction <= 0 || fraction >= 1 {
+		fraction = config.DefaultPKIReissueFraction
+	}
+
+	lifetime := certificate.NotAfter.Sub(certificate.NotBefore)
+	reissueAt := certificate.NotBefore.Add(time.Duration(float64(lifetime) * fraction))
+
+	log.Info().Time("notAfter", certificate.NotAfter).Time("reissueAt", reissueAt).Msg("pki certificate validity")
+
+	b.PKICertificates[pkiConfig.OutputPath] = pkiCert{
+		Expiry:    certificate.NotAfter,
+		ReissueAt: reissueAt,
+		Cfg:       pkiConfig,
+	}
+	b.enrollOutputs(pkiOutputs(pkiConfig)...)
+	return nil
+}
+
+func readPEMCertificate(filename string) (*x509.Certificate, error) {
+	pemBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read certificate %q: %w", filename, err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate found in %q", filename)
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse certificate %q: %w", filename, err)
+	}
+
+	return certificate, nil
+}
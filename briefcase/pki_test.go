@@ -0,0 +1,88 @@
+package briefcase
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/stretchr/testify/assert"
+	testing2 "k8s.io/utils/clock/testing"
+)
+
+func createPKICertificate(notBefore time.Time, dir string, lifetime time.Duration, t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "unit-tests.example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(lifetime),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(err)
+
+	fd, err := os.Create(path.Join(dir, util.PKICertificate))
+	assert.NoError(err)
+	assert.NoError(pem.Encode(fd, &pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	fd.Close()
+}
+
+func TestPKICertificateReissuedAtFractionOfLifetime(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeClock := testing2.NewFakeClock(testTime)
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	bc := NewBriefcase(nil)
+	dir := t.TempDir()
+
+	pkiConfig := config.PKICertificateType{
+		OutputPath:      dir,
+		ReissueFraction: 0.5,
+	}
+
+	assert.True(bc.ShouldRefreshPKICertificate(ctx, pkiConfig, testTime), "missing certificates must be issued")
+
+	createPKICertificate(testTime, dir, 4*time.Hour, t)
+	assert.NoError(bc.EnrollPKICertificate(pkiConfig))
+
+	assert.False(bc.ShouldRefreshPKICertificate(ctx, pkiConfig, testTime.Add(time.Minute)), "new certificate must not be reissued")
+
+	fakeClock.Step(2*time.Hour - time.Second)
+	assert.False(bc.ShouldRefreshPKICertificate(ctx, pkiConfig, fakeClock.Now().Add(time.Minute)), "certificate must not be reissued before half its lifetime")
+
+	fakeClock.Step(time.Second)
+	assert.True(bc.ShouldRefreshPKICertificate(ctx, pkiConfig, fakeClock.Now().Add(time.Minute)), "certificate must be reissued at half its lifetime")
+}
+
+func TestPKICertificateReissuedBeforeExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := clock.Set(context.Background(), testing2.NewFakeClock(testTime))
+
+	bc := NewBriefcase(nil)
+	dir := t.TempDir()
+
+	pkiConfig := config.PKICertificateType{OutputPath: dir}
+
+	createPKICertificate(testTime, dir, time.Hour, t)
+	assert.NoError(bc.EnrollPKICertificate(pkiConfig))
+
+	assert.True(bc.ShouldRefreshPKICertificate(ctx, pkiConfig, testTime.Add(2*time.Hour)), "certificate expiring before next sync must be reissued")
+}
@@ -0,0 +1,72 @@
+package briefcase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// SchemaVersion is the version of the briefcase this release writes. Increment it whenever the briefcase changes in
+// a way that needs older briefcases to be upgraded, or that older releases would misread, and add a migration.
+const SchemaVersion = 1
+
+// ErrUnsupportedSchema is returned when reading a briefcase written by a newer release. Reading it anyway would
+// silently drop whatever the newer release added.
+var ErrUnsupportedSchema = errors.New("briefcase was written by a newer release")
+
+// rawBriefcase is a briefcase as JSON, keyed by the top level fields, so migrations can change it before it is read.
+type rawBriefcase map[string]json.RawMessage
+
+// migrations upgrade a briefcase from one schema version to the next: migrations[0] upgrades version 0 to 1, and
+// so on.
+var migrations = []func(rawBriefcase) error{
+	migrateUnversioned,
+}
+
+// migrateUnversioned upgrades briefcases from before there was a schema version. Every field added to the
+// briefcase up until then (such as "refresh_expiry") was optional, so nothing needs to change.
+func migrateUnversioned(rawBriefcase) error {
+	return nil
+}
+
+// migrate upgrades briefcase JSON to the current schema version.
+func migrate(data []byte) ([]byte, error) {
+	var raw rawBriefcase
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	version := 0
+	if encoded, ok := raw["schema_version"]; ok {
+		if err := json.Unmarshal(encoded, &version); err != nil {
+			return nil, fmt.Errorf("could not parse briefcase schema version: %w", err)
+		}
+	}
+
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%w: schema version %d is newer than %d, the newest this release can read",
+			ErrUnsupportedSchema, version, SchemaVersion)
+	}
+
+	if version == SchemaVersion {
+		return data, nil
+	}
+
+	zlog.Info().Int("from", version).Int("to", SchemaVersion).Msg("upgrading briefcase schema")
+
+	for ; version < SchemaVersion; version++ {
+		if err := migrations[version](raw); err != nil {
+			return nil, fmt.Errorf("could not upgrade briefcase from schema version %d: %w", version, err)
+		}
+	}
+
+	encoded, err := json.Marshal(SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	raw["schema_version"] = encoded
+
+	return json.Marshal(raw)
+}
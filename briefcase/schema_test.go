@@ -0,0 +1,46 @@
+package briefcase
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unversionedBriefcase is a briefcase from before there were schema versions, and before "refresh_expiry".
+const unversionedBriefcase = `{
+  "auth": {"accessor": "8FvDM61Vc23jht83if5bFWlC", "renewable": true, "token": "s.eD8onDKEpvQqNCrSZDwxPLld",
+           "expiry": "2030-01-01T00:00:00Z", "next_refresh": "2029-12-01T00:00:00Z"},
+  "ssh": {"/etc/ssh": {"expiry": "2030-01-01T00:00:00Z", "cfg": {"vaultMountPoint": "ssh"}}},
+  "static_templates": {"/etc/secrets/app.conf": true}
+}`
+
+func TestUnversionedBriefcaseIsUpgraded(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(unversionedBriefcase), 0600))
+
+	bc, err := LoadBriefcase(filename, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaVersion, bc.SchemaVersion)
+	assert.Equal(t, "8FvDM61Vc23jht83if5bFWlC", bc.AuthTokenLease.Accessor)
+	assert.Contains(t, bc.SSHCertificates, "/etc/ssh")
+	assert.Nil(t, bc.SSHCertificates["/etc/ssh"].RefreshExpiry)
+	assert.True(t, bc.StaticTemplates["/etc/secrets/app.conf"])
+
+	assert.NoError(t, bc.SaveAs(filename))
+	saved, err := ioutil.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved), fmt.Sprintf(`"schema_version":%d`, SchemaVersion))
+}
+
+func TestNewerBriefcaseIsRefused(t *testing.T) {
+	filename := path.Join(t.TempDir(), "briefcase")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(`{"schema_version": 999, "auth": {}}`), 0600))
+
+	_, err := LoadBriefcase(filename, nil, nil)
+	assert.True(t, errors.Is(err, ErrUnsupportedSchema), "briefcases from newer releases must not be read")
+	assert.Contains(t, err.Error(), "999")
+}
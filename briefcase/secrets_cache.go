@@ -30,3 +30,8 @@ func (b *Briefcase) StoreSecrets(lifetime util.SecretLifetime, secrets []SimpleS
 func (b *Briefcase) GetSecrets(lifetime util.SecretLifetime) []SimpleSecret {
 	return b.secretCache[lifetime]
 }
+
+// ForgetCachedSecrets empties the cache, so each sync reads the secrets it needs afresh.
+func (b *Briefcase) ForgetCachedSecrets() {
+	b.secretCache = make(map[util.SecretLifetime][]SimpleSecret)
+}
@@ -15,6 +15,8 @@ import (
 
 var neverExpires = time.Unix(0, 0)
 
+// ShouldRefreshSSHCertificate returns true if there is no certificate for the stanza, if it expires or is due to be
+// refreshed before the specified time, or if its files were removed or changed since they were written.
 func (b *Briefcase) ShouldRefreshSSHCertificate(sshCertConfig config.SSHCertificateType, expiresBefore time.Time) bool {
 	entry, ok := b.SSHCertificates[sshCertConfig.OutputPath]
 	if !ok {
@@ -26,7 +28,7 @@ func (b *Briefcase) ShouldRefreshSSHCertificate(sshCertConfig config.SSHCertific
 	certExpiresBefore := entry.Expiry.Before(expiresBefore) || entry.Expiry == neverExpires
 	shouldRefreshBefore := entry.RefreshExpiry != nil && !entry.RefreshExpiry.IsZero() && entry.RefreshExpiry.Before(expiresBefore)
 
-	return certExpiresBefore || shouldRefreshBefore
+	return certExpiresBefore || shouldRefreshBefore || b.outputsDrifted(sshOutputs(sshCertConfig)...)
 }
 
 func createRefreshExpiry(ctx context.Context, forceRefreshTTL time.Duration) *time.Time {
@@ -72,6 +74,7 @@ func (b *Briefcase) EnrollSSHCertificate(ctx context.Context, sshCertConfig conf
 		RefreshExpiry: createRefreshExpiry(ctx, forceRefreshTTL),
 		Cfg:           sshCertConfig,
 	}
+	b.enrollOutputs(sshOutputs(sshCertConfig)...)
 	return nil
 }
 
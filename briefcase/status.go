@@ -0,0 +1,205 @@
+package briefcase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+)
+
+// StatusState is how close to expiring something tracked in the briefcase is.
+type StatusState string
+
+const (
+	StatusOK       StatusState = "ok"
+	StatusExpiring StatusState = "expiring"
+	StatusExpired  StatusState = "expired"
+)
+
+// StatusEntry describes one thing tracked in the briefcase. Vault tokens and secret values are never included.
+// Entries without an expiry, such as templates, are always "ok".
+type StatusEntry struct {
+	Kind          string      `json:"kind"`
+	Name          string      `json:"name"`
+	Detail        string      `json:"detail,omitempty"`
+	Expiry        *time.Time  `json:"expiry,omitempty"`
+	NextRefresh   *time.Time  `json:"next_refresh,omitempty"`
+	RefreshExpiry *time.Time  `json:"refresh_expiry,omitempty"`
+	State         StatusState `json:"state"`
+}
+
+// Status lists everything tracked in the briefcase, ordered by kind and name. Anything that expires before
+// nextRenewal is "expiring", as it will have expired before a sidecar next looks at it.
+func (b *Briefcase) Status(ctx context.Context, nextRenewal time.Time) []StatusEntry {
+	now := clock.Now(ctx)
+
+	var entries []StatusEntry
+
+	add := func(entry StatusEntry) {
+		entry.State = StatusOK
+		if entry.Expiry != nil {
+			if !now.Before(*entry.Expiry) {
+				entry.State = StatusExpired
+			} else if entry.Expiry.Before(nextRenewal) {
+				entry.State = StatusExpiring
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	authTokens := map[string]LeasedAuthToken{"": b.AuthTokenLease}
+	for connection, token := range b.ConnectionTokenLeases {
+		authTokens[connection] = token
+	}
+	for connection, token := range authTokens {
+		if token.Accessor == "" && token.Token == "" {
+			continue
+		}
+		name := connection
+		if name == "" {
+			name = "default"
+		}
+		detail := []string{"accessor " + token.Accessor}
+		if token.AuthMechanism != "" {
+			detail = append(detail, "via "+token.AuthMechanism)
+		}
+		if !token.Renewable {
+			detail = append(detail, "not renewable")
+		}
+		status := StatusEntry{Kind: "auth", Name: name}
+		if token.ExpiresAt.IsZero() {
+			detail = append(detail, "never expires")
+		} else {
+			status.Expiry = timePtr(token.ExpiresAt)
+			status.NextRefresh = timePtr(token.NextRefresh)
+		}
+		status.Detail = strings.Join(detail, ", ")
+		add(status)
+	}
+
+	for outputPath, entry := range b.SSHCertificates {
+		status := StatusEntry{
+			Kind:          "ssh",
+			Name:          outputPath,
+			RefreshExpiry: entry.RefreshExpiry,
+		}
+		if entry.Expiry == neverExpires {
+			status.Detail = "never expires"
+		} else {
+			status.Expiry = timePtr(entry.Expiry)
+		}
+		add(status)
+	}
+
+	for outputPath, entry := range b.PKICertificates {
+		add(StatusEntry{
+			Kind:        "pki",
+			Name:        outputPath,
+			Detail:      entry.Cfg.CommonName,
+			Expiry:      timePtr(entry.Expiry),
+			NextRefresh: timePtr(entry.ReissueAt),
+		})
+	}
+
+	for outputPath, entry := range b.AWSCredentialLeases {
+		status := StatusEntry{
+			Kind:          "aws",
+			Name:          outputPath,
+			Expiry:        timePtr(entry.Expiry),
+			RefreshExpiry: entry.RefreshExpiry,
+		}
+		if entry.AWSCredential.Profile != "" {
+			status.Detail = "profile " + entry.AWSCredential.Profile
+		}
+		add(status)
+	}
+
+	for key, entry := range b.DatabaseCredentials {
+		add(leaseStatus("database", key, entry.lease))
+	}
+
+	for key, entry := range b.DynamicSecrets {
+		add(leaseStatus("dynamic", key, entry.lease))
+	}
+
+	for output := range b.StaticTemplates {
+		add(StatusEntry{Kind: "template", Name: output, Detail: "static"})
+	}
+	for output := range b.TokenScopedTemplates {
+		add(StatusEntry{Kind: "template", Name: output, Detail: "token"})
+	}
+	for output, versions := range b.VersionScopedTemplates {
+		add(StatusEntry{Kind: "template", Name: output, Detail: versionsDetail(versions)})
+	}
+
+	for location := range b.StaticScopedSecrets {
+		add(StatusEntry{Kind: "secret", Name: location, Detail: "static"})
+	}
+	for location := range b.TokenScopedSecrets {
+		add(StatusEntry{Kind: "secret", Name: location, Detail: "token"})
+	}
+	for location, version := range b.VersionScopedSecrets {
+		add(StatusEntry{Kind: "secret", Name: location, Detail: fmt.Sprintf("version %d", version)})
+	}
+
+	for filename := range b.StaticScopedComposites {
+		add(StatusEntry{Kind: "composite", Name: filename, Detail: "static"})
+	}
+	for filename := range b.TokenScopedComposites {
+		add(StatusEntry{Kind: "composite", Name: filename, Detail: "token"})
+	}
+	for filename, versions := range b.VersionScopedComposites {
+		add(StatusEntry{Kind: "composite", Name: filename, Detail: versionsDetail(versions)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Detail < entries[j].Detail
+	})
+
+	return entries
+}
+
+func leaseStatus(kind, name string, l lease) StatusEntry {
+	detail := "renewable"
+	if !l.Renewable {
+		detail = "not renewable"
+	}
+	status := StatusEntry{Kind: kind, Name: name}
+	// Vault gives a lease duration of zero to secrets that don't expire.
+	if l.LeaseDuration == 0 {
+		detail += ", never expires"
+	} else {
+		status.Expiry = timePtr(l.Expiry)
+		status.NextRefresh = timePtr(l.NextRenewal)
+	}
+	status.Detail = detail
+	return status
+}
+
+// versionsDetail describes the versions of the secrets something with a lifetime of "version" was written with.
+func versionsDetail(versions map[string]int64) string {
+	var locations []string
+	for location := range versions {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+
+	var detail []string
+	for _, location := range locations {
+		detail = append(detail, fmt.Sprintf("%s@%d", location, versions[location]))
+	}
+	return "version " + strings.Join(detail, ", ")
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
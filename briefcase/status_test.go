@@ -0,0 +1,88 @@
+package briefcase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/stretchr/testify/assert"
+	testing2 "k8s.io/utils/clock/testing"
+)
+
+func TestStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeClock := testing2.NewFakeClock(testTime)
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	bc := NewBriefcase(nil)
+	bc.AuthTokenLease = LeasedAuthToken{
+		Accessor:    "accessor",
+		Token:       "token",
+		Renewable:   true,
+		ExpiresAt:   testTime.Add(time.Hour),
+		NextRefresh: testTime.Add(20 * time.Minute),
+	}
+	bc.EnrollAWSCredential(ctx, &api.Secret{LeaseDuration: 300}, config.AWSType{OutputPath: "/aws", Profile: "default"}, 0)
+	bc.EnrollDatabaseCredential(ctx, &api.Secret{LeaseID: "database/creds/role/1", LeaseDuration: 60}, config.DatabaseType{Key: "db"})
+	bc.EnrollTemplate(config.TemplateType{Output: "/out/template", Lifetime: util.LifetimeStatic})
+	bc.VersionScopedSecrets["path/to/secret"] = 3
+
+	fakeClock.Step(2 * time.Minute)
+
+	entries := bc.Status(ctx, fakeClock.Now().Add(10*time.Minute))
+
+	if assert.Len(entries, 5) {
+		assert.Equal("auth", entries[0].Kind)
+		assert.Equal("default", entries[0].Name)
+		assert.Equal(StatusOK, entries[0].State)
+		assert.NotContains(entries[0].Detail, "token", "the vault token must never be shown")
+
+		assert.Equal("aws", entries[1].Kind)
+		assert.Equal(StatusExpiring, entries[1].State, "expires before the next renewal")
+
+		assert.Equal("database", entries[2].Kind)
+		assert.Equal(StatusExpired, entries[2].State)
+
+		assert.Equal("secret", entries[3].Kind)
+		assert.Equal("version 3", entries[3].Detail)
+		assert.Equal(StatusOK, entries[3].State)
+
+		assert.Equal("template", entries[4].Kind)
+		assert.Equal("/out/template", entries[4].Name)
+		assert.Nil(entries[4].Expiry)
+	}
+}
+
+func TestStatusOfWhatNeverExpires(t *testing.T) {
+	assert := assert.New(t)
+
+	fakeClock := testing2.NewFakeClock(testTime)
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	// A root token, such as one given with --vault-token, has a TTL of zero.
+	token := myToken(t)
+	token.Data["ttl"] = 0
+
+	bc := NewBriefcase(nil)
+	assert.NoError(bc.EnrollVaultToken(ctx, util.NewWrappedToken(&token, false)))
+	bc.EnrollDynamicSecret(ctx, &api.Secret{LeaseDuration: 0}, config.DynamicType{Key: "static"})
+
+	fakeClock.Step(24 * time.Hour)
+
+	assert.False(bc.ShouldRefreshVaultToken(ctx), "a token that never expires never needs refreshing")
+
+	entries := bc.Status(ctx, fakeClock.Now().Add(10*time.Minute))
+
+	if assert.Len(entries, 2) {
+		for _, entry := range entries {
+			assert.Equal(StatusOK, entry.State)
+			assert.Nil(entry.Expiry)
+			assert.Contains(entry.Detail, "never expires")
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 )
 
+// ShouldRefreshTemplate returns true if the template hasn't been written, or its output was removed or changed since.
 func (b *Briefcase) ShouldRefreshTemplate(tmpl config.TemplateType) bool {
 	var exists bool
 
@@ -14,7 +15,7 @@ func (b *Briefcase) ShouldRefreshTemplate(tmpl config.TemplateType) bool {
 		_, exists = b.StaticTemplates[tmpl.Output]
 	}
 
-	return !exists
+	return !exists || b.outputsDrifted(tmpl.Output)
 }
 
 func (b *Briefcase) EnrollTemplate(tmpl config.TemplateType) {
@@ -26,4 +27,21 @@ func (b *Briefcase) EnrollTemplate(tmpl config.TemplateType) {
 	} else {
 		b.StaticTemplates[tmpl.Output] = true
 	}
+	b.enrollOutputs(tmpl.Output)
+}
+
+// TemplateVersions returns the versions of the secrets a template with a lifetime of "version" was last written
+// with, keyed by where they are in Vault. It returns false if the template hasn't been written, or its output was
+// removed or changed since.
+func (b *Briefcase) TemplateVersions(tmpl config.TemplateType) (map[string]int64, bool) {
+	versions, exists := b.VersionScopedTemplates[tmpl.Output]
+	return versions, exists && !b.outputsDrifted(tmpl.Output)
+}
+
+// EnrollVersionedTemplate records the versions of the secrets a template with a lifetime of "version" was written with.
+func (b *Briefcase) EnrollVersionedTemplate(tmpl config.TemplateType, versions map[string]int64) {
+	b.log.Info().Str("outputFile", tmpl.Output).Interface("versions", versions).Msg("enrolling versioned template")
+
+	b.VersionScopedTemplates[tmpl.Output] = versions
+	b.enrollOutputs(tmpl.Output)
 }
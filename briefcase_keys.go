@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
+	"github.com/hootsuite/vault-ctrl-tool/v2/syncer"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// briefcaseKeys returns where the keys to encrypt the briefcase with come from, or nil if it isn't encrypted. It is
+// made once per run and passed to every sync. A transit key uses vaultClient, which must be the client the syncer
+// uses, so it works with the syncer's token rather than one of its own.
+func briefcaseKeys(flags util.CliFlags, vaultClient vaultclient.VaultClient, mtrics *metrics.Metrics) (briefcase.KeySource, error) {
+	switch {
+	case flags.BriefcaseKeyFile != "":
+		key, err := ioutil.ReadFile(flags.BriefcaseKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read briefcase key file %q: %w", flags.BriefcaseKeyFile, err)
+		}
+		return briefcase.NewStaticKey("file "+flags.BriefcaseKeyFile, string(key))
+	case flags.BriefcaseKeyEnv != "":
+		key, ok := os.LookupEnv(flags.BriefcaseKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("briefcase key environment variable %q is not set", flags.BriefcaseKeyEnv)
+		}
+		return briefcase.NewStaticKey("environment variable "+flags.BriefcaseKeyEnv, key)
+	case flags.BriefcaseTransitKey != "":
+		transit := &transitClient{flags: flags, vaultClient: vaultClient, metrics: mtrics}
+		return briefcase.NewTransitKey(transit, flags.BriefcaseTransitMount, flags.BriefcaseTransitKey), nil
+	}
+
+	return nil, nil
+}
+
+// transitClient uses Vault's transit secrets engine for briefcase keys, through the syncer's Vault client. The
+// briefcase is saved once the syncer has set its token on the client, but it is read before then, as the token is
+// kept inside it. Until then, the token given with --vault-token (or VAULT_TOKEN) is used, or else it logs in just
+// for that request and revokes the token afterwards, so it doesn't outlive the briefcase being read.
+type transitClient struct {
+	flags       util.CliFlags
+	vaultClient vaultclient.VaultClient
+	metrics     *metrics.Metrics
+}
+
+// withToken runs request with a token on the syncer's client, logging in first if there isn't one yet.
+func (tc *transitClient) withToken(request func(vaultclient.VaultClient) error) error {
+	if tc.vaultClient.Delegate().Token() != "" {
+		return request(tc.vaultClient)
+	}
+
+	if tc.flags.VaultTokenArg != "" {
+		tc.vaultClient.SetToken(tc.flags.VaultTokenArg)
+		return request(tc.vaultClient)
+	}
+
+	zlog.Info().Msg("authenticating to use the briefcase transit key")
+	secret, err := syncer.Authenticate(tc.vaultClient, tc.flags, tc.metrics)
+	if err != nil {
+		return fmt.Errorf("could not authenticate to use the briefcase transit key: %w", err)
+	}
+	token, err := secret.TokenID()
+	if err != nil {
+		return err
+	}
+
+	tc.vaultClient.SetToken(token)
+	defer func() {
+		if err := tc.vaultClient.Delegate().Auth().Token().RevokeSelf(""); err != nil {
+			zlog.Warn().Err(err).Msg("could not revoke the token used for the briefcase transit key")
+		}
+		// The syncer finds its own token, starting from the one in the briefcase.
+		tc.vaultClient.SetToken("")
+	}()
+
+	return request(tc.vaultClient)
+}
+
+func (tc *transitClient) TransitDataKey(mount, name string) ([]byte, string, error) {
+	var plaintext []byte
+	var ciphertext string
+	err := tc.withToken(func(vaultClient vaultclient.VaultClient) error {
+		var err error
+		plaintext, ciphertext, err = vaultClient.TransitDataKey(mount, name)
+		return err
+	})
+	return plaintext, ciphertext, err
+}
+
+func (tc *transitClient) TransitDecrypt(mount, name string, ciphertext string) ([]byte, error) {
+	var plaintext []byte
+	err := tc.withToken(func(vaultClient vaultclient.VaultClient) error {
+		var err error
+		plaintext, err = vaultClient.TransitDecrypt(mount, name, ciphertext)
+		return err
+	})
+	return plaintext, err
+}
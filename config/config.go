@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/rs/zerolog"
@@ -15,10 +18,72 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+var environmentNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // VaultTokenType for writing the contents of a VAULT_TOKEN to the specified file with the specified mode.
 type VaultTokenType struct {
 	Output string `yaml:"output"`
 	Mode   string `yaml:"mode"`
+	Owner  string `yaml:"owner,omitempty"`
+	Group  string `yaml:"group,omitempty"`
+}
+
+// DefaultOnChangeTimeout is how long an onChange command may run, if not configured.
+const DefaultOnChangeTimeout = 30 * time.Second
+
+// OnChangeType is a hook run once a sync has written all its files, if any outputs of the stanza it belongs to were
+// written. Either "command" is run (and killed if it takes longer than "timeout"), or "signal" is sent to the
+// process whose PID is in "pidFile". Stanzas sharing an identical hook only run it once per sync.
+type OnChangeType struct {
+	Command []string `yaml:"command,omitempty"`
+	Timeout string   `yaml:"timeout,omitempty"`
+	Signal  string   `yaml:"signal,omitempty"`
+	PIDFile string   `yaml:"pidFile,omitempty"`
+}
+
+// TimeoutDuration is how long the command may run for.
+func (hook OnChangeType) TimeoutDuration() time.Duration {
+	if timeout, err := time.ParseDuration(hook.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return DefaultOnChangeTimeout
+}
+
+// prepare validates the hook and makes its pid file absolute.
+func (hook *OnChangeType) prepare(inputPrefix string) error {
+	if hook == nil {
+		return nil
+	}
+
+	if (len(hook.Command) > 0) == (hook.Signal != "") {
+		return errors.New("onChange needs exactly one of a 'command' or a 'signal'")
+	}
+
+	if hook.Timeout != "" {
+		if len(hook.Command) == 0 {
+			return errors.New("onChange 'timeout' is only used with a 'command'")
+		}
+		if timeout, err := time.ParseDuration(hook.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("onChange has an invalid 'timeout' %q", hook.Timeout)
+		}
+	}
+
+	if hook.Signal != "" {
+		if _, err := util.ParseSignal(hook.Signal); err != nil {
+			return fmt.Errorf("onChange - %w", err)
+		}
+		if hook.PIDFile == "" {
+			return errors.New("onChange with a 'signal' needs a 'pidFile'")
+		}
+	} else if hook.PIDFile != "" {
+		return errors.New("onChange 'pidFile' is only used with a 'signal'")
+	}
+
+	if hook.PIDFile != "" {
+		hook.PIDFile = util.AbsolutePath(inputPrefix, hook.PIDFile)
+	}
+
+	return nil
 }
 
 // TemplateType for turning Go template files into files with secrets in them.
@@ -26,11 +91,15 @@ type TemplateType struct {
 	Input    string              `yaml:"input"`
 	Output   string              `yaml:"output"`
 	Mode     string              `yaml:"mode"`
+	Owner    string              `yaml:"owner,omitempty"`
+	Group    string              `yaml:"group,omitempty"`
 	Lifetime util.SecretLifetime `yaml:"lifetime,omitempty"`
+	OnChange *OnChangeType       `yaml:"onChange,omitempty"`
 }
 
 // SecretType for reading from Vault's KV store and writing contents out to various places. The "output" field
-// will write everything out as JSON. If "missingOk" is true, then missing secrets path will simply be logged.
+// will write everything out as JSON, or in "format" if set. If "missingOk" is true, then missing secrets path will
+// simply be logged.
 type SecretType struct {
 	Key            string              `yaml:"key"`
 	UseKeyAsPrefix bool                `yaml:"use_key_as_prefix"`
@@ -38,10 +107,45 @@ type SecretType struct {
 	Fields         []SecretFieldType   `yaml:"fields"`
 	TouchFile      string              `yaml:"touchfile"`
 	Output         string              `yaml:"output"`
+	Format         string              `yaml:"format,omitempty"`
 	Lifetime       util.SecretLifetime `yaml:"lifetime"`
 	Mode           string              `yaml:"mode"`
+	Owner          string              `yaml:"owner,omitempty"`
+	Group          string              `yaml:"group,omitempty"`
 	IsMissingOk    bool                `yaml:"missingOk"`
 	PinnedVersion  *int                `yaml:"pinnedVersion,omitempty"`
+	Namespace      string              `yaml:"namespace,omitempty"`
+	Vault          string              `yaml:"vault,omitempty"`
+	OnChange       *OnChangeType       `yaml:"onChange,omitempty"`
+
+	// MinVersionAge is how old a new version of a secret with a lifetime of "version" must be before it is written
+	// out. MaxVersionsBehind writes a new version regardless of its age once the outputs are that many versions
+	// behind Vault.
+	MinVersionAge     string `yaml:"minVersionAge,omitempty"`
+	MaxVersionsBehind int    `yaml:"maxVersionsBehind,omitempty"`
+}
+
+// MinVersionAgeDuration is how old a new version of the secret must be before it is written out, or defaultAge if
+// the secret doesn't set one.
+func (secretType SecretType) MinVersionAgeDuration(defaultAge time.Duration) time.Duration {
+	if age, err := time.ParseDuration(secretType.MinVersionAge); err == nil && age >= 0 {
+		return age
+	}
+	return defaultAge
+}
+
+// VaultLocation identifies where in Vault the secret is read from. It is the path, prefixed with the namespace
+// and the Vault connection when they are set, so secrets with the same path in different namespaces or on
+// different Vault servers are tracked separately.
+func (secretType SecretType) VaultLocation() string {
+	location := secretType.Path
+	if secretType.Namespace != "" {
+		location = secretType.Namespace + ":" + location
+	}
+	if secretType.Vault != "" {
+		location = secretType.Vault + "@" + location
+	}
+	return location
 }
 
 // NeedsMetadata determines if the tool needs metadata from Vault in order to correctly process the secret. This will
@@ -59,29 +163,176 @@ func (secretType *SecretType) NeedsMetadata() bool {
 }
 
 // SecretFieldType is used to just output the contents of specific fields to specific files. Their mode will
-// be the same as "mode" in the SecretType they belong.
+// be the same as "mode" in the SecretType they belong. Their owner and group are those of the SecretType, unless
+// set on the field.
 type SecretFieldType struct {
 	Name     string `yaml:"name"`
 	Output   string `yaml:"output"`
 	Encoding string `yaml:"encoding"`
+	Owner    string `yaml:"owner,omitempty"`
+	Group    string `yaml:"group,omitempty"`
+}
+
+// FileOwner is the owner and group of the field's output, falling back to those of the secret it belongs to.
+func (field SecretFieldType) FileOwner(secret SecretType) (string, string) {
+	owner, group := field.Owner, field.Group
+	if owner == "" {
+		owner = secret.Owner
+	}
+	if group == "" {
+		group = secret.Group
+	}
+	return owner, group
 }
 
 // SSHCertificateType for SSH certificate signing. This tool will write private, public, and certificate files to the
 // specified OutputPath, asking the public key to be signed for the specified role at the specified mount point in Vault.
 type SSHCertificateType struct {
-	VaultMount string `yaml:"vaultMountPoint"`
-	VaultRole  string `yaml:"vaultRole"`
-	OutputPath string `yaml:"outputPath"`
+	VaultMount string        `yaml:"vaultMountPoint"`
+	VaultRole  string        `yaml:"vaultRole"`
+	OutputPath string        `yaml:"outputPath"`
+	Owner      string        `yaml:"owner,omitempty"`
+	Group      string        `yaml:"group,omitempty"`
+	Namespace  string        `yaml:"namespace,omitempty"`
+	Vault      string        `yaml:"vault,omitempty"`
+	OnChange   *OnChangeType `yaml:"onChange,omitempty"`
+}
+
+// Dynamic secrets are fetched by reading from, or writing to, their path.
+const DynamicMethodRead = "read"
+const DynamicMethodWrite = "write"
+
+// DynamicType for any Vault path that returns a leased secret, such as credentials from the RabbitMQ, Consul or
+// Nomad secrets engines. The secret is fetched with a read, or a write of "data" if the method is "write". Its
+// fields can be written out with "fields", all of them can be written as JSON to "output", and they are
+// available to templates with a lifetime of "token" as <key>_<field>. The lease is renewed for as long as Vault
+// allows, after which the secret is fetched again and the outputs are rewritten.
+type DynamicType struct {
+	Key       string            `yaml:"key"`
+	Path      string            `yaml:"path"`
+	Method    string            `yaml:"method,omitempty"`
+	Data      map[string]string `yaml:"data,omitempty"`
+	Fields    []SecretFieldType `yaml:"fields"`
+	Output    string            `yaml:"output"`
+	Mode      string            `yaml:"mode"`
+	Owner     string            `yaml:"owner,omitempty"`
+	Group     string            `yaml:"group,omitempty"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Vault     string            `yaml:"vault,omitempty"`
+	OnChange  *OnChangeType     `yaml:"onChange,omitempty"`
+}
+
+// DefaultPKIReissueFraction is how far through its lifetime a PKI certificate is reissued, if not configured.
+const DefaultPKIReissueFraction = 2.0 / 3.0
+
+// PKICertificateType for X.509 certificates issued by Vault's PKI secrets engine. The certificate, private key, CA
+// chain and issuing CA are written to the specified OutputPath. Certificates are reissued once "reissueFraction"
+// of their lifetime has passed.
+type PKICertificateType struct {
+	VaultMountPoint string        `yaml:"vaultMountPoint"`
+	VaultRole       string        `yaml:"vaultRole"`
+	CommonName      string        `yaml:"commonName"`
+	AltNames        []string      `yaml:"altNames,omitempty"`
+	IPSans          []string      `yaml:"ipSans,omitempty"`
+	TTL             string        `yaml:"ttl,omitempty"`
+	ReissueFraction float64       `yaml:"reissueFraction,omitempty"`
+	OutputPath      string        `yaml:"outputPath"`
+	Mode            string        `yaml:"mode"`
+	Owner           string        `yaml:"owner,omitempty"`
+	Group           string        `yaml:"group,omitempty"`
+	Namespace       string        `yaml:"namespace,omitempty"`
+	Vault           string        `yaml:"vault,omitempty"`
+	OnChange        *OnChangeType `yaml:"onChange,omitempty"`
 }
 
 // AWSType for AWS credentials obtained by Vault performing sts:AssumeRole on your behalf.
 type AWSType struct {
-	VaultMountPoint string `yaml:"vaultMountPoint"`
-	VaultRole       string `yaml:"vaultRole"`
-	Profile         string `yaml:"awsProfile"`
-	Region          string `yaml:"awsRegion"`
-	OutputPath      string `yaml:"outputPath"`
-	Mode            string `yaml:"mode"`
+	VaultMountPoint string        `yaml:"vaultMountPoint"`
+	VaultRole       string        `yaml:"vaultRole"`
+	Profile         string        `yaml:"awsProfile"`
+	Region          string        `yaml:"awsRegion"`
+	OutputPath      string        `yaml:"outputPath"`
+	Mode            string        `yaml:"mode"`
+	Owner           string        `yaml:"owner,omitempty"`
+	Group           string        `yaml:"group,omitempty"`
+	Namespace       string        `yaml:"namespace,omitempty"`
+	Vault           string        `yaml:"vault,omitempty"`
+	OnChange        *OnChangeType `yaml:"onChange,omitempty"`
+}
+
+// DatabaseType for dynamic database credentials issued by Vault's database secrets engine. The "username" and
+// "password" of the credential can be written out with "fields", and are available to templates with a lifetime of
+// "token" as <key>_username and <key>_password. The lease is renewed for as long as Vault allows, after which a new
+// credential is issued and the outputs are rewritten.
+type DatabaseType struct {
+	Key             string            `yaml:"key"`
+	VaultMountPoint string            `yaml:"vaultMountPoint"`
+	VaultRole       string            `yaml:"vaultRole"`
+	Fields          []SecretFieldType `yaml:"fields"`
+	Mode            string            `yaml:"mode"`
+	Owner           string            `yaml:"owner,omitempty"`
+	Group           string            `yaml:"group,omitempty"`
+	Namespace       string            `yaml:"namespace,omitempty"`
+	Vault           string            `yaml:"vault,omitempty"`
+	OnChange        *OnChangeType     `yaml:"onChange,omitempty"`
+}
+
+// ExecType configures the command run with --exec. The fields listed in "environment" are injected into its
+// environment. Running processes cannot have their environment changed, so when an injected value changes the
+// command is restarted, unless "signal" is set, in which case it is sent that signal instead (for applications
+// that also read the secrets from files the tool writes).
+type ExecType struct {
+	Environment []EnvironmentType `yaml:"environment"`
+	Signal      string            `yaml:"signal,omitempty"`
+}
+
+// EnvironmentType injects one field of a secret, database credential or dynamic secret, identified by its key,
+// into the environment of the command run with --exec as the variable "name".
+type EnvironmentType struct {
+	Name     string `yaml:"name"`
+	Key      string `yaml:"key"`
+	Field    string `yaml:"field"`
+	Encoding string `yaml:"encoding"`
+}
+
+// VaultConnectionType describes an additional Vault server. Stanzas read from it by setting "vault" to its name,
+// otherwise they use the Vault server given by VAULT_ADDR. Each connection authenticates separately, using the
+// mechanisms listed in "auth" (or the ones chosen on the command line) and, if set, "authRole" as the role name.
+type VaultConnectionType struct {
+	Name      string   `yaml:"name"`
+	Address   string   `yaml:"address"`
+	CACert    string   `yaml:"caCert,omitempty"`
+	Namespace string   `yaml:"namespace,omitempty"`
+	Auth      []string `yaml:"auth,omitempty"`
+	AuthRole  string   `yaml:"authRole,omitempty"`
+}
+
+// AuthFlags returns a copy of the command line flags adjusted to authenticate against this connection. The
+// command line Vault token is never used, as it belongs to the default Vault server.
+func (conn VaultConnectionType) AuthFlags(flags util.CliFlags) util.CliFlags {
+	flags.VaultTokenArg = ""
+
+	if len(conn.Auth) > 0 {
+		flags.AuthChain = conn.Auth
+	}
+
+	// Without a role of its own, the connection uses the roles given on the command line.
+	if conn.AuthRole == "" {
+		return flags
+	}
+
+	chained := len(flags.AuthChain) > 0
+	// Only replace roles of mechanisms already in use, as setting a role is how some mechanisms are selected.
+	if chained || flags.KubernetesAuthRole != "" {
+		flags.KubernetesAuthRole = conn.AuthRole
+	}
+	if chained || flags.IAMAuthRole != "" {
+		flags.IAMAuthRole = conn.AuthRole
+	}
+	flags.JWTAuthRole = conn.AuthRole
+	flags.CertAuthRole = conn.AuthRole
+
+	return flags
 }
 
 // VaultConfig is used to set up the tool and fetch all the appropriate secrets.
@@ -89,12 +340,17 @@ type VaultConfig struct {
 	// v0 or v1: Default prefix for Secrets is /secret/application-config/services/
 	// v2: Default prefix for Secrets is /kv/data/application-config/services/
 	// v3: v2 plus requires "lifetime" values for secrets and templates
-	ConfigVersion   int                  `yaml:"version"`
-	VaultToken      VaultTokenType       `yaml:"vaultToken"`
-	Templates       []TemplateType       `yaml:"templates"`
-	Secrets         []SecretType         `yaml:"secrets"`
-	SSHCertificates []SSHCertificateType `yaml:"sshCertificates"`
-	AWS             []AWSType            `yaml:"aws"`
+	ConfigVersion   int                   `yaml:"version"`
+	VaultToken      VaultTokenType        `yaml:"vaultToken"`
+	Templates       []TemplateType        `yaml:"templates"`
+	Secrets         []SecretType          `yaml:"secrets"`
+	SSHCertificates []SSHCertificateType  `yaml:"sshCertificates"`
+	AWS             []AWSType             `yaml:"aws"`
+	Databases       []DatabaseType        `yaml:"databases"`
+	PKICertificates []PKICertificateType  `yaml:"pkiCertificates"`
+	Dynamic         []DynamicType         `yaml:"dynamic"`
+	Connections     []VaultConnectionType `yaml:"connections"`
+	Exec            ExecType              `yaml:"exec"`
 
 	log zerolog.Logger
 }
@@ -102,6 +358,8 @@ type VaultConfig struct {
 type CompositeSecretFile struct {
 	Filename string
 	Mode     os.FileMode
+	Owner    util.FileOwner
+	Format   string
 	Lifetime util.SecretLifetime // if one secret is token-scoped, then the whole file becomes token scoped.
 	Secrets  []SecretType
 }
@@ -112,7 +370,23 @@ type ControlToolConfig struct {
 	Composites  map[string]*CompositeSecretFile
 }
 
+// Connection returns the named Vault connection, if it is configured.
+func (cfg VaultConfig) Connection(name string) (VaultConnectionType, bool) {
+	for _, conn := range cfg.Connections {
+		if conn.Name == name {
+			return conn, true
+		}
+	}
+	return VaultConnectionType{}, false
+}
+
 func ReadConfig(log zerolog.Logger, config []byte, inputPrefix, outputPrefix string) (*ControlToolConfig, error) {
+	return readConfig(log, config, inputPrefix, outputPrefix, true)
+}
+
+// readConfig parses a single configuration file. Files from a config directory skip checking their "vault" and
+// environment references, as what they refer to may be defined in another config file.
+func readConfig(log zerolog.Logger, config []byte, inputPrefix, outputPrefix string, checkConnections bool) (*ControlToolConfig, error) {
 
 	var current VaultConfig
 
@@ -124,6 +398,11 @@ func ReadConfig(log zerolog.Logger, config []byte, inputPrefix, outputPrefix str
 	current.log = log
 	errs := current.prepareConfig(inputPrefix, outputPrefix)
 
+	if checkConnections {
+		errs = append(errs, current.checkConnectionReferences()...)
+		errs = append(errs, current.checkEnvironmentReferences()...)
+	}
+
 	if len(errs) > 0 {
 		for _, err := range errs {
 			log.Error().Err(err).Msg("issue with config")
@@ -167,7 +446,7 @@ func ReadConfigFile(configFile string, configDir string, inputPrefix, outputPref
 		return nil, fmt.Errorf("trouble reading config file %q: %w", absConfigFile, err)
 	}
 
-	config, err := ReadConfig(log, yamlFile, inputPrefix, outputPrefix)
+	config, err := readConfig(log, yamlFile, inputPrefix, outputPrefix, configDir == "")
 
 	if err != nil {
 		log.Error().Err(err).Msg("could not parse config file")
@@ -198,11 +477,19 @@ func ReadConfigFile(configFile string, configDir string, inputPrefix, outputPref
 						return nil, fmt.Errorf("trouble reading config file %q: %w", currentConfigFile, err)
 					}
 
-					currentConfig, err := ReadConfig(log, yamlFile, inputPrefix, outputPrefix)
+					currentConfig, err := readConfig(log, yamlFile, inputPrefix, outputPrefix, false)
+					if err != nil {
+						log.Error().Err(err).Msg("could not parse config file")
+						return nil, fmt.Errorf("could not parse config file %q: %w", currentConfigFile, err)
+					}
 					config.VaultConfig.Secrets = append(config.VaultConfig.Secrets, currentConfig.VaultConfig.Secrets...)
 					config.VaultConfig.Templates = append(config.VaultConfig.Templates, currentConfig.VaultConfig.Templates...)
 					config.VaultConfig.SSHCertificates = append(config.VaultConfig.SSHCertificates, currentConfig.VaultConfig.SSHCertificates...)
 					config.VaultConfig.AWS = append(config.VaultConfig.AWS, currentConfig.VaultConfig.AWS...)
+					config.VaultConfig.Databases = append(config.VaultConfig.Databases, currentConfig.VaultConfig.Databases...)
+					config.VaultConfig.PKICertificates = append(config.VaultConfig.PKICertificates, currentConfig.VaultConfig.PKICertificates...)
+					config.VaultConfig.Dynamic = append(config.VaultConfig.Dynamic, currentConfig.VaultConfig.Dynamic...)
+					config.VaultConfig.Exec.Environment = append(config.VaultConfig.Exec.Environment, currentConfig.VaultConfig.Exec.Environment...)
 					for k, v := range currentConfig.Templates {
 						config.Templates[k] = v
 					}
@@ -212,12 +499,21 @@ func ReadConfigFile(configFile string, configDir string, inputPrefix, outputPref
 				}
 			}
 		}
+
+		errs := config.VaultConfig.checkConnectionReferences()
+		errs = append(errs, config.VaultConfig.checkEnvironmentReferences()...)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Error().Err(err).Msg("issue with config")
+			}
+			return nil, fmt.Errorf("%d error(s) processing config", len(errs))
+		}
 	}
 	return config, err
 }
 
 // createCompositeSecrets brings an obscure feature of v1 where multiple secret stanzas could
-// be combined into one JSON secrets file, using the first secret for file mode.
+// be combined into one JSON secrets file, using the first secret for file mode and owner.
 func (cfg *VaultConfig) createCompositeSecrets() (map[string]*CompositeSecretFile, error) {
 	composites := make(map[string]*CompositeSecretFile)
 
@@ -226,17 +522,39 @@ func (cfg *VaultConfig) createCompositeSecrets() (map[string]*CompositeSecretFil
 			if file, ok := composites[secret.Output]; ok {
 				file.Secrets = append(file.Secrets, secret)
 
+				if secret.Format != file.Format {
+					return nil, fmt.Errorf("secret %q - format %q of %q differs from format %q of the other secrets written to it",
+						secret.Key, secret.Format, secret.Output, file.Format)
+				}
+
 				if secret.Lifetime == util.LifetimeToken && file.Lifetime == util.LifetimeStatic {
 					secret.Lifetime = util.LifetimeToken
 				}
+
+				// A composite with any versioned secret is rewritten when one of them gets a new version.
+				if secret.Lifetime == util.LifetimeVersion || file.Lifetime == util.LifetimeVersion {
+					for _, s := range file.Secrets {
+						if s.Lifetime == util.LifetimeToken {
+							return nil, fmt.Errorf("secret %q - output %q mixes secrets with lifetimes of %q and %q",
+								secret.Key, secret.Output, util.LifetimeToken, util.LifetimeVersion)
+						}
+					}
+					file.Lifetime = util.LifetimeVersion
+				}
 			} else {
 				mode, err := util.StringToFileMode(secret.Mode)
 				if err != nil {
 					return nil, err
 				}
+				owner, err := util.LookupFileOwner(secret.Owner, secret.Group)
+				if err != nil {
+					return nil, err
+				}
 				composites[secret.Output] = &CompositeSecretFile{
 					Filename: secret.Output,
 					Mode:     *mode,
+					Owner:    *owner,
+					Format:   secret.Format,
 					Lifetime: secret.Lifetime,
 					Secrets:  []SecretType{secret},
 				}
@@ -260,33 +578,31 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 		cfg.VaultToken.Output = util.AbsolutePath(outputPrefix, cfg.VaultToken.Output)
 	}
 
+	if _, err := util.LookupFileOwner(cfg.VaultToken.Owner, cfg.VaultToken.Group); err != nil {
+		errs = append(errs, fmt.Errorf("vault token - %w", err))
+	}
+
 	// Go through the template config and clean it up..
 	var tidyTpls []TemplateType
 
-	for _, tpl := range cfg.Templates {
+	for i, tpl := range cfg.Templates {
 
 		if tpl.Input == "" {
-			errs = append(errs, fmt.Errorf("there is a template stanza missing a input file in the configuration file ('input')"))
+			errs = append(errs, stanzaError("templates", i, fmt.Errorf("there is a template stanza missing a input file in the configuration file ('input')")))
 		} else {
 			tpl.Input = util.AbsolutePath(inputPrefix, tpl.Input)
 		}
 
 		if tpl.Lifetime != "" && cfg.ConfigVersion < 3 {
-			errs = append(errs, fmt.Errorf("template %q - lifetime is only supported when config version is at least 3", tpl.Input))
+			errs = append(errs, stanzaError("templates", i, fmt.Errorf("template %q - lifetime is only supported when config version is at least 3", tpl.Input)))
 		}
 
 		if tpl.Lifetime == "" && cfg.ConfigVersion < 3 {
 			tpl.Lifetime = util.LifetimeStatic
 		}
 
-		if tpl.Lifetime == util.LifetimeVersion {
-			// If you're seeing this, it's not because it isn't valuable - it surely is - but it's more work than I want
-			// to tackle right now.
-			errs = append(errs, fmt.Errorf("template %q - templates do not support %q lifetime", tpl.Input, util.LifetimeVersion))
-		}
-
-		if tpl.Lifetime != util.LifetimeStatic && tpl.Lifetime != util.LifetimeToken {
-			errs = append(errs, fmt.Errorf("template %q - template is missing a lifetime attribute", tpl.Input))
+		if tpl.Lifetime != util.LifetimeStatic && tpl.Lifetime != util.LifetimeToken && tpl.Lifetime != util.LifetimeVersion {
+			errs = append(errs, stanzaError("templates", i, fmt.Errorf("template %q - template is missing a lifetime attribute", tpl.Input)))
 		}
 
 		if tpl.Output == "" {
@@ -294,6 +610,14 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 		} else {
 			tpl.Output = util.AbsolutePath(outputPrefix, tpl.Output)
 		}
+
+		if _, err := util.LookupFileOwner(tpl.Owner, tpl.Group); err != nil {
+			errs = append(errs, stanzaError("templates", i, fmt.Errorf("template %q - %w", tpl.Input, err)))
+		}
+
+		if err := tpl.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("templates", i, fmt.Errorf("template %q - %w", tpl.Input, err)))
+		}
 		tidyTpls = append(tidyTpls, tpl)
 	}
 
@@ -302,20 +626,20 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 	// Go through the secrets config and clean it up...
 	var tidySecrets []SecretType
 
-	for _, secret := range cfg.Secrets {
+	for i, secret := range cfg.Secrets {
 
 		if secret.Key == "" {
-			errs = append(errs, fmt.Errorf("there is a secret stanza missing a 'key' value in the configuration file"))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("there is a secret stanza missing a 'key' value in the configuration file")))
 			continue
 		}
 
 		if secret.Path == "" {
-			errs = append(errs, fmt.Errorf("secret %q - no Vault path specified for secret in configuration file", secret.Key))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - no Vault path specified for secret in configuration file", secret.Key)))
 			continue
 		}
 
 		if secret.Lifetime != "" && cfg.ConfigVersion < 3 {
-			errs = append(errs, fmt.Errorf("secret %q - uses a lifetime, but config version is less than 3", secret.Key))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - uses a lifetime, but config version is less than 3", secret.Key)))
 		}
 
 		if secret.Lifetime == "" && cfg.ConfigVersion < 3 {
@@ -323,54 +647,96 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 		}
 
 		if secret.Lifetime != util.LifetimeStatic && secret.Lifetime != util.LifetimeToken && secret.Lifetime != util.LifetimeVersion {
-			errs = append(errs, fmt.Errorf("secret %q - secret is missing a lifetime attribute", secret.Key))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - secret is missing a lifetime attribute", secret.Key)))
 		}
 
 		var tidyFields []SecretFieldType
 		for _, field := range secret.Fields {
 			if field.Name == "" {
-				errs = append(errs, fmt.Errorf("secret %q - there is a field in this secret missing 'name' value in the configuration file", secret.Key))
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - there is a field in this secret missing 'name' value in the configuration file", secret.Key)))
 			}
 
 			field.Encoding = strings.ToLower(field.Encoding)
 			if field.Encoding != "" && field.Encoding != util.EncodingBase64 && field.Encoding != util.EncodingNone {
-				errs = append(errs, fmt.Errorf("secret %q - field %q - encoding %q - if specified, encoding must be %q or %q",
-					secret.Key, field.Name, field.Encoding, util.EncodingBase64, util.EncodingNone))
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - field %q - encoding %q - if specified, encoding must be %q or %q",
+					secret.Key, field.Name, field.Encoding, util.EncodingBase64, util.EncodingNone)))
 			}
 			if field.Output == "" {
-				errs = append(errs, fmt.Errorf("secret %q - field - %q - this field is missing an 'output'",
-					secret.Key, field.Name))
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - field - %q - this field is missing an 'output'",
+					secret.Key, field.Name)))
 			} else {
 				field.Output = util.AbsolutePath(outputPrefix, field.Output)
 			}
+			if _, err := util.LookupFileOwner(field.Owner, field.Group); err != nil {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - field %q - %w", secret.Key, field.Name, err)))
+			}
 			tidyFields = append(tidyFields, field)
 		}
 
 		secret.Fields = tidyFields
 
+		if _, err := util.LookupFileOwner(secret.Owner, secret.Group); err != nil {
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - %w", secret.Key, err)))
+		}
+		secret.Namespace = strings.Trim(secret.Namespace, "/")
+
 		if secret.Output != "" {
 			secret.Output = util.AbsolutePath(outputPrefix, secret.Output)
 		}
 
-		if secret.Output != "" && secret.Lifetime == util.LifetimeVersion {
-			errs = append(errs, fmt.Errorf("secret %q - output %q - cannot use an output file when a secret has a lifetime of %q; this only works with fields of a secret",
-				secret.Key, secret.Output, util.LifetimeVersion))
+		secret.Format = strings.ToLower(secret.Format)
+		if secret.Format != "" {
+			if secret.Output == "" {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - a 'format' is only used with an 'output'", secret.Key)))
+			}
+			switch secret.Format {
+			case util.FormatJSON, util.FormatYAML, util.FormatDotenv, util.FormatProperties, util.FormatTOML:
+			default:
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - format %q - if specified, format must be one of %q, %q, %q, %q or %q",
+					secret.Key, secret.Format, util.FormatJSON, util.FormatYAML, util.FormatDotenv, util.FormatProperties, util.FormatTOML)))
+			}
+		}
+
+		if secret.Output != "" && secret.Format == "" {
+			secret.Format = util.FormatJSON
 		}
 
-		if secret.Lifetime == util.LifetimeVersion && len(secret.Fields) == 0 {
-			errs = append(errs, fmt.Errorf("secret %q - at least one field of a secret must be specified when using a lifetime of %q", secret.Key, util.LifetimeVersion))
+		if secret.Lifetime == util.LifetimeVersion && len(secret.Fields) == 0 && secret.Output == "" {
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - at least one field or an output must be specified when using a lifetime of %q", secret.Key, util.LifetimeVersion)))
+		}
+
+		if secret.MinVersionAge != "" {
+			if secret.Lifetime != util.LifetimeVersion {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - 'minVersionAge' is only used with a lifetime of %q", secret.Key, util.LifetimeVersion)))
+			}
+			if age, err := time.ParseDuration(secret.MinVersionAge); err != nil || age < 0 {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - invalid 'minVersionAge' %q", secret.Key, secret.MinVersionAge)))
+			}
+		}
+
+		if secret.MaxVersionsBehind != 0 {
+			if secret.Lifetime != util.LifetimeVersion {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - 'maxVersionsBehind' is only used with a lifetime of %q", secret.Key, util.LifetimeVersion)))
+			}
+			if secret.MaxVersionsBehind < 0 {
+				errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - 'maxVersionsBehind' must not be negative", secret.Key)))
+			}
 		}
 
 		if secret.TouchFile != "" && secret.Lifetime != util.LifetimeVersion {
-			errs = append(errs, fmt.Errorf("secret %q - touch files are only used for fields of secrets with lifetime of %q", secret.Key, util.LifetimeVersion))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - touch files are only used for fields of secrets with lifetime of %q", secret.Key, util.LifetimeVersion)))
 		}
 
 		if secret.TouchFile != "" {
 			secret.TouchFile = util.AbsolutePath(outputPrefix, secret.TouchFile)
 		}
 
+		if err := secret.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - %w", secret.Key, err)))
+		}
+
 		if secret.Key != "" && keys[secret.Key] {
-			errs = append(errs, fmt.Errorf("secret %q - duplicate secret key found in configuration file", secret.Key))
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - duplicate secret key found in configuration file", secret.Key)))
 		}
 		keys[secret.Key] = true
 		tidySecrets = append(tidySecrets, secret)
@@ -381,20 +747,29 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 	// Go through the SSH config and clean it up..
 	var tidySSH []SSHCertificateType
 
-	for _, sshCert := range cfg.SSHCertificates {
+	for i, sshCert := range cfg.SSHCertificates {
 		if sshCert.VaultRole == "" {
-			errs = append(errs, fmt.Errorf("there is a SSH certificate stanza missing its 'vaultRole'"))
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("there is a SSH certificate stanza missing its 'vaultRole'")))
 		}
 
 		if sshCert.VaultMount == "" {
-			errs = append(errs, fmt.Errorf("vaultRole %q - ssh certificate stanza is missing a 'vaultMountPoint'", sshCert.VaultRole))
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("vaultRole %q - ssh certificate stanza is missing a 'vaultMountPoint'", sshCert.VaultRole)))
 		}
 
 		if sshCert.OutputPath == "" {
-			errs = append(errs, fmt.Errorf("vaultMount %q vaultRole %q - ssh certificate stanza is missing an 'outputPath'", sshCert.VaultMount, sshCert.VaultRole))
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("vaultMount %q vaultRole %q - ssh certificate stanza is missing an 'outputPath'", sshCert.VaultMount, sshCert.VaultRole)))
 		} else {
 			sshCert.OutputPath = util.AbsolutePath(outputPrefix, sshCert.OutputPath)
 		}
+
+		if _, err := util.LookupFileOwner(sshCert.Owner, sshCert.Group); err != nil {
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("vaultRole %q - ssh certificate stanza %w", sshCert.VaultRole, err)))
+		}
+		sshCert.Namespace = strings.Trim(sshCert.Namespace, "/")
+
+		if err := sshCert.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("vaultRole %q - ssh certificate stanza %w", sshCert.VaultRole, err)))
+		}
 		tidySSH = append(tidySSH, sshCert)
 	}
 
@@ -403,32 +778,373 @@ func (cfg *VaultConfig) prepareConfig(inputPrefix, outputPrefix string) []error
 	// Go through the AWS config and clean it up...
 	var tidyAWS []AWSType
 
-	for _, aws := range cfg.AWS {
+	for i, aws := range cfg.AWS {
 
 		if aws.VaultRole == "" {
-			errs = append(errs, errors.New("there is an AWS stanza missing its 'vaultRole'"))
+			errs = append(errs, stanzaError("aws", i, errors.New("there is an AWS stanza missing its 'vaultRole'")))
 		}
 		if aws.VaultMountPoint == "" {
-			errs = append(errs, fmt.Errorf("vaultRole %q - aws stanza is missing a Vault mount point", aws.VaultRole))
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza is missing a Vault mount point", aws.VaultRole)))
 		}
 
 		if aws.Profile == "" {
-			errs = append(errs, fmt.Errorf("vaultRole %q - aws stanza is missing an AWS profile name", aws.VaultRole))
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza is missing an AWS profile name", aws.VaultRole)))
 		}
 		if aws.Region == "" {
-			errs = append(errs, fmt.Errorf("vaultRole %q - aws stanza is missing an AWS region", aws.VaultRole))
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza is missing an AWS region", aws.VaultRole)))
 		}
 
 		if aws.OutputPath == "" {
-			errs = append(errs, fmt.Errorf("vaultRole %q - aws stanza is missing an output path", aws.VaultRole))
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza is missing an output path", aws.VaultRole)))
 		} else {
 			aws.OutputPath = util.AbsolutePath(outputPrefix, aws.OutputPath)
 		}
+
+		if _, err := util.LookupFileOwner(aws.Owner, aws.Group); err != nil {
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza %w", aws.VaultRole, err)))
+		}
+		aws.Namespace = strings.Trim(aws.Namespace, "/")
+
+		if err := aws.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza %w", aws.VaultRole, err)))
+		}
 		tidyAWS = append(tidyAWS, aws)
 	}
 
 	cfg.AWS = tidyAWS
 
+	// Go through the database config and clean it up...
+	var tidyDatabases []DatabaseType
+
+	for i, db := range cfg.Databases {
+		if db.Key == "" {
+			errs = append(errs, stanzaError("databases", i, errors.New("there is a database stanza missing a 'key' value")))
+			continue
+		}
+
+		if keys[db.Key] {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - duplicate key found in configuration file", db.Key)))
+		}
+		keys[db.Key] = true
+
+		if db.VaultMountPoint == "" {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - database stanza is missing a 'vaultMountPoint'", db.Key)))
+		}
+
+		if db.VaultRole == "" {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - database stanza is missing a 'vaultRole'", db.Key)))
+		}
+
+		var tidyFields []SecretFieldType
+		for _, field := range db.Fields {
+			if field.Name == "" {
+				errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - there is a field missing a 'name' value", db.Key)))
+			}
+
+			field.Encoding = strings.ToLower(field.Encoding)
+			if field.Encoding != "" && field.Encoding != util.EncodingBase64 && field.Encoding != util.EncodingNone {
+				errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - field %q - encoding %q - if specified, encoding must be %q or %q",
+					db.Key, field.Name, field.Encoding, util.EncodingBase64, util.EncodingNone)))
+			}
+
+			if field.Output == "" {
+				errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - field %q - this field is missing an 'output'", db.Key, field.Name)))
+			} else {
+				field.Output = util.AbsolutePath(outputPrefix, field.Output)
+			}
+			if _, err := util.LookupFileOwner(field.Owner, field.Group); err != nil {
+				errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - field %q - %w", db.Key, field.Name, err)))
+			}
+			tidyFields = append(tidyFields, field)
+		}
+
+		db.Fields = tidyFields
+
+		if _, err := util.LookupFileOwner(db.Owner, db.Group); err != nil {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - %w", db.Key, err)))
+		}
+		db.Namespace = strings.Trim(db.Namespace, "/")
+
+		if err := db.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - %w", db.Key, err)))
+		}
+		tidyDatabases = append(tidyDatabases, db)
+	}
+
+	cfg.Databases = tidyDatabases
+
+	// Go through the dynamic secrets config and clean it up...
+	var tidyDynamic []DynamicType
+
+	for i, dyn := range cfg.Dynamic {
+		if dyn.Key == "" {
+			errs = append(errs, stanzaError("dynamic", i, errors.New("there is a dynamic stanza missing a 'key' value")))
+			continue
+		}
+
+		if keys[dyn.Key] {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - duplicate key found in configuration file", dyn.Key)))
+		}
+		keys[dyn.Key] = true
+
+		if dyn.Path == "" {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - dynamic stanza is missing a 'path'", dyn.Key)))
+		}
+
+		dyn.Method = strings.ToLower(dyn.Method)
+		if dyn.Method == "" {
+			dyn.Method = DynamicMethodRead
+		}
+
+		if dyn.Method != DynamicMethodRead && dyn.Method != DynamicMethodWrite {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - method %q - if specified, method must be %q or %q",
+				dyn.Key, dyn.Method, DynamicMethodRead, DynamicMethodWrite)))
+		}
+
+		if dyn.Method == DynamicMethodRead && len(dyn.Data) > 0 {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - 'data' is only sent when the method is %q", dyn.Key, DynamicMethodWrite)))
+		}
+
+		var tidyFields []SecretFieldType
+		for _, field := range dyn.Fields {
+			if field.Name == "" {
+				errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - there is a field missing a 'name' value", dyn.Key)))
+			}
+
+			field.Encoding = strings.ToLower(field.Encoding)
+			if field.Encoding != "" && field.Encoding != util.EncodingBase64 && field.Encoding != util.EncodingNone {
+				errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - field %q - encoding %q - if specified, encoding must be %q or %q",
+					dyn.Key, field.Name, field.Encoding, util.EncodingBase64, util.EncodingNone)))
+			}
+
+			if field.Output == "" {
+				errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - field %q - this field is missing an 'output'", dyn.Key, field.Name)))
+			} else {
+				field.Output = util.AbsolutePath(outputPrefix, field.Output)
+			}
+			if _, err := util.LookupFileOwner(field.Owner, field.Group); err != nil {
+				errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - field %q - %w", dyn.Key, field.Name, err)))
+			}
+			tidyFields = append(tidyFields, field)
+		}
+
+		dyn.Fields = tidyFields
+
+		if dyn.Output != "" {
+			dyn.Output = util.AbsolutePath(outputPrefix, dyn.Output)
+		}
+
+		if _, err := util.LookupFileOwner(dyn.Owner, dyn.Group); err != nil {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - %w", dyn.Key, err)))
+		}
+		dyn.Namespace = strings.Trim(dyn.Namespace, "/")
+
+		if err := dyn.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - %w", dyn.Key, err)))
+		}
+		tidyDynamic = append(tidyDynamic, dyn)
+	}
+
+	cfg.Dynamic = tidyDynamic
+
+	// Go through the PKI config and clean it up...
+	var tidyPKI []PKICertificateType
+
+	for i, pki := range cfg.PKICertificates {
+		if pki.VaultRole == "" {
+			errs = append(errs, stanzaError("pkiCertificates", i, errors.New("there is a PKI certificate stanza missing its 'vaultRole'")))
+		}
+
+		if pki.VaultMountPoint == "" {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza is missing a 'vaultMountPoint'", pki.VaultRole)))
+		}
+
+		if pki.CommonName == "" {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza is missing a 'commonName'", pki.VaultRole)))
+		}
+
+		if pki.TTL != "" {
+			if _, err := time.ParseDuration(pki.TTL); err != nil {
+				errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza has an invalid 'ttl': %w", pki.VaultRole, err)))
+			}
+		}
+
+		if pki.ReissueFraction == 0 {
+			pki.ReissueFraction = DefaultPKIReissueFraction
+		} else if pki.ReissueFraction < 0 || pki.ReissueFraction >= 1 {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza 'reissueFraction' must be between 0 and 1", pki.VaultRole)))
+		}
+
+		for _, ip := range pki.IPSans {
+			if net.ParseIP(ip) == nil {
+				errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza has an invalid IP SAN %q", pki.VaultRole, ip)))
+			}
+		}
+
+		if pki.OutputPath == "" {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza is missing an 'outputPath'", pki.VaultRole)))
+		} else {
+			pki.OutputPath = util.AbsolutePath(outputPrefix, pki.OutputPath)
+		}
+
+		if _, err := util.LookupFileOwner(pki.Owner, pki.Group); err != nil {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza %w", pki.VaultRole, err)))
+		}
+		pki.Namespace = strings.Trim(pki.Namespace, "/")
+
+		if err := pki.OnChange.prepare(inputPrefix); err != nil {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza %w", pki.VaultRole, err)))
+		}
+		tidyPKI = append(tidyPKI, pki)
+	}
+
+	cfg.PKICertificates = tidyPKI
+
+	// Go through the Vault connections and clean them up...
+	var tidyConnections []VaultConnectionType
+	names := make(map[string]bool)
+
+	for i, conn := range cfg.Connections {
+		if conn.Name == "" {
+			errs = append(errs, stanzaError("connections", i, errors.New("there is a Vault connection missing its 'name'")))
+			continue
+		}
+
+		if names[conn.Name] {
+			errs = append(errs, stanzaError("connections", i, fmt.Errorf("connection %q - duplicate Vault connection name found in configuration file", conn.Name)))
+		}
+		names[conn.Name] = true
+
+		if conn.Address == "" {
+			errs = append(errs, stanzaError("connections", i, fmt.Errorf("connection %q - Vault connection is missing an 'address'", conn.Name)))
+		}
+
+		if conn.CACert != "" {
+			conn.CACert = util.AbsolutePath(inputPrefix, conn.CACert)
+		}
+
+		for _, name := range conn.Auth {
+			if _, err := util.ParseAuthMechanism(name); err != nil {
+				errs = append(errs, stanzaError("connections", i, fmt.Errorf("connection %q - %w", conn.Name, err)))
+			}
+		}
+
+		conn.Namespace = strings.Trim(conn.Namespace, "/")
+		tidyConnections = append(tidyConnections, conn)
+	}
+
+	cfg.Connections = tidyConnections
+
+	// Go through the exec config and clean it up...
+	if cfg.Exec.Signal != "" {
+		if _, err := util.ParseSignal(cfg.Exec.Signal); err != nil {
+			errs = append(errs, fmt.Errorf("exec - %w", err))
+		}
+	}
+
+	var tidyEnvironment []EnvironmentType
+	envNames := make(map[string]bool)
+
+	for i, env := range cfg.Exec.Environment {
+		if !environmentNameRegex.MatchString(env.Name) {
+			errs = append(errs, stanzaError("exec.environment", i, fmt.Errorf("environment variable %q - name must be letters, digits and underscores, and not start with a digit", env.Name)))
+		}
+
+		if envNames[env.Name] {
+			errs = append(errs, stanzaError("exec.environment", i, fmt.Errorf("environment variable %q - duplicate environment variable found in configuration file", env.Name)))
+		}
+		envNames[env.Name] = true
+
+		if env.Key == "" || env.Field == "" {
+			errs = append(errs, stanzaError("exec.environment", i, fmt.Errorf("environment variable %q - both a 'key' and a 'field' are required", env.Name)))
+		}
+
+		env.Encoding = strings.ToLower(env.Encoding)
+		if env.Encoding != "" && env.Encoding != util.EncodingBase64 && env.Encoding != util.EncodingNone {
+			errs = append(errs, stanzaError("exec.environment", i, fmt.Errorf("environment variable %q - encoding %q - if specified, encoding must be %q or %q",
+				env.Name, env.Encoding, util.EncodingBase64, util.EncodingNone)))
+		}
+		tidyEnvironment = append(tidyEnvironment, env)
+	}
+
+	cfg.Exec.Environment = tidyEnvironment
+
+	return errs
+}
+
+// checkEnvironmentReferences ensures every environment variable for --exec refers to the key of a secret,
+// database or dynamic stanza.
+func (cfg VaultConfig) checkEnvironmentReferences() []error {
+	var errs []error
+
+	keys := make(map[string]bool)
+	for _, secret := range cfg.Secrets {
+		keys[secret.Key] = true
+	}
+	for _, db := range cfg.Databases {
+		keys[db.Key] = true
+	}
+	for _, dyn := range cfg.Dynamic {
+		keys[dyn.Key] = true
+	}
+
+	for i, env := range cfg.Exec.Environment {
+		if env.Key != "" && !keys[env.Key] {
+			errs = append(errs, stanzaError("exec.environment", i, fmt.Errorf("environment variable %q - no secret, database or dynamic stanza has the key %q", env.Name, env.Key)))
+		}
+	}
+
+	return errs
+}
+
+// checkConnectionReferences ensures every "vault" reference in the configuration names a configured connection.
+func (cfg VaultConfig) checkConnectionReferences() []error {
+	var errs []error
+
+	known := func(name string) bool {
+		if name == "" {
+			return true
+		}
+		_, ok := cfg.Connection(name)
+		return ok
+	}
+
+	for i, secret := range cfg.Secrets {
+		if !known(secret.Vault) {
+			errs = append(errs, stanzaError("secrets", i, fmt.Errorf("secret %q - unknown Vault connection %q", secret.Key, secret.Vault)))
+		}
+	}
+
+	for i, sshCert := range cfg.SSHCertificates {
+		if !known(sshCert.Vault) {
+			errs = append(errs, stanzaError("sshCertificates", i, fmt.Errorf("vaultRole %q - ssh certificate stanza uses unknown Vault connection %q", sshCert.VaultRole, sshCert.Vault)))
+		}
+	}
+
+	for i, aws := range cfg.AWS {
+		if !known(aws.Vault) {
+			errs = append(errs, stanzaError("aws", i, fmt.Errorf("vaultRole %q - aws stanza uses unknown Vault connection %q", aws.VaultRole, aws.Vault)))
+		}
+	}
+
+	for i, pki := range cfg.PKICertificates {
+		if !known(pki.Vault) {
+			errs = append(errs, stanzaError("pkiCertificates", i, fmt.Errorf("vaultRole %q - pki certificate stanza uses unknown Vault connection %q", pki.VaultRole, pki.Vault)))
+		}
+	}
+
+	for i, db := range cfg.Databases {
+		if !known(db.Vault) {
+			errs = append(errs, stanzaError("databases", i, fmt.Errorf("database %q - unknown Vault connection %q", db.Key, db.Vault)))
+		}
+	}
+
+	for i, dyn := range cfg.Dynamic {
+		if !known(dyn.Vault) {
+			errs = append(errs, stanzaError("dynamic", i, fmt.Errorf("dynamic %q - unknown Vault connection %q", dyn.Key, dyn.Vault)))
+		}
+	}
+
 	return errs
 }
 
@@ -469,6 +1185,39 @@ func (cfg VaultConfig) Cleanup() {
 		}
 	}
 
+	for _, pki := range cfg.PKICertificates {
+		for _, filename := range []string{util.PKICertificate, util.PKIPrivateKey, util.PKIChain, util.PKICABundle} {
+			if err := os.Remove(filepath.Join(pki.OutputPath, filename)); err != nil {
+				cfg.log.Warn().Err(err).Str("filename", filepath.Join(pki.OutputPath, filename)).Msg("could not remove file")
+			}
+		}
+	}
+
+	for _, db := range cfg.Databases {
+		for _, field := range db.Fields {
+			if field.Output != "" {
+				if err := os.Remove(field.Output); err != nil {
+					cfg.log.Warn().Err(err).Str("filename", field.Output).Msg("could not remove file")
+				}
+			}
+		}
+	}
+
+	for _, dyn := range cfg.Dynamic {
+		if dyn.Output != "" {
+			if err := os.Remove(dyn.Output); err != nil {
+				cfg.log.Warn().Err(err).Str("filename", dyn.Output).Msg("could not remove file")
+			}
+		}
+		for _, field := range dyn.Fields {
+			if field.Output != "" {
+				if err := os.Remove(field.Output); err != nil {
+					cfg.log.Warn().Err(err).Str("filename", field.Output).Msg("could not remove file")
+				}
+			}
+		}
+	}
+
 	for _, aws := range cfg.AWS {
 		if aws.OutputPath != "" {
 			if err := os.Remove(filepath.Join(aws.OutputPath, "credentials")); err != nil {
@@ -484,6 +1233,9 @@ func (cfg VaultConfig) isEmpty() bool {
 	if cfg.VaultToken.Output == "" &&
 		len(cfg.Templates) == 0 &&
 		len(cfg.AWS) == 0 &&
+		len(cfg.Databases) == 0 &&
+		len(cfg.PKICertificates) == 0 &&
+		len(cfg.Dynamic) == 0 &&
 		len(cfg.SSHCertificates) == 0 &&
 		len(cfg.Secrets) == 0 {
 		return true
@@ -2,8 +2,11 @@ package config
 
 import (
 	"io/ioutil"
+	"sort"
 	"testing"
+	"text/template"
 
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,6 +14,123 @@ var validConfigs = map[string]string{
 	"Empty File": ``,
 	"Only with Version 2": `---
 version: 2`,
+	"Secret from another Vault connection": `---
+version: 3
+connections:
+  - name: global
+    address: https://vault-global.example.com:8200
+    auth: [kubernetes]
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: token
+    vault: global
+`,
+	"onChange hooks": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    onChange:
+      command: [nginx, -s, reload]
+      timeout: 5s
+sshCertificates:
+  - vaultMountPoint: ssh
+    vaultRole: example
+    outputPath: ssh
+    onChange:
+      signal: SIGHUP
+      pidFile: /var/run/sshd.pid
+`,
+	"Owners and groups by name and numeric ID": `---
+version: 3
+vaultToken:
+  output: token
+  owner: root
+  group: "1001"
+secrets:
+  - key: ex
+    path: path/to/secret
+    lifetime: static
+    owner: "1001"
+    group: "1001"
+    fields:
+      - name: password
+        output: password
+        owner: root
+databases:
+  - key: db
+    vaultMountPoint: database
+    vaultRole: readonly
+    owner: "1001"
+    group: root
+    fields:
+      - name: password
+        output: db-password
+dynamic:
+  - key: rabbit
+    path: rabbitmq/creds/producer
+    output: rabbit.json
+    owner: root
+    group: "1001"
+pkiCertificates:
+  - vaultMountPoint: pki
+    vaultRole: service
+    commonName: service.example.com
+    outputPath: tls
+    owner: "1001"
+    group: "1001"
+`,
+	"Output specified for version scoped secret": `---
+version: 3
+secrets:
+  - key: ex
+    output: path/to/file
+    path: path/to/secret
+    lifetime: version
+    fields:
+     - name: api_key
+       output: path/to/api_key
+  - key: other
+    output: path/to/file
+    path: path/to/other
+    lifetime: static
+`,
+	"Minimum version age and maximum versions behind": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    lifetime: version
+    minVersionAge: 5m
+    maxVersionsBehind: 3
+    fields:
+     - name: api_key
+       output: path/to/api_key
+`,
+	"Secrets injected into the environment with --exec": `---
+version: 3
+secrets:
+  - key: api
+    path: path/to/secret
+    lifetime: static
+databases:
+  - key: db
+    vaultMountPoint: database
+    vaultRole: readonly
+exec:
+  signal: SIGHUP
+  environment:
+    - name: API_KEY
+      key: api
+      field: key
+    - name: DB_PASSWORD
+      key: db
+      field: password
+`,
 }
 
 var invalidConfigs = map[string]string{
@@ -36,16 +156,180 @@ secrets:
     path: path/to/secret
     lifetime: version
 `,
-	"Output specified for version scoped secret": `---
-version: 1
+	"Token and version scoped secrets sharing an output": `---
+version: 3
+secrets:
+  - key: one
+    output: path/to/file
+    path: path/to/one
+    lifetime: version
+  - key: two
+    output: path/to/file
+    path: path/to/two
+    lifetime: token
+`,
+	"Unknown Vault connection": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    vault: global
+`,
+	"Vault connection missing address": `---
+version: 3
+connections:
+  - name: global
+`,
+	"Vault connection with unknown auth mechanism": `---
+version: 3
+connections:
+  - name: global
+    address: https://vault-global.example.com:8200
+    auth: [magic]
+`,
+	"Environment variable for an unknown key": `---
+version: 3
+exec:
+  environment:
+    - name: API_KEY
+      key: api
+      field: key
+`,
+	"Invalid environment variable name": `---
+version: 3
+secrets:
+  - key: api
+    path: path/to/secret
+    lifetime: static
+exec:
+  environment:
+    - name: 1API-KEY
+      key: api
+      field: key
+`,
+	"onChange with both a command and a signal": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    onChange:
+      command: [nginx, -s, reload]
+      signal: SIGHUP
+      pidFile: /var/run/nginx.pid
+`,
+	"onChange signal without a pid file": `---
+version: 3
 secrets:
   - key: ex
+    path: path/to/secret
     output: path/to/file
+    lifetime: static
+    onChange:
+      signal: SIGHUP
+`,
+	"onChange with an invalid timeout": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    onChange:
+      command: [reload.sh]
+      timeout: soon
+`,
+	"Unknown owner": `---
+version: 3
+vaultToken:
+  output: token
+  owner: no-such-user-for-vault-ctrl-tool
+`,
+	"Unknown group on a field": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    lifetime: static
+    fields:
+      - name: password
+        output: password
+        group: no-such-group-for-vault-ctrl-tool
+`,
+	"Unknown owner on a database": `---
+version: 3
+databases:
+  - key: db
+    vaultMountPoint: database
+    vaultRole: readonly
+    owner: no-such-user-for-vault-ctrl-tool
+`,
+	"Unknown group on a dynamic secret": `---
+version: 3
+dynamic:
+  - key: rabbit
+    path: rabbitmq/creds/producer
+    output: rabbit.json
+    group: no-such-group-for-vault-ctrl-tool
+`,
+	"Unknown owner on a PKI certificate": `---
+version: 3
+pkiCertificates:
+  - vaultMountPoint: pki
+    vaultRole: service
+    commonName: service.example.com
+    outputPath: tls
+    owner: no-such-user-for-vault-ctrl-tool
+`,
+	"Unknown output format": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    format: xml
+`,
+	"Secrets sharing an output with different formats": `---
+version: 3
+secrets:
+  - key: one
+    path: path/to/one
+    output: path/to/file
+    lifetime: static
+    format: dotenv
+  - key: two
+    path: path/to/two
+    output: path/to/file
+    lifetime: static
+`,
+	"Invalid minVersionAge": `---
+version: 3
+secrets:
+  - key: ex
     path: path/to/secret
     lifetime: version
+    minVersionAge: later
     fields:
      - name: api_key
-       output: path/to/file
+       output: path/to/api_key
+`,
+	"maxVersionsBehind on a static secret": `---
+version: 3
+secrets:
+  - key: ex
+    path: path/to/secret
+    output: path/to/file
+    lifetime: static
+    maxVersionsBehind: 2
+`,
+	"Unknown exec signal": `---
+version: 3
+exec:
+  signal: SIGBOGUS
 `,
 }
 
@@ -129,3 +413,200 @@ func mkConfig(t *testing.T, directory string, body string) string {
 
 	return filename
 }
+
+func TestValidateConfigs(t *testing.T) {
+	for k, v := range validConfigs {
+		t.Run(k, func(t *testing.T) {
+			filename := mkConfig(t, t.TempDir(), v)
+			assert.Empty(t, ValidateConfigFile(filename, "", "", ""))
+		})
+	}
+
+	for k, v := range invalidConfigs {
+		t.Run(k, func(t *testing.T) {
+			filename := mkConfig(t, t.TempDir(), v)
+			assert.NotEmpty(t, ValidateConfigFile(filename, "", "", ""))
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	dir := t.TempDir()
+
+	tpl, err := ioutil.TempFile(dir, "validate_test_*.tpl")
+	if err != nil {
+		t.Fatalf("could not make temp file: %v", err)
+	}
+	if _, err := tpl.WriteString("{{.ex_api_key}} {{.missing_api_key}}\n"); err != nil {
+		t.Fatalf("could not write to temp file: %v", err)
+	}
+	if err := tpl.Close(); err != nil {
+		t.Fatalf("could not close temp file: %v", err)
+	}
+
+	main := mkConfig(t, t.TempDir(), `---
+version: 3
+templates:
+  - input: `+tpl.Name()+`
+    output: out
+    lifetime: static
+secrets:
+  - key: ex
+    path: path/to/secret
+    lifetime: static
+`)
+
+	sub := mkConfig(t, dir, `---
+version: 3
+secrets:
+  - key: ok
+    path: path/to/ok
+    lifetime: static
+  - key: bad
+    lifetime: static
+databases:
+  - key: db
+    vaultMountPoint: database
+    vaultRole: role
+    vault: elsewhere
+`)
+
+	problems := ValidateConfigFile(main, dir, "", "")
+
+	if assert.Len(t, problems, 3) {
+		assert.Equal(t, sub, problems[0].File)
+		assert.Equal(t, "secrets", problems[0].Stanza)
+		assert.Equal(t, 1, *problems[0].Index)
+		assert.Contains(t, problems[0].Message, "no Vault path")
+
+		assert.Equal(t, sub, problems[1].File)
+		assert.Equal(t, "databases", problems[1].Stanza)
+		assert.Equal(t, 0, *problems[1].Index)
+		assert.Contains(t, problems[1].Message, "unknown Vault connection")
+
+		assert.Equal(t, main, problems[2].File)
+		assert.Equal(t, "templates", problems[2].Stanza)
+		assert.Equal(t, 0, *problems[2].Index)
+		assert.Contains(t, problems[2].Message, "{{.missing_api_key}}")
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	tests := map[string]struct {
+		body   string
+		fields []string
+		all    bool
+	}{
+		"Fields":               {body: "{{.ex_api_key}} {{if .ex_flag}}{{.ex_other}}{{end}}", fields: []string{"ex_api_key", "ex_flag", "ex_other"}},
+		"Fields of with":       {body: "{{with .db_creds}}{{.username}}{{end}}", fields: []string{"db_creds"}},
+		"Fields of range":      {body: "{{range .ex_list}}{{.name}}{{else}}{{.ex_none}}{{end}}", fields: []string{"ex_list", "ex_none"}},
+		"Dot inside with":      {body: "{{with .ex_api_key}}{{.}}{{end}}", fields: []string{"ex_api_key"}},
+		"Dollar fields":        {body: "{{with .ex_api_key}}{{$.ex_other}}{{end}} {{$.ex_third}}", fields: []string{"ex_api_key", "ex_other", "ex_third"}},
+		"Dollar by itself":     {body: "{{$}}", all: true},
+		"Dot by itself":        {body: "{{.}}", all: true},
+		"Called with dot":      {body: `{{define "t"}}{{.ex_api_key}}{{end}}{{template "t" .}}`, fields: []string{"ex_api_key"}},
+		"Called with a field":  {body: `{{define "t"}}{{.username}}{{$.password}}{{end}}{{template "t" .db_creds}}`, fields: []string{"db_creds"}},
+		"Defined but not used": {body: `{{define "t"}}{{.ex_unused}}{{end}}{{.ex_api_key}}`, fields: []string{"ex_api_key"}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tpl := template.Must(template.New("test").Parse(test.body))
+			fields, all := TemplateFields(tpl)
+
+			var names []string
+			for field := range fields {
+				names = append(names, field)
+			}
+			sort.Strings(names)
+
+			assert.Equal(t, test.fields, names)
+			assert.Equal(t, test.all, all)
+		})
+	}
+}
+
+func TestValidateTemplateFields(t *testing.T) {
+	dir := t.TempDir()
+
+	mkTemplate := func(body string) string {
+		tpl, err := ioutil.TempFile(dir, "validate_test_*.tpl")
+		if err != nil {
+			t.Fatalf("could not make temp file: %v", err)
+		}
+		if _, err := tpl.WriteString(body); err != nil {
+			t.Fatalf("could not write to temp file: %v", err)
+		}
+		if err := tpl.Close(); err != nil {
+			t.Fatalf("could not close temp file: %v", err)
+		}
+		return tpl.Name()
+	}
+
+	rebound := mkTemplate("{{with .ex_creds}}{{.username}}{{end}}{{range .ex_list}}{{.name}}{{end}}\n")
+	missing := mkTemplate("{{with .ex_creds}}{{$.missing_api_key}}{{end}}\n")
+	leased := mkTemplate("{{.db_username}} {{.rabbit_password}}\n")
+
+	main := mkConfig(t, dir, `---
+version: 3
+templates:
+  - input: `+rebound+`
+    output: rebound
+    lifetime: static
+  - input: `+missing+`
+    output: missing
+    lifetime: static
+  - input: `+leased+`
+    output: leased
+    lifetime: token
+  - input: `+leased+`
+    output: leased-static
+    lifetime: static
+secrets:
+  - key: ex
+    path: path/to/secret
+    lifetime: static
+databases:
+  - key: db
+    vaultMountPoint: database
+    vaultRole: role
+dynamic:
+  - key: rabbit
+    path: rabbitmq/creds/producer
+`)
+
+	problems := ValidateConfigFile(main, "", "", "")
+
+	if assert.Len(t, problems, 3) {
+		assert.Equal(t, 1, *problems[0].Index)
+		assert.Contains(t, problems[0].Message, "{{.missing_api_key}}")
+
+		// Database credentials and dynamic secrets are only available to token-scoped templates.
+		assert.Equal(t, 3, *problems[1].Index)
+		assert.Contains(t, problems[1].Message, "{{.db_username}}")
+		assert.Equal(t, 3, *problems[2].Index)
+		assert.Contains(t, problems[2].Message, "{{.rabbit_password}}")
+	}
+}
+
+func TestConnectionAuthFlags(t *testing.T) {
+	flags := util.CliFlags{
+		VaultTokenArg:      "cli-token",
+		KubernetesAuthRole: "cli-k8s-role",
+		JWTAuthRole:        "cli-jwt-role",
+		CertAuthRole:       "cli-cert-role",
+	}
+
+	// A connection without a role keeps the roles from the command line, but never the command line token.
+	connFlags := VaultConnectionType{Name: "global"}.AuthFlags(flags)
+	assert.Equal(t, "", connFlags.VaultTokenArg)
+	assert.Equal(t, "cli-k8s-role", connFlags.KubernetesAuthRole)
+	assert.Equal(t, "cli-jwt-role", connFlags.JWTAuthRole)
+	assert.Equal(t, "cli-cert-role", connFlags.CertAuthRole)
+
+	connFlags = VaultConnectionType{Name: "global", AuthRole: "global-role"}.AuthFlags(flags)
+	assert.Equal(t, "global-role", connFlags.KubernetesAuthRole)
+	assert.Equal(t, "", connFlags.IAMAuthRole, "a mechanism that isn't in use must not be selected")
+	assert.Equal(t, "global-role", connFlags.JWTAuthRole)
+	assert.Equal(t, "global-role", connFlags.CertAuthRole)
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"text/template"
+	"text/template/parse"
 )
 
 // v1 of vault-ctrl-tool parsed templates on startup so that typos would be caught during initializing,
@@ -22,3 +24,118 @@ func (cfg *VaultConfig) ingestTemplates() (map[string]*template.Template, error)
 
 	return templates, nil
 }
+
+// TemplateFields returns the names of the fields used by a template (and the templates it calls), such as
+// "ex_api_key" for {{.ex_api_key}} or {{$.ex_api_key}}. It returns true if the template uses "." (or "$") by itself,
+// in which case it could use any field. Inside "range" and "with", "." is something else, so fields of it aren't
+// counted.
+func TemplateFields(tpl *template.Template) (map[string]bool, bool) {
+	fields := make(map[string]bool)
+	all := false
+
+	if tpl == nil {
+		return fields, true
+	}
+
+	// Named templates are walked once for each kind of "." they are called with.
+	walked := make(map[string]bool)
+
+	// dotAtRoot is true while "." is the data the template was executed with, and dollarAtRoot is true while "$" is.
+	var walk func(node parse.Node, dotAtRoot, dollarAtRoot bool)
+	walk = func(node parse.Node, dotAtRoot, dollarAtRoot bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, dotAtRoot, dollarAtRoot)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, dotAtRoot, dollarAtRoot)
+		case *parse.IfNode:
+			walk(n.Pipe, dotAtRoot, dollarAtRoot)
+			walk(n.List, dotAtRoot, dollarAtRoot)
+			walk(n.ElseList, dotAtRoot, dollarAtRoot)
+		case *parse.RangeNode:
+			walk(n.Pipe, dotAtRoot, dollarAtRoot)
+			walk(n.List, false, dollarAtRoot)
+			walk(n.ElseList, dotAtRoot, dollarAtRoot)
+		case *parse.WithNode:
+			walk(n.Pipe, dotAtRoot, dollarAtRoot)
+			walk(n.List, false, dollarAtRoot)
+			walk(n.ElseList, dotAtRoot, dollarAtRoot)
+		case *parse.TemplateNode:
+			// A template called with the data gets its fields counted, instead of counting the data as a whole.
+			calledAtRoot := dotAtRoot && passesDot(n.Pipe) || dollarAtRoot && passesDollar(n.Pipe)
+			if !calledAtRoot {
+				walk(n.Pipe, dotAtRoot, dollarAtRoot)
+			}
+			key := fmt.Sprintf("%s/%t", n.Name, calledAtRoot)
+			if called := tpl.Lookup(n.Name); called != nil && called.Tree != nil && !walked[key] {
+				walked[key] = true
+				walk(called.Tree.Root, calledAtRoot, calledAtRoot)
+			}
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, dotAtRoot, dollarAtRoot)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, dotAtRoot, dollarAtRoot)
+			}
+		case *parse.ChainNode:
+			walk(n.Node, dotAtRoot, dollarAtRoot)
+		case *parse.FieldNode:
+			if dotAtRoot {
+				fields[n.Ident[0]] = true
+			}
+		case *parse.VariableNode:
+			if dollarAtRoot && n.Ident[0] == "$" {
+				if len(n.Ident) > 1 {
+					fields[n.Ident[1]] = true
+				} else {
+					all = true
+				}
+			}
+		case *parse.DotNode:
+			if dotAtRoot {
+				all = true
+			}
+		}
+	}
+
+	if tpl.Tree == nil {
+		for _, t := range tpl.Templates() {
+			if t.Tree != nil {
+				walk(t.Tree.Root, true, true)
+			}
+		}
+		return fields, all
+	}
+
+	walk(tpl.Tree.Root, true, true)
+
+	return fields, all
+}
+
+// passesDot is true if the pipeline is just ".".
+func passesDot(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, ok := pipe.Cmds[0].Args[0].(*parse.DotNode)
+	return ok
+}
+
+// passesDollar is true if the pipeline is just "$".
+func passesDollar(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	variable, ok := pipe.Cmds[0].Args[0].(*parse.VariableNode)
+	return ok && len(variable.Ident) == 1 && variable.Ident[0] == "$"
+}
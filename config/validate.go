@@ -0,0 +1,246 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+)
+
+// StanzaError is a problem with one stanza of a configuration file, such as the third entry under "secrets".
+type StanzaError struct {
+	Stanza string
+	Index  int
+	Err    error
+}
+
+func (e *StanzaError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StanzaError) Unwrap() error {
+	return e.Err
+}
+
+func stanzaError(stanza string, index int, err error) error {
+	return &StanzaError{Stanza: stanza, Index: index, Err: err}
+}
+
+// Problem is something wrong with a configuration file, found by ValidateConfigFile. Stanza and Index are only set
+// when the problem is with a particular stanza, and Index counts from zero.
+type Problem struct {
+	File    string `json:"file"`
+	Stanza  string `json:"stanza,omitempty"`
+	Index   *int   `json:"index,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Index != nil {
+		return fmt.Sprintf("%s: %s[%d]: %s", p.File, p.Stanza, *p.Index, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+func newProblem(file string, err error) Problem {
+	var stanzaErr *StanzaError
+	if errors.As(err, &stanzaErr) {
+		index := stanzaErr.Index
+		return Problem{File: file, Stanza: stanzaErr.Stanza, Index: &index, Message: stanzaErr.Err.Error()}
+	}
+	return Problem{File: file, Message: err.Error()}
+}
+
+// validatedFile is a configuration file as written (raw) and after being prepared, for the checks that need both.
+type validatedFile struct {
+	filename string
+	raw      VaultConfig
+	prepared VaultConfig
+}
+
+// ValidateConfigFile reads the configuration the same way ReadConfigFile does, but rather than stopping at the first
+// file with a problem, it returns every problem with every file. Beyond what ReadConfigFile checks, it also reports
+// template variables that no configured secret could provide. It never contacts Vault.
+func ValidateConfigFile(configFile string, configDir string, inputPrefix, outputPrefix string) []Problem {
+	if configFile == "" {
+		return []Problem{{Message: "a --config file is required to be specified"}}
+	}
+
+	filenames := []string{util.AbsolutePath(inputPrefix, configFile)}
+
+	if configDir != "" {
+		absConfigDir := util.AbsolutePath(inputPrefix, configDir)
+		if _, err := os.Stat(absConfigDir); !os.IsNotExist(err) {
+			items, err := ioutil.ReadDir(absConfigDir)
+			if err != nil {
+				return []Problem{{File: absConfigDir, Message: fmt.Sprintf("could not read config directory: %v", err)}}
+			}
+			for _, item := range items {
+				fileExtension := filepath.Ext(item.Name())
+				if (fileExtension == ".yaml" || fileExtension == ".yml") && !item.IsDir() {
+					filenames = append(filenames, absConfigDir+"/"+item.Name())
+				}
+			}
+		}
+	}
+
+	var problems []Problem
+	var files []validatedFile
+
+	for _, filename := range filenames {
+		file, fileProblems := validateFile(filename, inputPrefix, outputPrefix)
+		problems = append(problems, fileProblems...)
+		if file != nil {
+			files = append(files, *file)
+		}
+	}
+
+	if len(files) == 0 || files[0].filename != filenames[0] {
+		return problems
+	}
+
+	// Files from a config directory use the connections of the main config file, and environment variables can
+	// refer to secrets in any of the files.
+	var merged VaultConfig
+	var secrets []SecretType
+	var leasedKeys []string
+	for _, file := range files {
+		merged.Secrets = append(merged.Secrets, file.raw.Secrets...)
+		merged.Databases = append(merged.Databases, file.raw.Databases...)
+		merged.Dynamic = append(merged.Dynamic, file.raw.Dynamic...)
+		secrets = append(secrets, file.prepared.Secrets...)
+		for _, db := range file.prepared.Databases {
+			leasedKeys = append(leasedKeys, db.Key)
+		}
+		for _, dyn := range file.prepared.Dynamic {
+			leasedKeys = append(leasedKeys, dyn.Key)
+		}
+	}
+
+	for _, file := range files {
+		references := file.raw
+		references.Connections = files[0].raw.Connections
+		for _, err := range references.checkConnectionReferences() {
+			problems = append(problems, newProblem(file.filename, err))
+		}
+
+		references = merged
+		references.Exec.Environment = file.raw.Exec.Environment
+		for _, err := range references.checkEnvironmentReferences() {
+			problems = append(problems, newProblem(file.filename, err))
+		}
+	}
+
+	for _, file := range files {
+		for i, tpl := range file.prepared.Templates {
+			for _, err := range checkTemplateFields(tpl, secrets, leasedKeys) {
+				problems = append(problems, newProblem(file.filename, stanzaError("templates", i, err)))
+			}
+		}
+	}
+
+	return problems
+}
+
+// validateFile checks a single configuration file. The file is only returned if it could be parsed.
+func validateFile(filename string, inputPrefix, outputPrefix string) (*validatedFile, []Problem) {
+	yamlFile, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, []Problem{{File: filename, Message: fmt.Sprintf("trouble reading config file: %v", err)}}
+	}
+
+	file := validatedFile{filename: filename}
+
+	// Unmarshal twice, as preparing the configuration changes it.
+	if err := yaml.Unmarshal(yamlFile, &file.raw); err != nil {
+		return nil, []Problem{{File: filename, Message: fmt.Sprintf("could not unmarshal config file: %v", err)}}
+	}
+	if err := yaml.Unmarshal(yamlFile, &file.prepared); err != nil {
+		return nil, []Problem{{File: filename, Message: fmt.Sprintf("could not unmarshal config file: %v", err)}}
+	}
+
+	var problems []Problem
+
+	file.prepared.log = zerolog.Nop()
+	for _, err := range file.prepared.prepareConfig(inputPrefix, outputPrefix) {
+		problems = append(problems, newProblem(filename, err))
+	}
+
+	// Templates are never dropped when preparing the configuration, so their indexes still match the file.
+	for i, tpl := range file.prepared.Templates {
+		if tpl.Input == "" {
+			continue
+		}
+		if _, err := template.ParseFiles(tpl.Input); err != nil {
+			problems = append(problems, newProblem(filename, stanzaError("templates", i, fmt.Errorf("template %q - %w", tpl.Input, err))))
+		}
+	}
+
+	if _, err := file.prepared.createCompositeSecrets(); err != nil {
+		problems = append(problems, newProblem(filename, err))
+	}
+
+	return &file, problems
+}
+
+// checkTemplateFields finds the fields a template uses that no secret it can see could provide. Which secrets a
+// template can see depends on its lifetime, the same way as when it is written. Database credentials and dynamic
+// secrets (leasedKeys) are only seen by token-scoped templates.
+func checkTemplateFields(tpl TemplateType, secrets []SecretType, leasedKeys []string) []error {
+	if tpl.Input == "" {
+		return nil
+	}
+
+	t, err := template.ParseFiles(tpl.Input)
+	if err != nil {
+		// Already reported by validateFile.
+		return nil
+	}
+
+	fields, all := TemplateFields(t)
+	if all {
+		return nil
+	}
+
+	var keys []string
+	for _, secret := range secrets {
+		if secret.Lifetime == util.LifetimeStatic || secret.Lifetime == tpl.Lifetime {
+			keys = append(keys, secret.Key+"_")
+		}
+	}
+	if tpl.Lifetime == util.LifetimeToken {
+		for _, key := range leasedKeys {
+			keys = append(keys, key+"_")
+		}
+	}
+
+	var unknown []string
+	for field := range fields {
+		provided := false
+		for _, key := range keys {
+			if strings.HasPrefix(field, key) {
+				provided = true
+				break
+			}
+		}
+		if !provided {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+
+	var errs []error
+	for _, field := range unknown {
+		errs = append(errs, fmt.Errorf("template %q - {{.%s}} is not provided by any secret available to a template with a lifetime of %q",
+			tpl.Input, field, tpl.Lifetime))
+	}
+	return errs
+}
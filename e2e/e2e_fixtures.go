@@ -82,6 +82,29 @@ const exampleSecretJSON = `{
   "warnings": null
 }`
 
+// exampleEscapingSecretJSON has values that need quoting or escaping in every output format.
+// language=JSON
+const exampleEscapingSecretJSON = `{
+  "request_id": "3b1c7a2e-5d4f-4e1a-9c8b-7f6e5d4c3b2a",
+  "lease_id": "",
+  "lease_duration": 0,
+  "renewable": false,
+  "data": {
+    "data": {
+      "password": "p@ss \"w$rd\"\nline 2",
+      "greeting": "héllo = world",
+      "port": 5432
+    },
+    "metadata": {
+      "created_time": "2019-10-02T22:42:10.724886003Z",
+      "deletion_time": "",
+      "destroyed": false,
+      "version": 1
+    }
+  },
+  "warnings": null
+}`
+
 // exampleSecretFreshV4JSON is just like exampleSecretV4JSON, except the created_time is a specific
 // value to test against.
 // language=JSON
@@ -105,6 +128,28 @@ const exampleSecretFreshV4JSON = `{
   "warnings": null
 }`
 
+// exampleSecretFreshV6JSON is just like exampleSecretFreshV4JSON, except two more versions have been written since.
+// language=JSON
+const exampleSecretFreshV6JSON = `{
+  "request_id": "8c472fc1-f389-d0c8-fec0-83d9a9930a40",
+  "lease_id": "",
+  "lease_duration": 0,
+  "renewable": false,
+  "data": {
+    "data": {
+      "bar": "bbbb6",
+      "foo": "aaaa6"
+    },
+    "metadata": {
+      "created_time": "2019-10-02T22:52:10.724886003Z",
+      "deletion_time": "",
+      "destroyed": false,
+      "version": 6
+    }
+  },
+  "warnings": null
+}`
+
 // exampleSecretV4JSON is just like exampleSecretJSON except the version has been incremented
 // and the values of the secrets are different. The created_time is 31s later than exampleSecretJSON.
 // language=JSON
@@ -149,6 +194,17 @@ const exampleBase64SecretJSON = `{
   "warnings": null
 }`
 
+// testBriefcaseKey encrypts the briefcase, as databases and dynamic secrets are only kept in an encrypted one.
+const testBriefcaseKey = "5CzlsaPWyY0k0OcmJEJRUtZsGgA5m8yFH5JTHbyqKCU="
+
+func testBriefcaseKeys(t *testing.T) briefcase.KeySource {
+	keys, err := briefcase.NewStaticKey("test", testBriefcaseKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
 type SyncFixture struct {
 	log         zerolog.Logger
 	workDir     string
@@ -181,22 +237,24 @@ func setupSyncWithDir(t *testing.T, configBody string, cliArgs []string, workDir
 
 	vaultClient := mock_vaultclient.NewMockVaultClient(ctrl)
 	vaultClient.EXPECT().Address().Return("unit-tests").AnyTimes()
+	vaultClient.EXPECT().Namespace().Return("").AnyTimes()
 
 	metrics := mtrics.NewMetrics()
 
 	var bcase *briefcase.Briefcase
 
-	bcase, err = briefcase.LoadBriefcase(path.Join(workDir, "briefcase"), metrics)
+	keys := testBriefcaseKeys(t)
+	bcase, err = briefcase.LoadBriefcase(path.Join(workDir, "briefcase"), metrics, keys)
 	if err != nil {
 		bcase = briefcase.NewBriefcase(metrics)
+		bcase.EncryptWith(keys)
 	}
 
-	var args []string
-
-	args = append(args, cliArgs...)
-	args = append(args, "--output-prefix", workDir,
+	// The fixture's flags go first, as anything after "--" in cliArgs is the command for --exec.
+	args := []string{"--output-prefix", workDir,
 		"--input-prefix", workDir,
-		"--leases-file", path.Join(workDir, "briefcase"))
+		"--leases-file", path.Join(workDir, "briefcase")}
+	args = append(args, cliArgs...)
 
 	cliFlags, err := util.ProcessFlags(args)
 
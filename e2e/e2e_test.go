@@ -3,16 +3,29 @@ package e2e
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
 	mtrics "github.com/hootsuite/vault-ctrl-tool/v2/metrics"
+	"github.com/hootsuite/vault-ctrl-tool/v2/syncer"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
+	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
+	mock_vaultclient "github.com/hootsuite/vault-ctrl-tool/v2/vaultclient/mocks"
+	zlog "github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	testing2 "k8s.io/utils/clock/testing"
 )
@@ -326,3 +339,1477 @@ secrets:
 	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.VaultTokenWritten))
 	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.VaultTokenRefreshed))
 }
+
+// TestSecretInNamespace ensures secrets with a namespace are read through a client for that namespace, and are
+// tracked in the briefcase separately from the same path in another namespace.
+func TestSecretInNamespace(t *testing.T) {
+
+	fixture := setupSync(t, `
+---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   namespace: /team-a/
+   missingOk: false
+   mode: 0700
+   output: example-output
+   lifetime: static
+`, []string{
+		"--init",
+		"--vault-token", "unit-test-token"})
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+
+	namespacedClient := mock_vaultclient.NewMockVaultClient(fixture.ctrl)
+	namespacedClient.EXPECT().Address().Return("unit-tests").AnyTimes()
+	namespacedClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/")
+	namespacedClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(exampleSecretJSON), nil).Times(1)
+
+	fixture.vaultClient.EXPECT().WithNamespace("team-a").Return(namespacedClient, nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+	assert.NoError(t, err)
+	assert.FileExists(t, path.Join(fixture.workDir, "example-output"))
+
+	bc, err := briefcase.LoadBriefcase(path.Join(fixture.workDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.True(t, bc.StaticScopedSecrets["team-a:path/in/vault"], "secret must be enrolled with its namespace")
+}
+
+func TestSecretFromAnotherVaultConnection(t *testing.T) {
+
+	fixture := setupSync(t, `
+---
+version: 3
+connections:
+ - name: global
+   address: https://vault-global.example.com:8200
+secrets:
+ - key: example
+   path: path/in/vault
+   vault: global
+   missingOk: false
+   mode: 0700
+   output: example-output
+   lifetime: token
+`, []string{
+		"--init",
+		"--vault-token", "unit-test-token"})
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+
+	// The token for the other connection was obtained by an earlier run.
+	fixture.bcase.ConnectionTokenLeases["global"] = briefcase.LeasedAuthToken{
+		Token:       "global-token",
+		Renewable:   true,
+		ExpiresAt:   time.Now().AddDate(1, 0, 0),
+		NextRefresh: time.Now().AddDate(1, 0, 0),
+	}
+
+	globalClient := mock_vaultclient.NewMockVaultClient(fixture.ctrl)
+	globalClient.EXPECT().Address().Return("global-unit-tests").AnyTimes()
+	globalClient.EXPECT().Namespace().Return("").AnyTimes()
+	globalClient.EXPECT().VerifyVaultToken("global-token").Return(Secret(vaultTokenJSON), nil).Times(1)
+	globalClient.EXPECT().SetToken("unit-test-token").Times(1)
+	globalClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/")
+	globalClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(exampleSecretJSON), nil).Times(1)
+	fixture.syncer.SetConnectionClient("global", globalClient)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+	assert.NoError(t, err)
+	assert.FileExists(t, path.Join(fixture.workDir, "example-output"))
+
+	bc, err := briefcase.LoadBriefcase(path.Join(fixture.workDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.True(t, bc.TokenScopedSecrets["global@path/in/vault"], "secret must be enrolled with its connection")
+	assert.Equal(t, "unit-test-accessor", bc.ConnectionTokenLeases["global"].Accessor, "connection token must be kept in the briefcase")
+}
+
+// TestPlanDoesNotAuthenticateConnections - planning records that an additional Vault connection without a token
+// would authenticate, rather than authenticating, and can't read secrets through it.
+func TestPlanDoesNotAuthenticateConnections(t *testing.T) {
+
+	const databaseConfig = `---
+version: 3
+connections:
+ - name: global
+   address: https://vault-global.example.com:8200
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   vault: global
+   fields:
+    - name: username
+      output: db-username
+`
+
+	const secretConfig = `---
+version: 3
+connections:
+ - name: global
+   address: https://vault-global.example.com:8200
+secrets:
+ - key: example
+   path: path/in/vault
+   vault: global
+   output: example-output
+   lifetime: token
+`
+
+	sync := func(configBody string) (*plan.Plan, error) {
+		fixture := setupSync(t, configBody, []string{"--init", "--plan", "--vault-token", "unit-test-token"})
+
+		fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(Secret(vaultTokenJSON), nil).AnyTimes()
+		fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+
+		// Nothing is expected of the other connection's client, so authenticating to it fails the test.
+		globalClient := mock_vaultclient.NewMockVaultClient(fixture.ctrl)
+		globalClient.EXPECT().Address().Return("global-unit-tests").AnyTimes()
+		globalClient.EXPECT().Namespace().Return("").AnyTimes()
+		fixture.syncer.SetConnectionClient("global", globalClient)
+
+		fakeClock := testing2.NewFakeClock(time.Now())
+		p := plan.NewPlan()
+		ctx := plan.Set(clock.Set(context.Background(), fakeClock), p)
+
+		vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+		assert.NoError(t, err)
+		err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+		assert.NoFileExists(t, path.Join(fixture.workDir, "briefcase"))
+		return p, err
+	}
+
+	p, err := sync(databaseConfig)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`authenticate to Vault connection "global"`,
+		`issue database credentials "db" for role "readonly"`,
+	}, p.Actions())
+
+	_, err = sync(secretConfig)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "planning doesn't authenticate")
+	}
+}
+
+// language=JSON
+const exampleDatabaseCredentialJSON = `{
+  "request_id": "3a8d2c4e-5f7b-4c1d-9e2a-6b0f8d7c1e43",
+  "lease_id": "database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi",
+  "lease_duration": 3600,
+  "renewable": true,
+  "data": {
+    "password": "A1a-pass",
+    "username": "v-token-readonly-xyz"
+  },
+  "warnings": null
+}`
+
+// TestDatabaseCredentialRenewal - database credentials are written out once, and their lease is renewed by later
+// runs rather than a new credential being issued.
+func TestDatabaseCredentialRenewal(t *testing.T) {
+
+	const configBody = `---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   mode: 0600
+   fields:
+    - name: username
+      output: db-username
+    - name: password
+      output: db-password
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	username, _ := ioutil.ReadFile(path.Join(sharedDir, "db-username"))
+	assert.Equal(t, "v-token-readonly-xyz", string(username))
+	password, _ := ioutil.ReadFile(path.Join(sharedDir, "db-password"))
+	assert.Equal(t, "A1a-pass", string(password))
+
+	// Half way through the lease, the next run renews it instead of issuing a new credential.
+	fakeClock.Step(31 * time.Minute)
+
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().WithNamespace("").Return(fixture2.vaultClient, nil).Times(1)
+	fixture2.vaultClient.EXPECT().RenewLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi", time.Duration(0)).
+		Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	bc, err := briefcase.LoadBriefcase(path.Join(sharedDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.True(t, bc.DatabaseCredentials["db"].Expiry.After(fakeClock.Now().Add(59*time.Minute)), "renewed lease must be extended")
+}
+
+// TestDatabaseCredentialKeptWhenRenewalFails - a lease Vault won't renew is kept, as the credential may still be in
+// use, and renewed again on the next run. Only once it is about to expire is a new credential issued, and the old
+// lease revoked after the fields are rewritten.
+func TestDatabaseCredentialKeptWhenRenewalFails(t *testing.T) {
+
+	const configBody = `---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   mode: 0600
+   fields:
+    - name: password
+      output: db-password
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	// Half way through the lease, the renewal fails. The credential has plenty of time left, so it is kept.
+	fakeClock.Step(31 * time.Minute)
+
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().WithNamespace("").Return(fixture2.vaultClient, nil).Times(1)
+	fixture2.vaultClient.EXPECT().RenewLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi", time.Duration(0)).
+		Return(nil, errors.New("connection refused")).Times(1)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ := ioutil.ReadFile(path.Join(sharedDir, "db-password"))
+	assert.Equal(t, "A1a-pass", string(password))
+	assert.Equal(t, 0, fixture2.metrics.Counter(mtrics.SecretUpdates))
+
+	bc, err := briefcase.LoadBriefcase(path.Join(sharedDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi", bc.DatabaseCredentials["db"].LeaseID)
+
+	// When the lease expires before the next run and still can't be renewed, a new credential is issued.
+	fakeClock.Step(26 * time.Minute)
+
+	reissued := Secret(exampleDatabaseCredentialJSON)
+	reissued.LeaseID = "database/creds/readonly/second"
+	reissued.Data["password"] = "B2b-pass"
+
+	fixture3 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture3.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture3.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture3.vaultClient.EXPECT().WithNamespace("").Return(fixture3.vaultClient, nil).Times(2)
+	gomock.InOrder(
+		fixture3.vaultClient.EXPECT().RenewLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi", time.Duration(0)).
+			Return(nil, errors.New("connection refused")).Times(1),
+		fixture3.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(reissued, nil).Times(1),
+		fixture3.vaultClient.EXPECT().RevokeLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi").Return(nil).Times(1),
+	)
+
+	vtoken, err = fixture3.syncer.GetVaultToken(ctx, *fixture3.cliFlags)
+	assert.NoError(t, err)
+	err = fixture3.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture3.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ = ioutil.ReadFile(path.Join(sharedDir, "db-password"))
+	assert.Equal(t, "B2b-pass", string(password))
+	assert.Equal(t, 1, fixture3.metrics.Counter(mtrics.SecretUpdates))
+
+	bc, err = briefcase.LoadBriefcase(path.Join(sharedDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "database/creds/readonly/second", bc.DatabaseCredentials["db"].LeaseID)
+}
+
+// TestLeasedSecretsWithUnencryptedBriefcase - database credentials and dynamic secrets can be synced into a briefcase
+// that isn't encrypted, which only keeps their leases.
+func TestLeasedSecretsWithUnencryptedBriefcase(t *testing.T) {
+	workDir := t.TempDir()
+	configFile := path.Join(workDir, "vault-config.yml")
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(`---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+`), 0600))
+
+	flags, err := util.ProcessFlags([]string{"--init", "--config", configFile,
+		"--output-prefix", workDir, "--input-prefix", workDir, "--leases-file", path.Join(workDir, "briefcase")})
+	assert.NoError(t, err)
+
+	vaultClient, err := syncer.NewVaultClient(*flags)
+	assert.NoError(t, err)
+
+	_, err = syncer.SetupSyncer(*flags, vaultClient, briefcase.NewBriefcase(nil), nil)
+	assert.NoError(t, err)
+}
+
+// TestDatabaseCredentialInUnencryptedBriefcase - an unencrypted briefcase only keeps the lease of a database
+// credential, so a new process issues a new one (revoking the old lease once it is written), while a sidecar
+// carries the credential over from its previous sync.
+func TestDatabaseCredentialInUnencryptedBriefcase(t *testing.T) {
+
+	const configBody = `---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   mode: 0600
+   fields:
+    - name: password
+      output: db-password
+`
+
+	sharedDir := t.TempDir()
+	briefcaseFile := path.Join(sharedDir, "briefcase")
+
+	// The fixture encrypts its briefcase, so each sync gets a syncer with an unencrypted one instead.
+	unencrypted := func(fixture *SyncFixture, bc *briefcase.Briefcase) *syncer.Syncer {
+		return syncer.NewSyncer(fixture.log, fixture.cfg, fixture.vaultClient, bc, fixture.metrics)
+	}
+
+	vaultToken := Secret(vaultTokenJSON)
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	sync1 := unencrypted(fixture1, briefcase.NewBriefcase(fixture1.metrics))
+	vtoken, err := sync1.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	assert.NoError(t, sync1.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags))
+
+	saved, err := ioutil.ReadFile(briefcaseFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(saved), "A1a-pass", "the credential must not be saved in an unencrypted briefcase")
+
+	reissued := Secret(exampleDatabaseCredentialJSON)
+	reissued.LeaseID = "database/creds/readonly/second"
+	reissued.Data["password"] = "B2b-pass"
+
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().WithNamespace("").Return(fixture2.vaultClient, nil).Times(1)
+	gomock.InOrder(
+		fixture2.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(reissued, nil).Times(1),
+		fixture2.vaultClient.EXPECT().RevokeLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi").Return(nil).Times(1),
+	)
+
+	bc, err := briefcase.LoadBriefcase(briefcaseFile, fixture2.metrics, nil)
+	assert.NoError(t, err)
+	sync2 := unencrypted(fixture2, bc)
+	vtoken, err = sync2.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	assert.NoError(t, sync2.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags))
+
+	password, _ := ioutil.ReadFile(path.Join(sharedDir, "db-password"))
+	assert.Equal(t, "B2b-pass", string(password))
+
+	// A sidecar carries the credential over from its previous sync, so nothing is issued.
+	fixture3 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture3.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture3.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+
+	bc, err = briefcase.LoadBriefcase(briefcaseFile, fixture3.metrics, nil)
+	assert.NoError(t, err)
+	bc.RestoreLeaseData(sync2.Briefcase())
+	sync3 := unencrypted(fixture3, bc)
+	vtoken, err = sync3.GetVaultToken(ctx, *fixture3.cliFlags)
+	assert.NoError(t, err)
+	assert.NoError(t, sync3.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture3.cliFlags))
+
+	password, _ = ioutil.ReadFile(path.Join(sharedDir, "db-password"))
+	assert.Equal(t, "B2b-pass", string(password))
+}
+
+// language=JSON
+const exampleRabbitMQCredentialJSON = `{
+  "request_id": "b1e0a6f2-7c3d-4e5f-8a9b-0c1d2e3f4a5b",
+  "lease_id": "rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5",
+  "lease_duration": 3600,
+  "renewable": true,
+  "data": {
+    "password": "first-password",
+    "username": "root-4b95bf47-281d-dcb5-8a60-9594f8056092"
+  },
+  "warnings": null
+}`
+
+// TestDynamicSecretRefetchedAtMaxTTL - when Vault can no longer renew the lease of a dynamic secret past the next
+// sync, a new secret is fetched, the outputs are rewritten and then the old lease is revoked.
+func TestDynamicSecretRefetchedAtMaxTTL(t *testing.T) {
+
+	const configBody = `---
+version: 3
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   output: rabbit.json
+   mode: 0600
+   fields:
+    - name: password
+      output: rabbit-password
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ := ioutil.ReadFile(path.Join(sharedDir, "rabbit-password"))
+	assert.Equal(t, "first-password", string(password))
+
+	var output map[string]interface{}
+	outputBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "rabbit.json"))
+	assert.NoError(t, json.Unmarshal(outputBytes, &output))
+	assert.Equal(t, "root-4b95bf47-281d-dcb5-8a60-9594f8056092", output["username"])
+
+	// Half way through the lease, Vault only renews it up to its max TTL, which is before the next sync.
+	fakeClock.Step(31 * time.Minute)
+
+	renewed := Secret(exampleRabbitMQCredentialJSON)
+	renewed.LeaseDuration = 60
+
+	refetched := Secret(exampleRabbitMQCredentialJSON)
+	refetched.LeaseID = "rabbitmq/creds/producer/second"
+	refetched.Data["password"] = "second-password"
+
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().WithNamespace("").Return(fixture2.vaultClient, nil).Times(2)
+	gomock.InOrder(
+		fixture2.vaultClient.EXPECT().RenewLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5", time.Duration(0)).Return(renewed, nil).Times(1),
+		fixture2.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(refetched, nil).Times(1),
+		fixture2.vaultClient.EXPECT().RevokeLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5").Return(nil).Times(1),
+	)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ = ioutil.ReadFile(path.Join(sharedDir, "rabbit-password"))
+	assert.Equal(t, "second-password", string(password))
+
+	bc, err := briefcase.LoadBriefcase(path.Join(sharedDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "rabbitmq/creds/producer/second", bc.DynamicSecrets["rabbit"].LeaseID)
+	assert.Equal(t, 1, fixture2.metrics.Counter(mtrics.LeaseRenewed))
+}
+
+// TestDynamicSecretKeptWhenRenewalFails - a lease on a dynamic secret that Vault won't renew is kept, and renewed again
+// on the next run. Only once it is about to expire is the secret fetched again, and the old lease revoked.
+func TestDynamicSecretKeptWhenRenewalFails(t *testing.T) {
+
+	const configBody = `---
+version: 3
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   mode: 0600
+   fields:
+    - name: password
+      output: rabbit-password
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	// Half way through the lease, the renewal fails. The secret has plenty of time left, so it is kept.
+	fakeClock.Step(31 * time.Minute)
+
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().WithNamespace("").Return(fixture2.vaultClient, nil).Times(1)
+	fixture2.vaultClient.EXPECT().RenewLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5", time.Duration(0)).
+		Return(nil, errors.New("connection refused")).Times(1)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ := ioutil.ReadFile(path.Join(sharedDir, "rabbit-password"))
+	assert.Equal(t, "first-password", string(password))
+	assert.Equal(t, 0, fixture2.metrics.Counter(mtrics.SecretUpdates))
+
+	// When the lease expires before the next run and still can't be renewed, the secret is fetched again.
+	fakeClock.Step(26 * time.Minute)
+
+	refetched := Secret(exampleRabbitMQCredentialJSON)
+	refetched.LeaseID = "rabbitmq/creds/producer/second"
+	refetched.Data["password"] = "second-password"
+
+	fixture3 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture3.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture3.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture3.vaultClient.EXPECT().WithNamespace("").Return(fixture3.vaultClient, nil).Times(2)
+	gomock.InOrder(
+		fixture3.vaultClient.EXPECT().RenewLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5", time.Duration(0)).
+			Return(nil, errors.New("connection refused")).Times(1),
+		fixture3.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(refetched, nil).Times(1),
+		fixture3.vaultClient.EXPECT().RevokeLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5").Return(nil).Times(1),
+	)
+
+	vtoken, err = fixture3.syncer.GetVaultToken(ctx, *fixture3.cliFlags)
+	assert.NoError(t, err)
+	err = fixture3.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture3.cliFlags)
+	assert.NoError(t, err)
+
+	password, _ = ioutil.ReadFile(path.Join(sharedDir, "rabbit-password"))
+	assert.Equal(t, "second-password", string(password))
+	assert.Equal(t, 1, fixture3.metrics.Counter(mtrics.SecretUpdates))
+}
+
+// TestLeasedOutputsOwned ensures the outputs of database credentials and dynamic secrets are given the owner and
+// group of their stanza.
+func TestLeasedOutputsOwned(t *testing.T) {
+
+	uid, gid := os.Geteuid(), os.Getegid()
+	if uid == 0 {
+		// As root, the outputs can be given to someone else.
+		uid, gid = 65534, 65534
+	}
+
+	configBody := fmt.Sprintf(`---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   mode: 0600
+   owner: "%[1]d"
+   group: "%[2]d"
+   fields:
+    - name: password
+      output: db-password
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   output: rabbit.json
+   mode: 0600
+   owner: "%[1]d"
+   group: "%[2]d"
+`, uid, gid)
+
+	fixture := setupSync(t, configBody, []string{"--init", "--vault-token", "unit-test-token"})
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+
+	ctx := context.Background()
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, time.Now().Add(5*time.Minute), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	for _, output := range []string{"db-password", "rabbit.json"} {
+		info, err := os.Stat(path.Join(fixture.workDir, output))
+		if assert.NoError(t, err) {
+			stat := info.Sys().(*syscall.Stat_t)
+			assert.Equal(t, uid, int(stat.Uid), "owner of %s", output)
+			assert.Equal(t, gid, int(stat.Gid), "group of %s", output)
+		}
+	}
+}
+
+// TestRevokeLeasesReportsFailures - every lease in the briefcase is revoked at cleanup, even when an earlier one
+// fails, and the failure is reported.
+func TestRevokeLeasesReportsFailures(t *testing.T) {
+
+	const configBody = `---
+version: 3
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   fields:
+    - name: username
+      output: db-username
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   output: rabbit.json
+`
+
+	sharedDir := t.TempDir()
+
+	fixture := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	bc, err := briefcase.LoadBriefcase(path.Join(sharedDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+
+	fixture.vaultClient.EXPECT().WithNamespace("").Return(fixture.vaultClient, nil).Times(2)
+	fixture.vaultClient.EXPECT().RevokeLease("database/creds/readonly/Lx8UdI6SDRZF2Pkw8Q4ah1Yi").
+		Return(errors.New("permission denied")).Times(1)
+	fixture.vaultClient.EXPECT().RevokeLease("rabbitmq/creds/producer/Q2l9dX8bW1c3e5g7i9k1m3o5").Return(nil).Times(1)
+
+	err = syncer.RevokeLeases(zlog.Logger, bc, func(connection string) (vaultclient.VaultClient, error) {
+		assert.Equal(t, "", connection)
+		return fixture.vaultClient, nil
+	})
+	assert.EqualError(t, err, "failed to revoke 1 of 2 leases")
+}
+
+// TestExecEnvironment - fields of KV secrets and leased secrets listed under "exec" are turned into environment
+// variables, without reading the secrets from Vault a second time.
+func TestExecEnvironment(t *testing.T) {
+
+	fixture := setupSync(t, `
+---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   lifetime: static
+   fields:
+     - name: foo64
+       output: foo-output.txt
+       encoding: base64
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+exec:
+  environment:
+    - name: RABBIT_PASSWORD
+      key: rabbit
+      field: password
+    - name: GREETING
+      key: example
+      field: foo64
+      encoding: base64
+`, []string{"--vault-token", "unit-test-token", "--exec", "--", "my-app"})
+
+	assert.Equal(t, []string{"my-app"}, fixture.cliFlags.ExecCommand)
+	assert.Equal(t, path.Join(fixture.workDir, "briefcase"), fixture.cliFlags.BriefcaseFilename)
+
+	fixture.vaultClient.EXPECT().Address().Return("unit-tests").AnyTimes()
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(Secret(vaultTokenJSON), nil).AnyTimes()
+	fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/")
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(exampleBase64SecretJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	env, err := fixture.syncer.Environment()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GREETING=Hello Hootsuite", "RABBIT_PASSWORD=first-password"}, env)
+}
+
+// TestOnChangeHooks - hooks run once after the sync has written its files, identical hooks on different stanzas
+// only run once, and failures are counted without failing the sync.
+func TestOnChangeHooks(t *testing.T) {
+
+	workDir := t.TempDir()
+	hookOutput := path.Join(workDir, "hook-runs")
+
+	configBody := `
+---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   lifetime: static
+   fields:
+     - name: foo64
+       output: foo-output.txt
+   onChange:
+     command: ["sh", "-c", "cat ` + path.Join(workDir, "foo-output.txt") + ` >> ` + hookOutput + `"]
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   onChange:
+     command: ["sh", "-c", "cat ` + path.Join(workDir, "foo-output.txt") + ` >> ` + hookOutput + `"]
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   onChange:
+     signal: SIGHUP
+     pidFile: ` + path.Join(workDir, "missing.pid") + `
+`
+
+	fixture := setupSyncWithDir(t, configBody, []string{"--vault-token", "unit-test-token", "--init"}, workDir)
+
+	fixture.vaultClient.EXPECT().Address().Return("unit-tests").AnyTimes()
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(Secret(vaultTokenJSON), nil).AnyTimes()
+	fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/")
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(exampleBase64SecretJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	// The hook saw the file written by the secret stanza, and only ran once.
+	runs, err := ioutil.ReadFile(hookOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "SGVsbG8gSG9vdHN1aXRl", string(runs))
+
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.OnChangeSucceeded))
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.OnChangeFailed))
+}
+
+// TestOnChangeHooksRunWhenSyncFails - outputs written before a later stanza fails stay written, so their hooks run
+// then, rather than never (in --init) or on some later sync.
+func TestOnChangeHooksRunWhenSyncFails(t *testing.T) {
+
+	workDir := t.TempDir()
+	hookOutput := path.Join(workDir, "hook-runs")
+
+	configBody := `
+---
+version: 3
+dynamic:
+ - key: rabbit
+   path: rabbitmq/creds/producer
+   output: rabbit.json
+   onChange:
+     command: ["sh", "-c", "echo ran >> ` + hookOutput + `"]
+secrets:
+ - key: example
+   path: path/in/vault
+   lifetime: static
+   fields:
+     - name: foo
+       output: foo-output.txt
+`
+
+	fixture := setupSyncWithDir(t, configBody, []string{"--vault-token", "unit-test-token", "--init"}, workDir)
+
+	fixture.vaultClient.EXPECT().Address().Return("unit-tests").AnyTimes()
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(Secret(vaultTokenJSON), nil).AnyTimes()
+	fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().FetchDynamicSecret(gomock.Any()).Return(Secret(exampleRabbitMQCredentialJSON), nil).Times(1)
+	fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(nil, errors.New("permission denied")).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture.cliFlags)
+	assert.Error(t, err)
+
+	assert.FileExists(t, path.Join(workDir, "rabbit.json"))
+	runs, err := ioutil.ReadFile(hookOutput)
+	assert.NoError(t, err)
+	assert.Equal(t, "ran\n", string(runs))
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.OnChangeSucceeded))
+}
+
+// TestOutputModeChangedWithSameContents ensures that an output whose contents are the same is still rewritten when
+// its mode changed.
+func TestOutputModeChangedWithSameContents(t *testing.T) {
+
+	const configTemplate = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   mode: %s
+   lifetime: token
+   fields:
+    - name: foo
+      output: foo
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, fmt.Sprintf(configTemplate, "0700"), []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().Read(gomock.Any()).Return(Secret(exampleSecretJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	// A different token resets the briefcase, so the token scoped secret is fetched again, with the same value.
+	fixture2 := setupSyncWithDir(t, fmt.Sprintf(configTemplate, "0640"), []string{"--sidecar", "--one-shot", "--vault-token", "other-unit-test-token"}, sharedDir)
+
+	otherToken := Secret(vaultTokenJSON)
+	otherToken.Data["id"] = "other-unit-test-token"
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(otherToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().Read(gomock.Any()).Return(Secret(exampleSecretJSON), nil).Times(1)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, fixture2.metrics.Counter(mtrics.SecretUpdates))
+	assert.Equal(t, 0, fixture2.metrics.Counter(mtrics.SecretsUnchanged))
+
+	info, err := os.Stat(path.Join(sharedDir, "foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+// TestUnchangedOutputsNotRewritten ensures that when a new token causes token scoped secrets to be fetched again,
+// outputs whose contents are the same are not rewritten.
+func TestUnchangedOutputsNotRewritten(t *testing.T) {
+
+	const configBody = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   mode: 0700
+   lifetime: token
+   fields:
+    - name: foo
+      output: foo
+`
+
+	sharedDir := t.TempDir()
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().Read(gomock.Any()).Return(Secret(exampleSecretJSON), nil).Times(1)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture1.cliFlags)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fixture1.metrics.Counter(mtrics.SecretUpdates))
+
+	fooFile := path.Join(sharedDir, "foo")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.Chtimes(fooFile, past, past))
+
+	// A different token resets the briefcase, so the token scoped secret is fetched again, with the same value.
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "other-unit-test-token"}, sharedDir)
+
+	otherToken := Secret(vaultTokenJSON)
+	otherToken.Data["id"] = "other-unit-test-token"
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(otherToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture2.vaultClient.EXPECT().Read(gomock.Any()).Return(Secret(exampleSecretJSON), nil).Times(1)
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, fixture2.metrics.Counter(mtrics.SecretUpdates))
+	assert.Equal(t, 1, fixture2.metrics.Counter(mtrics.SecretsUnchanged))
+
+	info, err := os.Stat(fooFile)
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(past), "unchanged output should not have been rewritten")
+
+	foobytes, _ := ioutil.ReadFile(fooFile)
+	assert.Equal(t, "aaaa", string(foobytes))
+}
+
+// TestCompositeFormats ensures composite outputs are written in their format, with values quoted and escaped.
+func TestCompositeFormats(t *testing.T) {
+
+	fixture := setupSync(t, `
+---
+version: 3
+secrets:
+ - key: app
+   path: path/in/vault
+   lifetime: static
+   use_key_as_prefix: true
+   output: app.env
+   format: dotenv
+ - key: spring
+   path: path/in/vault
+   lifetime: static
+   output: application.properties
+   format: properties
+ - key: config
+   path: path/in/vault
+   lifetime: static
+   output: config.toml
+   format: toml
+ - key: rails
+   path: path/in/vault
+   lifetime: static
+   output: secrets.yml
+   format: yaml
+`, []string{
+		"--init",
+		"--vault-token", "unit-test-token"})
+
+	vaultToken := Secret(vaultTokenJSON)
+	fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture.vaultClient.EXPECT().Read(gomock.Any()).Return(Secret(exampleEscapingSecretJSON), nil).AnyTimes()
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	assert.NoError(t, err)
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	dotenv, _ := ioutil.ReadFile(path.Join(fixture.workDir, "app.env"))
+	assert.Equal(t, `app_greeting="héllo = world"
+app_password="p@ss \"w\$rd\"\nline 2"
+app_port="5432"
+`, string(dotenv))
+
+	properties, _ := ioutil.ReadFile(path.Join(fixture.workDir, "application.properties"))
+	assert.Equal(t, `greeting=h\u00e9llo = world
+password=p@ss "w$rd"\nline 2
+port=5432
+`, string(properties))
+
+	toml, _ := ioutil.ReadFile(path.Join(fixture.workDir, "config.toml"))
+	assert.Equal(t, `greeting = "héllo = world"
+password = "p@ss \"w$rd\"\nline 2"
+port = 5432
+`, string(toml))
+
+	yml, _ := ioutil.ReadFile(path.Join(fixture.workDir, "secrets.yml"))
+	assert.Equal(t, `greeting: héllo = world
+password: |-
+  p@ss "w$rd"
+  line 2
+port: 5432
+`, string(yml))
+}
+
+// TestVersionScopedTemplateAndComposite ensures templates and composites with a lifetime of "version" are only
+// rewritten once a new version of their secret is at least 30 seconds old, and that the secret is only read once
+// per sync.
+func TestVersionScopedTemplateAndComposite(t *testing.T) {
+
+	const configBody = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   lifetime: version
+   output: example.json
+templates:
+ - input: example.tpl
+   output: example.txt
+   lifetime: version
+`
+
+	sharedDir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(path.Join(sharedDir, "example.tpl"), []byte("foo={{.example_foo}}\n"), 0600))
+
+	vaultToken := Secret(vaultTokenJSON)
+
+	sync := func(args []string, now time.Time, secretJSON string) {
+		fixture := setupSyncWithDir(t, configBody, args, sharedDir)
+
+		fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+		fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+		fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+		fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(secretJSON), nil).Times(1)
+
+		fakeClock := testing2.NewFakeClock(now)
+		ctx := clock.Set(context.Background(), fakeClock)
+
+		vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+		assert.NoError(t, err)
+		err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+		assert.NoError(t, err)
+	}
+
+	sidecar := []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}
+
+	sync([]string{"--init", "--vault-token", "unit-test-token"}, time.Date(2019, 10, 2, 22, 50, 0, 0, time.UTC), exampleSecretJSON)
+
+	tplBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "example.txt"))
+	assert.Equal(t, "foo=aaaa\n", string(tplBytes))
+	jsonBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "example.json"))
+	assert.JSONEq(t, `{"foo": "aaaa", "bar": "bbbb"}`, string(jsonBytes))
+
+	// 10 seconds after version 4 was created, it's too new to be written.
+	sync(sidecar, time.Date(2019, 10, 2, 22, 52, 20, 0, time.UTC), exampleSecretFreshV4JSON)
+
+	tplBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "example.txt"))
+	assert.Equal(t, "foo=aaaa\n", string(tplBytes))
+	jsonBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "example.json"))
+	assert.JSONEq(t, `{"foo": "aaaa", "bar": "bbbb"}`, string(jsonBytes))
+
+	// 35 seconds after, it has settled.
+	sync(sidecar, time.Date(2019, 10, 2, 22, 52, 45, 0, time.UTC), exampleSecretFreshV4JSON)
+
+	tplBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "example.txt"))
+	assert.Equal(t, "foo=aaaa2\n", string(tplBytes))
+	jsonBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "example.json"))
+	assert.JSONEq(t, `{"foo": "aaaa2", "bar": "bbbb2"}`, string(jsonBytes))
+}
+
+// TestVersionHeldBackUntilMaxVersionsBehind ensures "--min-version-age" holds back new versions of a secret (and
+// counts them), until the fields fall more than "maxVersionsBehind" versions behind Vault.
+func TestVersionHeldBackUntilMaxVersionsBehind(t *testing.T) {
+
+	const configBody = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   lifetime: version
+   maxVersionsBehind: 2
+   fields:
+    - name: foo
+      output: foo
+`
+
+	sharedDir := t.TempDir()
+	vaultToken := Secret(vaultTokenJSON)
+
+	sync := func(args []string, now time.Time, secretJSON string) *SyncFixture {
+		fixture := setupSyncWithDir(t, configBody, args, sharedDir)
+
+		fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+		fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+		fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+		fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(secretJSON), nil).Times(1)
+
+		fakeClock := testing2.NewFakeClock(now)
+		ctx := clock.Set(context.Background(), fakeClock)
+
+		vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+		assert.NoError(t, err)
+		err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+		assert.NoError(t, err)
+		return fixture
+	}
+
+	sidecar := []string{"--sidecar", "--one-shot", "--min-version-age", "5m", "--vault-token", "unit-test-token"}
+	now := time.Date(2019, 10, 2, 22, 53, 0, 0, time.UTC)
+
+	sync([]string{"--init", "--vault-token", "unit-test-token"}, now, exampleSecretJSON)
+	fooBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "foo"))
+	assert.Equal(t, "aaaa", string(fooBytes))
+
+	// Version 4 is 50 seconds old, which isn't old enough with "--min-version-age 5m".
+	fixture := sync(sidecar, now, exampleSecretFreshV4JSON)
+	fooBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "foo"))
+	assert.Equal(t, "aaaa", string(fooBytes))
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.VersionsHeldBack))
+	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.SecretUpdates))
+
+	// Version 6 is just as new, but the field is now three versions behind.
+	fixture = sync(sidecar, now, exampleSecretFreshV6JSON)
+	fooBytes, _ = ioutil.ReadFile(path.Join(sharedDir, "foo"))
+	assert.Equal(t, "aaaa6", string(fooBytes))
+	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.VersionsHeldBack))
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.SecretUpdates))
+}
+
+// TestPlanChangesNothing ensures --plan reports the files a sync would create or rewrite, and the credentials it
+// would issue, without writing files, saving the briefcase or asking Vault for credentials.
+func TestPlanChangesNothing(t *testing.T) {
+
+	const configBody = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   lifetime: version
+   output: example.json
+   fields:
+    - name: foo
+      output: foo
+aws:
+ - vaultRole: example
+   vaultMountPoint: aws
+   awsProfile: default
+   awsRegion: us-east-1
+   outputPath: aws
+`
+
+	sharedDir := t.TempDir()
+	vaultToken := Secret(vaultTokenJSON)
+
+	sync := func(args []string, secretJSON string, p *plan.Plan) *SyncFixture {
+		fixture := setupSyncWithDir(t, configBody, args, sharedDir)
+
+		fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+		fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+		fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+		fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(secretJSON), nil).AnyTimes()
+		if p == nil {
+			fixture.vaultClient.EXPECT().FetchAWSSTSCredential(gomock.Any(), gomock.Any()).Return(
+				&vaultclient.AWSSTSCredential{AccessKey: "access", SecretKey: "secret", SessionToken: "session"},
+				&util.WrappedToken{Secret: &api.Secret{LeaseDuration: 7200}}, nil).Times(1)
+		}
+
+		fakeClock := testing2.NewFakeClock(time.Date(2019, 10, 2, 23, 0, 0, 0, time.UTC))
+		ctx := clock.Set(context.Background(), fakeClock)
+		if p != nil {
+			ctx = plan.Set(ctx, p)
+		}
+
+		vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+		assert.NoError(t, err)
+		err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(time.Hour), *fixture.cliFlags)
+		assert.NoError(t, err)
+		return fixture
+	}
+
+	// Planning an --init run creates everything, but nothing is written.
+	initPlan := plan.NewPlan()
+	sync([]string{"--init", "--plan", "--vault-token", "unit-test-token"}, exampleSecretJSON, initPlan)
+
+	assert.NoFileExists(t, path.Join(sharedDir, "foo"))
+	assert.NoFileExists(t, path.Join(sharedDir, "example.json"))
+	assert.NoFileExists(t, path.Join(sharedDir, "briefcase"))
+
+	var changes []plan.FileChange
+	for _, file := range initPlan.Files() {
+		changes = append(changes, file.Change)
+	}
+	assert.Equal(t, []plan.FileChange{plan.Create, plan.Create}, changes)
+	assert.Equal(t, []string{`issue AWS credentials for role "example" into "` + path.Join(sharedDir, "aws") + `"`},
+		initPlan.Actions())
+
+	var summary strings.Builder
+	assert.NoError(t, initPlan.Summary(&summary))
+	assert.NotContains(t, summary.String(), "aaaa")
+	assert.NotContains(t, summary.String(), "bbbb")
+
+	// After a real --init run, planning a sidecar run with a new value only rewrites what changed.
+	sync([]string{"--init", "--vault-token", "unit-test-token"}, exampleSecretJSON, nil)
+
+	// Version 4 of the secret changes "foo" and "bar". The AWS credentials are still good.
+	sidecarPlan := plan.NewPlan()
+	sync([]string{"--sidecar", "--one-shot", "--plan", "--vault-token", "unit-test-token"}, exampleSecretV4JSON, sidecarPlan)
+	assert.Equal(t, []plan.File{
+		{Filename: path.Join(sharedDir, "example.json"), Change: plan.Rewrite, Added: 1, Removed: 1},
+		{Filename: path.Join(sharedDir, "foo"), Change: plan.Rewrite, Added: 1, Removed: 1},
+	}, sidecarPlan.Files())
+	assert.Empty(t, sidecarPlan.Actions())
+
+	foobytes, _ := ioutil.ReadFile(path.Join(sharedDir, "foo"))
+	assert.Equal(t, "aaaa", string(foobytes))
+}
+
+// TestDriftedOutputsRewritten ensures outputs that are removed or changed after they are written are noticed (and
+// counted) by the next sync, which writes them again. Outputs that are left alone are not rewritten.
+func TestDriftedOutputsRewritten(t *testing.T) {
+
+	const configBody = `---
+version: 3
+secrets:
+ - key: example
+   path: path/in/vault
+   missingOk: false
+   lifetime: static
+   output: example.json
+   fields:
+    - name: foo
+      output: foo
+templates:
+ - input: example.tpl
+   output: example.txt
+   lifetime: static
+`
+
+	sharedDir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(path.Join(sharedDir, "example.tpl"), []byte("foo={{.example_foo}}\n"), 0600))
+
+	vaultToken := Secret(vaultTokenJSON)
+
+	sync := func(args []string, reads int) *SyncFixture {
+		fixture := setupSyncWithDir(t, configBody, args, sharedDir)
+
+		fixture.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+		fixture.vaultClient.EXPECT().ServiceSecretPrefix(gomock.Any()).Return("/prefix/").AnyTimes()
+		fixture.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+		fixture.vaultClient.EXPECT().Read("/prefix/path/in/vault").Return(Secret(exampleSecretJSON), nil).Times(reads)
+
+		fakeClock := testing2.NewFakeClock(time.Now())
+		ctx := clock.Set(context.Background(), fakeClock)
+
+		vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+		assert.NoError(t, err)
+		err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().AddDate(1, 0, 0), *fixture.cliFlags)
+		assert.NoError(t, err)
+		return fixture
+	}
+
+	sidecar := []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}
+
+	sync([]string{"--init", "--vault-token", "unit-test-token"}, 1)
+
+	// Nothing has changed, so static secrets aren't read again.
+	fixture := sync(sidecar, 0)
+	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.OutputDrift))
+
+	jsonFile := path.Join(sharedDir, "example.json")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.Chtimes(jsonFile, past, past))
+
+	// Outputs may be read-only, so the edited template is replaced rather than written over.
+	assert.NoError(t, os.Remove(path.Join(sharedDir, "foo")))
+	assert.NoError(t, os.Remove(path.Join(sharedDir, "example.txt")))
+	assert.NoError(t, ioutil.WriteFile(path.Join(sharedDir, "example.txt"), []byte("foo=edited\n"), 0600))
+
+	fixture = sync(sidecar, 1)
+	assert.Equal(t, 2, fixture.metrics.Counter(mtrics.OutputDrift))
+
+	fooBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "foo"))
+	assert.Equal(t, "aaaa", string(fooBytes))
+	tplBytes, _ := ioutil.ReadFile(path.Join(sharedDir, "example.txt"))
+	assert.Equal(t, "foo=aaaa\n", string(tplBytes))
+
+	info, err := os.Stat(jsonFile)
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(past), "output that didn't drift should not have been rewritten")
+
+	// Once rewritten, they're left alone again.
+	fixture = sync(sidecar, 0)
+	assert.Equal(t, 0, fixture.metrics.Counter(mtrics.OutputDrift))
+}
+
+// TestDriftedLeasedOutputsRewritten ensures drifted outputs of a database credential are rewritten from the
+// credential in the briefcase, without issuing a new one, and that a drifted Vault token file is rewritten.
+func TestDriftedLeasedOutputsRewritten(t *testing.T) {
+
+	const configBody = `---
+version: 3
+vaultToken:
+  output: vault-token
+  mode: 0600
+databases:
+ - key: db
+   vaultMountPoint: database
+   vaultRole: readonly
+   mode: 0600
+   fields:
+    - name: password
+      output: db-password
+`
+
+	sharedDir := t.TempDir()
+	vaultToken := Secret(vaultTokenJSON)
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	fixture1 := setupSyncWithDir(t, configBody, []string{"--init", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture1.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture1.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+	fixture1.vaultClient.EXPECT().FetchDatabaseCredential(gomock.Any()).Return(Secret(exampleDatabaseCredentialJSON), nil).Times(1)
+
+	vtoken, err := fixture1.syncer.GetVaultToken(ctx, *fixture1.cliFlags)
+	assert.NoError(t, err)
+	err = fixture1.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture1.cliFlags)
+	assert.NoError(t, err)
+
+	passwordFile := path.Join(sharedDir, "db-password")
+	tokenFile := path.Join(sharedDir, "vault-token")
+	assert.NoError(t, os.Remove(passwordFile))
+	assert.NoError(t, os.Remove(tokenFile))
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("edited\n"), 0600))
+
+	// The credential isn't due to be renewed or issued, so only its output is written again.
+	fixture2 := setupSyncWithDir(t, configBody, []string{"--sidecar", "--one-shot", "--vault-token", "unit-test-token"}, sharedDir)
+	fixture2.vaultClient.EXPECT().VerifyVaultToken(gomock.Any()).Return(vaultToken, nil).AnyTimes()
+	fixture2.vaultClient.EXPECT().SetToken(gomock.Any()).AnyTimes()
+
+	vtoken, err = fixture2.syncer.GetVaultToken(ctx, *fixture2.cliFlags)
+	assert.NoError(t, err)
+	err = fixture2.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(5*time.Minute), *fixture2.cliFlags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, fixture2.metrics.Counter(mtrics.OutputDrift))
+
+	password, _ := ioutil.ReadFile(passwordFile)
+	assert.Equal(t, "A1a-pass", string(password))
+	token, _ := ioutil.ReadFile(tokenFile)
+	assert.Equal(t, "unit-test-token\n", string(token))
+}
+
+// TestAuthChainFallsThrough - when the first mechanism in --auth-chain fails, the next one is tried, and the token
+// it gets is used and records which mechanism got it.
+func TestAuthChainFallsThrough(t *testing.T) {
+
+	workDir := t.TempDir()
+	jwtFile := path.Join(workDir, "jwt")
+	assert.NoError(t, ioutil.WriteFile(jwtFile, []byte("signed.jwt.token\n"), 0600))
+
+	// The kubernetes service account token is missing, so that mechanism fails without contacting Vault.
+	fixture := setupSyncWithDir(t, "---\nversion: 3\n", []string{"--init",
+		"--auth-chain", "kubernetes,jwt",
+		"--k8s-auth-role", "k8s-role",
+		"--k8s-token-file", path.Join(workDir, "missing-token"),
+		"--jwt-token-file", jwtFile,
+		"--jwt-auth-role", "jwt-role"}, workDir)
+
+	var logins []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logins = append(logins, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "jwt-token", "accessor": "jwt-accessor", "lease_duration": 3600, "renewable": true}}`))
+	}))
+	defer server.Close()
+
+	delegate, err := api.NewClient(&api.Config{Address: server.URL})
+	assert.NoError(t, err)
+
+	fixture.vaultClient.EXPECT().Delegate().Return(delegate).AnyTimes()
+	fixture.vaultClient.EXPECT().SetToken("jwt-token").AnyTimes()
+
+	fakeClock := testing2.NewFakeClock(time.Now())
+	ctx := clock.Set(context.Background(), fakeClock)
+
+	vtoken, err := fixture.syncer.GetVaultToken(ctx, *fixture.cliFlags)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "jwt-token", vtoken.TokenID())
+	assert.Equal(t, []string{"/v1/auth/jwt/login"}, logins)
+
+	err = fixture.syncer.PerformSync(ctx, vtoken, fakeClock.Now().Add(time.Hour), *fixture.cliFlags)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.AuthenticationFailed))
+	assert.Equal(t, 1, fixture.metrics.Counter(mtrics.AuthenticationSucceeded))
+
+	bc, err := briefcase.LoadBriefcase(path.Join(workDir, "briefcase"), nil, testBriefcaseKeys(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "jwt", bc.AuthTokenLease.AuthMechanism)
+	assert.Equal(t, "jwt-accessor", bc.AuthTokenLease.Accessor)
+}
@@ -41,6 +41,14 @@ func main() {
 
 	log.Debug().Interface("flags", flags).Msg("cli flags")
 
+	if flags.PerformPlan {
+		if err := PerformPlan(context.Background(), *flags); err != nil {
+			fmt.Printf("Plan failed: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	switch flags.RunMode() {
 	case util.ModeShowVersion:
 		fmt.Printf("Version: %s\n", buildVersion)
@@ -57,9 +65,34 @@ func main() {
 		if err := PerformOneShotSidecar(context.Background(), *flags); err != nil {
 			panic(err)
 		}
+	case util.ModeExec:
+		exitCode, err := PerformExec(context.Background(), *flags)
+		if err != nil {
+			fmt.Printf("Exec failed: %s\n", err)
+		}
+		os.Exit(exitCode)
 	case util.ModeCleanup:
 		if err := PerformCleanup(*flags); err != nil {
 			fmt.Printf("Cleanup failed: %s\n", err)
+			os.Exit(1)
+		}
+	case util.ModeValidate:
+		valid, err := PerformValidate(*flags, os.Stdout)
+		if err != nil {
+			fmt.Printf("Validate failed: %s\n", err)
+			os.Exit(1)
+		}
+		if !valid {
+			os.Exit(1)
+		}
+	case util.ModeStatus:
+		healthy, err := PerformStatus(context.Background(), *flags, os.Stdout)
+		if err != nil {
+			fmt.Printf("Status failed: %s\n", err)
+			os.Exit(1)
+		}
+		if !healthy {
+			os.Exit(1)
 		}
 	case util.ModeUnknown:
 		panic("unknown run mode")
@@ -17,7 +17,16 @@ type MetricName string
 const BriefcaseReset MetricName = "BriefcaseReset"
 const VaultTokenWritten MetricName = "VaultTokenWritten"
 const VaultTokenRefreshed MetricName = "VaultTokenRefreshed"
+const LeaseRenewed MetricName = "LeaseRenewed"
 const SecretUpdates MetricName = "SecretUpdates"
+const SecretsUnchanged MetricName = "SecretsUnchanged"
+const OnChangeSucceeded MetricName = "OnChangeSucceeded"
+const OnChangeFailed MetricName = "OnChangeFailed"
+const VersionsHeldBack MetricName = "VersionsHeldBack"
+const BriefcaseBackupUsed MetricName = "BriefcaseBackupUsed"
+const OutputDrift MetricName = "OutputDrift"
+const AuthenticationSucceeded MetricName = "AuthenticationSucceeded"
+const AuthenticationFailed MetricName = "AuthenticationFailed"
 
 type Metrics struct {
 	mutex    sync.RWMutex
@@ -26,6 +35,11 @@ type Metrics struct {
 	SidecarSyncErrors       prometheus.Counter
 	SidecarVaultTokenErrors prometheus.Counter
 	SidecarSecretErrors     prometheus.Counter
+	Authentications         *prometheus.CounterVec
+	OnChangeHooks           *prometheus.CounterVec
+	HeldBackVersions        *prometheus.GaugeVec
+	BriefcaseBackupLoads    prometheus.Counter
+	OutputDrifts            *prometheus.CounterVec
 }
 
 func metricName(name string) string {
@@ -50,6 +64,37 @@ var (
 		Name: metricName("sidecar_secret_errors"),
 		Help: "errors while renewing secrets",
 	})
+	// Authentications is incremented each time an authentication mechanism is tried, labelled by
+	// the mechanism and whether it succeeded.
+	Authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: metricName("authentications"),
+		Help: "authentication attempts against vault by mechanism and result",
+	}, []string{"mechanism", "result"})
+	// OnChangeHooks is incremented each time an onChange hook is run after outputs change, labelled by
+	// the action taken (command or signal) and whether it succeeded.
+	OnChangeHooks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: metricName("onchange_hooks"),
+		Help: "onChange hooks run after outputs were rewritten by action and result",
+	}, []string{"action", "result"})
+	// HeldBackVersions is how many versions newer than the one written out are in Vault for each secret with a
+	// lifetime of "version", because the newest version isn't old enough to be written yet. It is zero once the
+	// outputs have caught up.
+	HeldBackVersions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: metricName("held_back_versions"),
+		Help: "newer versions of version lifetime secrets not yet written because they are too new",
+	}, []string{"key", "path"})
+	// BriefcaseBackupLoads is incremented each time the briefcase couldn't be read and the backup of the previous
+	// one was used instead.
+	BriefcaseBackupLoads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: metricName("briefcase_backup_loads"),
+		Help: "times the briefcase could not be read and its backup was used instead",
+	})
+	// OutputDrifts counts output files found removed or changed outside of the tool, which are then rewritten. The
+	// "drift" label is "missing" or "modified".
+	OutputDrifts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: metricName("output_drifts"),
+		Help: "output files found removed or changed outside of the tool",
+	}, []string{"drift"})
 )
 
 func init() {
@@ -57,6 +102,11 @@ func init() {
 		SidecarSecretErrors,
 		SidecarVaultTokenErrors,
 		SidecarSyncErrors,
+		Authentications,
+		OnChangeHooks,
+		HeldBackVersions,
+		BriefcaseBackupLoads,
+		OutputDrifts,
 	)
 }
 
@@ -67,6 +117,11 @@ func NewMetrics() *Metrics {
 		SidecarSyncErrors:       SidecarSyncErrors,
 		SidecarVaultTokenErrors: SidecarVaultTokenErrors,
 		SidecarSecretErrors:     SidecarSecretErrors,
+		Authentications:         Authentications,
+		OnChangeHooks:           OnChangeHooks,
+		HeldBackVersions:        HeldBackVersions,
+		BriefcaseBackupLoads:    BriefcaseBackupLoads,
+		OutputDrifts:            OutputDrifts,
 	}
 
 	return mtrcs
@@ -110,6 +165,54 @@ func (m *Metrics) IncrementBy(name MetricName, val int) {
 	m.counters[name] += val
 }
 
+// AuthenticationAttempt records the outcome of trying to authenticate with the named mechanism.
+func (m *Metrics) AuthenticationAttempt(mechanism string, success bool) {
+	if m == nil {
+		return
+	}
+	result := "failure"
+	name := AuthenticationFailed
+	if success {
+		result = "success"
+		name = AuthenticationSucceeded
+	}
+	m.Increment(name)
+	m.Authentications.WithLabelValues(mechanism, result).Inc()
+}
+
+// OnChangeHookRun records the outcome of running an onChange hook which took the named action.
+func (m *Metrics) OnChangeHookRun(action string, success bool) {
+	if m == nil {
+		return
+	}
+	result := "failure"
+	name := OnChangeFailed
+	if success {
+		result = "success"
+		name = OnChangeSucceeded
+	}
+	m.Increment(name)
+	m.OnChangeHooks.WithLabelValues(action, result).Inc()
+}
+
+// BriefcaseBackupLoaded records that the briefcase couldn't be read, and its backup was used instead.
+func (m *Metrics) BriefcaseBackupLoaded() {
+	if m == nil {
+		return
+	}
+	m.Increment(BriefcaseBackupUsed)
+	m.BriefcaseBackupLoads.Inc()
+}
+
+// OutputDrifted records that an output file was found removed or changed outside of the tool.
+func (m *Metrics) OutputDrifted(drift string) {
+	if m == nil {
+		return
+	}
+	m.Increment(OutputDrift)
+	m.OutputDrifts.WithLabelValues(drift).Inc()
+}
+
 // MetricsHandler instruments a prometheus metrics handler on "/metrics" and begins
 // listening on the specified address.
 func MetricsHandler(addr string, term chan os.Signal) {
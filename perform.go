@@ -2,24 +2,166 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
 	"github.com/hootsuite/vault-ctrl-tool/v2/config"
 	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
+	"github.com/hootsuite/vault-ctrl-tool/v2/supervisor"
 	"github.com/hootsuite/vault-ctrl-tool/v2/syncer"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
 	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
 	zlog "github.com/rs/zerolog/log"
 )
 
 const ShutdownFileCheckFrequency = 18 * time.Second
 
+// ExecStopTimeout is how long the command run with --exec has to exit after SIGTERM before it is killed.
+const ExecStopTimeout = 10 * time.Second
+
+// PerformPlan runs the sync of --init or --sidecar --one-shot without changing anything, then prints which files it
+// would create or rewrite and what else it would do. No files are written, the briefcase isn't saved, no credentials
+// are issued or renewed and no onChange hooks are run. It still authenticates if there is no usable Vault token.
+func PerformPlan(ctx context.Context, flags util.CliFlags) error {
+	p := plan.NewPlan()
+	ctx = plan.Set(ctx, p)
+
+	var err error
+	if flags.RunMode() == util.ModeInit {
+		err = PerformInit(ctx, flags)
+	} else {
+		err = PerformOneShotSidecar(ctx, flags)
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.Summary(os.Stdout)
+}
+
+// PerformValidate checks the configuration without contacting Vault, and writes every problem found to w. It returns
+// true if the configuration is valid.
+func PerformValidate(flags util.CliFlags, w io.Writer) (bool, error) {
+	problems := config.ValidateConfigFile(flags.ConfigFile, flags.ConfigDir, flags.InputPrefix, flags.OutputPrefix)
+
+	if flags.ValidateOutput == util.ValidateOutputJSON {
+		report := struct {
+			Valid    bool             `json:"valid"`
+			Problems []config.Problem `json:"problems"`
+		}{
+			Valid:    len(problems) == 0,
+			Problems: problems,
+		}
+		if report.Problems == nil {
+			report.Problems = []config.Problem{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return report.Valid, encoder.Encode(report)
+	}
+
+	for _, problem := range problems {
+		if _, err := fmt.Fprintln(w, problem); err != nil {
+			return false, err
+		}
+	}
+
+	if len(problems) == 0 {
+		_, err := fmt.Fprintln(w, "configuration is valid")
+		return true, err
+	}
+
+	_, err := fmt.Fprintf(w, "%d problem(s) found\n", len(problems))
+	return false, err
+}
+
+// PerformStatus writes everything tracked in the briefcase to w, without contacting Vault. It returns false if anything
+// has expired, or will expire before the next --renew-interval.
+func PerformStatus(ctx context.Context, flags util.CliFlags, w io.Writer) (bool, error) {
+	mtrics := metrics.NewMetrics()
+
+	vaultClient, err := syncer.NewVaultClient(flags)
+	if err != nil {
+		return false, err
+	}
+
+	keys, err := briefcaseKeys(flags, vaultClient, mtrics)
+	if err != nil {
+		return false, err
+	}
+
+	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, mtrics, keys)
+	if err != nil {
+		return false, err
+	}
+
+	now := clock.Now(ctx)
+	entries := bc.Status(ctx, now.Add(flags.RenewInterval))
+
+	healthy := true
+	for _, entry := range entries {
+		if entry.State != briefcase.StatusOK {
+			healthy = false
+		}
+	}
+
+	if flags.StatusOutput == util.StatusOutputJSON {
+		report := struct {
+			Healthy bool                    `json:"healthy"`
+			Entries []briefcase.StatusEntry `json:"entries"`
+		}{
+			Healthy: healthy,
+			Entries: entries,
+		}
+		if report.Entries == nil {
+			report.Entries = []briefcase.StatusEntry{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return healthy, encoder.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tSTATE\tEXPIRES\tNEXT REFRESH\tFORCED REFRESH\tDETAIL")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Kind, entry.Name, entry.State,
+			statusTime(now, entry.Expiry), statusTime(now, entry.NextRefresh), statusTime(now, entry.RefreshExpiry), entry.Detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return false, err
+	}
+
+	if healthy {
+		_, err = fmt.Fprintf(w, "%d tracked, nothing expires before the next renewal in %s\n", len(entries), flags.RenewInterval)
+	} else {
+		_, err = fmt.Fprintf(w, "%d tracked, some have expired or will expire before the next renewal in %s\n", len(entries), flags.RenewInterval)
+	}
+	return healthy, err
+}
+
+// statusTime shows a time from the briefcase along with how far away it is, so it doesn't need decoding by hand.
+func statusTime(now time.Time, t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	if t.Before(now) {
+		return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), now.Sub(*t).Round(time.Second))
+	}
+	return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), t.Sub(now).Round(time.Second))
+}
+
 func PerformOneShotSidecar(ctx context.Context, flags util.CliFlags) error {
 
 	mtrics := metrics.NewMetrics()
@@ -30,14 +172,29 @@ func PerformOneShotSidecar(ctx context.Context, flags util.CliFlags) error {
 	}
 	defer lockHandle.Unlock(false)
 
+	vaultClient, err := syncer.NewVaultClient(flags)
+	if err != nil {
+		return err
+	}
+
+	keys, err := briefcaseKeys(flags, vaultClient, mtrics)
+	if err != nil {
+		return err
+	}
+
 	zlog.Debug().Str("briefcase", flags.BriefcaseFilename).Str("buildVersion", buildVersion).Msg("starting oneshot")
-	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, mtrics)
+	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, mtrics, keys)
+	if errors.Is(err, briefcase.ErrUnsupportedSchema) {
+		// Starting an empty briefcase would replace the newer one.
+		return err
+	}
 	if err != nil {
 		zlog.Warn().Str("briefcase", flags.BriefcaseFilename).Err(err).Msg("could not load briefcase - starting an empty one")
 		bc = briefcase.NewBriefcase(mtrics)
+		bc.EncryptWith(keys)
 	}
 
-	sync, err := syncer.SetupSyncer(flags, bc, mtrics)
+	sync, err := syncer.SetupSyncer(flags, vaultClient, bc, mtrics)
 	if err != nil {
 		return err
 	}
@@ -63,14 +220,27 @@ func PerformInit(ctx context.Context, flags util.CliFlags) error {
 
 	if stat, err := os.Stat(flags.BriefcaseFilename); err == nil && stat != nil {
 		zlog.Warn().Str("filename", flags.BriefcaseFilename).Msg("running in init mode, but briefcase file already exists")
-		if flags.AuthMechanism() == util.KubernetesAuth {
+		if flags.UsesAuthMechanism(util.KubernetesAuth) {
 			zlog.Warn().Msg("running in kuberenetes - performing oneshot sidecar instead of init")
 			_ = lockHandle.Unlock(true)
 			return PerformOneShotSidecar(ctx, flags)
 		}
 	}
 
-	sync, err := syncer.SetupSyncer(flags, briefcase.NewBriefcase(mtrics), mtrics)
+	vaultClient, err := syncer.NewVaultClient(flags)
+	if err != nil {
+		return err
+	}
+
+	keys, err := briefcaseKeys(flags, vaultClient, mtrics)
+	if err != nil {
+		return err
+	}
+
+	bc := briefcase.NewBriefcase(mtrics)
+	bc.EncryptWith(keys)
+
+	sync, err := syncer.SetupSyncer(flags, vaultClient, bc, mtrics)
 
 	if err != nil {
 		return fmt.Errorf("failed to setup syncer: %w", err)
@@ -83,28 +253,30 @@ func PerformInit(ctx context.Context, flags util.CliFlags) error {
 	return sync.PerformSync(ctx, vaultToken, clock.Now(ctx).Add(24*time.Hour), flags)
 }
 
-func sidecarSync(ctx context.Context, mtrcs *metrics.Metrics, flags util.CliFlags) error {
+// sidecarSync performs a sync, carrying on from the briefcase left by the previous one (if any), and returns the
+// briefcase to carry on from next time.
+func sidecarSync(ctx context.Context, mtrcs *metrics.Metrics, flags util.CliFlags, vaultClient vaultclient.VaultClient, keys briefcase.KeySource, previous *briefcase.Briefcase) (*briefcase.Briefcase, error) {
 	lockHandle, err := util.LockFile(flags.BriefcaseFilename + ".lck")
 	if err != nil {
-		return fmt.Errorf("could not create exclusive flock: %w", err)
+		return previous, fmt.Errorf("could not create exclusive flock: %w", err)
 	}
 	defer lockHandle.Unlock(true)
 
-	sync, err := makeSyncer(flags, mtrcs)
+	sync, err := makeSyncer(flags, mtrcs, vaultClient, keys, previous)
 
 	if err != nil {
-		return fmt.Errorf("could not create syncer: %w", err)
+		return previous, fmt.Errorf("could not create syncer: %w", err)
 	}
 
 	vaultToken, err := sync.GetVaultToken(ctx, flags)
 	if err != nil {
-		return fmt.Errorf("could not get valid token: %w", err)
+		return previous, fmt.Errorf("could not get valid token: %w", err)
 	}
 	if err := sync.PerformSync(ctx, vaultToken, clock.Now(ctx).Add(flags.RenewInterval*2), flags); err != nil {
-		return fmt.Errorf("could not peform sync: %w", err)
+		return previous, fmt.Errorf("could not peform sync: %w", err)
 	}
 
-	return nil
+	return sync.Briefcase(), nil
 }
 
 // PerformSidecar runs vault-ctrl-tool in sidecar mode. Each renew interval, it will retrieve a Vault
@@ -119,13 +291,25 @@ func PerformSidecar(ctx context.Context, flags util.CliFlags) error {
 	signal.Notify(c, syscall.SIGTERM)
 
 	mtrcs := metrics.NewMetrics()
+
+	// The client and briefcase keys are kept between syncs, so the client keeps the syncer's token.
+	vaultClient, err := syncer.NewVaultClient(flags)
+	if err != nil {
+		return err
+	}
+	keys, err := briefcaseKeys(flags, vaultClient, mtrcs)
+	if err != nil {
+		return err
+	}
+
 	// if metrics server stops running then it will initiate shutdown.
 	metrics.MetricsHandler(fmt.Sprintf(":%d", flags.PrometheusPort), c)
 
 	go func() {
 		zlog.Info().Str("renewInterval", flags.RenewInterval.String()).Str("buildVersion", buildVersion).Msg("starting")
 
-		if err := sidecarSync(ctx, mtrcs, flags); err != nil {
+		synced, err := sidecarSync(ctx, mtrcs, flags, vaultClient, keys, nil)
+		if err != nil {
 			if flags.TerminateOnSyncFailure {
 				zlog.Error().Err(err).Msg("failed initial sidecar sync, terminating")
 				c <- os.Interrupt
@@ -144,7 +328,7 @@ func PerformSidecar(ctx context.Context, flags util.CliFlags) error {
 			select {
 			case <-renewTicker.C:
 				zlog.Info().Msg("heartbeat")
-				if err := sidecarSync(ctx, mtrcs, flags); err != nil {
+				if synced, err = sidecarSync(ctx, mtrcs, flags, vaultClient, keys, synced); err != nil {
 					mtrcs.SidecarSyncErrors.Inc()
 					if flags.TerminateOnSyncFailure {
 						zlog.Error().Err(err).Msg("failed sidecar sync, terminating")
@@ -171,55 +355,306 @@ func PerformSidecar(ctx context.Context, flags util.CliFlags) error {
 	return nil
 }
 
-func PerformCleanup(flags util.CliFlags) error {
+// execSync performs a sync and returns the environment to inject into the command run with --exec. The first sync
+// (without a previous briefcase) starts with an empty briefcase, as --init does, and later ones carry on from the
+// briefcase, as --sidecar does.
+func execSync(ctx context.Context, mtrcs *metrics.Metrics, flags util.CliFlags, vaultClient vaultclient.VaultClient, keys briefcase.KeySource, previous *briefcase.Briefcase) (*syncer.Syncer, []string, error) {
+	lockHandle, err := util.LockFile(flags.BriefcaseFilename + ".lck")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create exclusive flock: %w", err)
+	}
+	defer lockHandle.Unlock(true)
 
-	log := zlog.With().Str("configFile", flags.ConfigFile).Str("briefcase", flags.BriefcaseFilename).Logger()
+	var sync *syncer.Syncer
+	if previous == nil {
+		bc := briefcase.NewBriefcase(mtrcs)
+		bc.EncryptWith(keys)
+		sync, err = syncer.SetupSyncer(flags, vaultClient, bc, mtrcs)
+	} else {
+		sync, err = makeSyncer(flags, mtrcs, vaultClient, keys, previous)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create syncer: %w", err)
+	}
 
-	log.Info().Msg("performing cleanup")
+	vaultToken, err := sync.GetVaultToken(ctx, flags)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get valid token: %w", err)
+	}
+	if err := sync.PerformSync(ctx, vaultToken, clock.Now(ctx).Add(flags.RenewInterval*2), flags); err != nil {
+		return nil, nil, fmt.Errorf("could not peform sync: %w", err)
+	}
 
-	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, nil)
+	env, err := sync.Environment()
 	if err != nil {
-		log.Warn().Err(err).Msg("could not open briefcase")
-	} else {
+		return nil, nil, fmt.Errorf("could not determine environment for command: %w", err)
+	}
+
+	return sync, env, nil
+}
+
+// PerformExec runs vault-ctrl-tool in exec mode. It syncs like --init, then runs the command with the configured
+// secrets in its environment and keeps syncing in the background like --sidecar. Signals are forwarded to the
+// command. If the injected values change, the command is restarted (or sent the configured signal instead). It
+// returns the exit code of the command once it exits.
+func PerformExec(ctx context.Context, flags util.CliFlags) (int, error) {
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	mtrcs := metrics.NewMetrics()
+	// if metrics server stops running then it will initiate shutdown. It gets its own channel, as signals on "c"
+	// are forwarded to the command rather than stopping it.
+	metricsStopped := make(chan os.Signal, 1)
+	metrics.MetricsHandler(fmt.Sprintf(":%d", flags.PrometheusPort), metricsStopped)
+
+	log := zlog.With().Str("command", flags.ExecCommand[0]).Logger()
+	log.Info().Str("renewInterval", flags.RenewInterval.String()).Str("buildVersion", buildVersion).Msg("starting")
+
+	// The client and briefcase keys are kept between syncs, so the client keeps the syncer's token.
+	vaultClient, err := syncer.NewVaultClient(flags)
+	if err != nil {
+		return 1, err
+	}
+	keys, err := briefcaseKeys(flags, vaultClient, mtrcs)
+	if err != nil {
+		return 1, err
+	}
+
+	sync, env, err := execSync(ctx, mtrcs, flags, vaultClient, keys, nil)
+	if err != nil {
+		return 1, err
+	}
+
+	var changeSignal os.Signal
+	if name := sync.ExecConfig().Signal; name != "" {
+		// validated when the config is read
+		changeSignal, _ = util.ParseSignal(name)
+	}
 
-		if flags.RevokeOnCleanup && bc.AuthTokenLease.Token != "" {
-			vaultClient, err := vaultclient.NewVaultClient(flags.ServiceSecretPrefix, flags.VaultClientTimeout, flags.VaultClientRetries)
+	child, err := supervisor.Start(flags.ExecCommand, append(os.Environ(), env...))
+	if err != nil {
+		return 1, err
+	}
+
+	renewTicker := time.NewTicker(flags.RenewInterval)
+	defer renewTicker.Stop()
+
+	jobCompletionTicker := time.NewTicker(ShutdownFileCheckFrequency)
+	defer jobCompletionTicker.Stop()
+
+	for {
+		select {
+		case <-child.Done():
+			log.Info().Int("exitCode", child.ExitCode()).Msg("command exited")
+			return child.ExitCode(), nil
+		case sig := <-c:
+			log.Info().Stringer("signal", sig).Msg("forwarding signal to command")
+			if err := child.Signal(sig); err != nil {
+				log.Warn().Err(err).Stringer("signal", sig).Msg("could not forward signal to command")
+			}
+		case <-metricsStopped:
+			log.Error().Msg("metrics server stopped, stopping command and terminating")
+			child.Stop(ExecStopTimeout)
+			return 1, errors.New("metrics server stopped")
+		case <-renewTicker.C:
+			zlog.Info().Msg("heartbeat")
+			newSync, newEnv, err := execSync(ctx, mtrcs, flags, vaultClient, keys, sync.Briefcase())
 			if err != nil {
-				log.Error().Err(err).Msg("could not create new vault client to revoke token")
+				mtrcs.SidecarSyncErrors.Inc()
+				if flags.TerminateOnSyncFailure {
+					log.Error().Err(err).Msg("failed sync, stopping command and terminating")
+					child.Stop(ExecStopTimeout)
+					return 1, err
+				}
+				log.Error().Err(err).Msg("failed sync")
+				continue
+			}
+			sync = newSync
+
+			if equalEnvironments(env, newEnv) {
+				continue
+			}
+			env = newEnv
+
+			if changeSignal != nil {
+				log.Info().Stringer("signal", changeSignal).Msg("injected secrets changed, signalling command")
+				if err := child.Signal(changeSignal); err != nil {
+					log.Warn().Err(err).Msg("could not signal command")
+				}
 			} else {
-				vaultClient.SetToken(bc.AuthTokenLease.Token)
-				if err := vaultClient.Delegate().Auth().Token().RevokeSelf("ignored"); err != nil {
-					log.Warn().Err(err).Msg("unable to revoke vault token")
+				log.Info().Msg("injected secrets changed, restarting command")
+				if err := child.Restart(append(os.Environ(), env...), ExecStopTimeout); err != nil {
+					return 1, err
+				}
+			}
+		case <-jobCompletionTicker.C:
+			if flags.ShutdownTriggerFile != "" {
+				zlog.Debug().Str("triggerFile", flags.ShutdownTriggerFile).Msg("performing completion check against file")
+				if _, err := os.Stat(flags.ShutdownTriggerFile); err == nil {
+					zlog.Info().Str("triggerFile", flags.ShutdownTriggerFile).Msg("trigger file present; stopping command")
+					child.Stop(ExecStopTimeout)
 				}
 			}
 		}
+	}
+}
 
-		if err := os.Remove(flags.BriefcaseFilename); err != nil {
-			log.Warn().Err(err).Msg("could not remove briefcase")
+func equalEnvironments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
 	}
+	return true
+}
+
+func PerformCleanup(flags util.CliFlags) error {
+
+	log := zlog.With().Str("configFile", flags.ConfigFile).Str("briefcase", flags.BriefcaseFilename).Logger()
+
+	log.Info().Msg("performing cleanup")
+
+	// The configuration is needed to reach other Vault connections when revoking.
+	cfg, cfgErr := config.ReadConfigFile(flags.ConfigFile, flags.ConfigDir, flags.InputPrefix, flags.OutputPrefix)
+
+	var revokeErr error
+
+	// The outputs are removed even if the briefcase can't be read, such as when its key has gone along with the
+	// secret volume in a preStop hook. Only a transit key needs a Vault client to read it.
+	var vaultClient vaultclient.VaultClient
+	var keys briefcase.KeySource
+	var err error
+
+	if flags.BriefcaseTransitKey != "" {
+		vaultClient, err = syncer.NewVaultClient(flags)
+	}
+	if err == nil {
+		keys, err = briefcaseKeys(flags, vaultClient, nil)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("could not get briefcase keys")
+	}
 
-	cfg, err := config.ReadConfigFile(flags.ConfigFile, flags.ConfigDir, flags.InputPrefix, flags.OutputPrefix)
+	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, nil, keys)
 	if err != nil {
+		log.Warn().Err(err).Msg("could not open briefcase")
+	} else if flags.RevokeOnCleanup {
+		revokeErr = revokeBriefcase(flags, cfg, bc)
+	}
+
+	if err := os.Remove(flags.BriefcaseFilename); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("could not remove briefcase")
+	}
+
+	if err := os.Remove(briefcase.BackupFilename(flags.BriefcaseFilename)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("could not remove briefcase backup")
+	}
+
+	if cfgErr != nil {
 		log.Warn().Msg("could not read config file - unsure what to cleanup")
-		return fmt.Errorf("could not read config file %q: %w", flags.ConfigFile, err)
+		return fmt.Errorf("could not read config file %q: %w", flags.ConfigFile, cfgErr)
 	}
 
 	cfg.VaultConfig.Cleanup()
 
+	if revokeErr != nil {
+		log.Error().Err(revokeErr).Msg("cleanup finished, but not everything could be revoked")
+		return revokeErr
+	}
+
 	log.Info().Msg("cleanup finished")
 
 	return nil
 }
 
-func makeSyncer(flags util.CliFlags, mtrcs *metrics.Metrics) (*syncer.Syncer, error) {
-	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, mtrcs)
+// revokeBriefcase revokes every lease in the briefcase, then the vault tokens themselves. Tokens go last as revoking
+// a token also revokes its leases, which would hide failures revoking them individually.
+func revokeBriefcase(flags util.CliFlags, cfg *config.ControlToolConfig, bc *briefcase.Briefcase) error {
+	log := zlog.With().Str("briefcase", flags.BriefcaseFilename).Logger()
+
+	clients := make(map[string]vaultclient.VaultClient)
+
+	clientFor := func(connection string) (vaultclient.VaultClient, error) {
+		if vaultClient, ok := clients[connection]; ok {
+			return vaultClient, nil
+		}
+
+		token := bc.AuthToken(connection).Token
+		if token == "" {
+			return nil, fmt.Errorf("no vault token for connection %q in briefcase", connection)
+		}
+
+		var vaultClient vaultclient.VaultClient
+		var err error
+
+		if connection == "" {
+			vaultClient, err = vaultclient.NewVaultClient(flags.ServiceSecretPrefix, flags.VaultNamespace, flags.VaultClientTimeout, flags.VaultClientRetries)
+		} else {
+			if cfg == nil {
+				return nil, fmt.Errorf("no configuration available for vault connection %q", connection)
+			}
+			conn, ok := cfg.VaultConfig.Connection(connection)
+			if !ok {
+				return nil, fmt.Errorf("vault connection %q is not in the configuration", connection)
+			}
+			vaultClient, err = vaultclient.NewConnectionVaultClient(conn, flags.ServiceSecretPrefix, flags.VaultClientTimeout, flags.VaultClientRetries)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		vaultClient.SetToken(token)
+		clients[connection] = vaultClient
+		return vaultClient, nil
+	}
+
+	leasesErr := syncer.RevokeLeases(log, bc, clientFor)
+
+	connections := []string{""}
+	for connection := range bc.ConnectionTokenLeases {
+		connections = append(connections, connection)
+	}
+
+	for _, connection := range connections {
+		if bc.AuthToken(connection).Token == "" {
+			continue
+		}
+
+		vaultClient, err := clientFor(connection)
+		if err != nil {
+			log.Error().Err(err).Str("connection", connection).Msg("could not create new vault client to revoke token")
+			continue
+		}
+
+		if err := vaultClient.Delegate().Auth().Token().RevokeSelf("ignored"); err != nil {
+			log.Warn().Err(err).Str("connection", connection).Msg("unable to revoke vault token")
+		}
+	}
+
+	return leasesErr
+}
+
+func makeSyncer(flags util.CliFlags, mtrcs *metrics.Metrics, vaultClient vaultclient.VaultClient, keys briefcase.KeySource, previous *briefcase.Briefcase) (*syncer.Syncer, error) {
+	bc, err := briefcase.LoadBriefcase(flags.BriefcaseFilename, mtrcs, keys)
+	if errors.Is(err, briefcase.ErrUnsupportedSchema) {
+		// Starting an empty briefcase would replace the newer one.
+		return nil, err
+	}
 	if err != nil {
 		zlog.Warn().Str("briefcase", flags.BriefcaseFilename).Err(err).Msg("could not load briefcase - starting an empty one")
 		bc = briefcase.NewBriefcase(mtrcs)
+		bc.EncryptWith(keys)
+	}
+	if previous != nil {
+		bc.RestoreLeaseData(previous)
 	}
 
-	sync, err := syncer.SetupSyncer(flags, bc, mtrcs)
+	sync, err := syncer.SetupSyncer(flags, vaultClient, bc, mtrcs)
 	if err != nil {
 		return nil, err
 	}
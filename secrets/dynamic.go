@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// WriteDynamicSecret writes the fields of a dynamic secret to their outputs, and all of its fields as JSON to the
+// output of the stanza if there is one, counting which files changed.
+func WriteDynamicSecret(ctx context.Context, dyn config.DynamicType, kvSecrets []briefcase.SimpleSecret) (Written, error) {
+	written, err := WriteSecretFields(ctx, config.SecretType{
+		Key:    dyn.Key,
+		Fields: dyn.Fields,
+		Mode:   dyn.Mode,
+		Owner:  dyn.Owner,
+		Group:  dyn.Group,
+	}, kvSecrets)
+	if err != nil {
+		return written, err
+	}
+
+	if dyn.Output == "" {
+		return written, nil
+	}
+
+	mode, err := util.StringToFileMode(dyn.Mode)
+	if err != nil {
+		return written, fmt.Errorf("could not parse file mode %q for key %q: %w", dyn.Mode, dyn.Key, err)
+	}
+
+	owner, err := util.LookupFileOwner(dyn.Owner, dyn.Group)
+	if err != nil {
+		return written, fmt.Errorf("could not find owner for %q: %w", dyn.Output, err)
+	}
+
+	data := make(map[string]interface{})
+	for _, s := range kvSecrets {
+		if s.Key == dyn.Key {
+			data[s.Field] = s.Value
+		}
+	}
+
+	var contents bytes.Buffer
+	if err := json.NewEncoder(&contents).Encode(&data); err != nil {
+		return written, fmt.Errorf("failed to save dynamic secret into %q: %w", dyn.Output, err)
+	}
+
+	changed, err := writeFileIfChanged(ctx, dyn.Output, *mode, *owner, contents.Bytes())
+	if err != nil {
+		return written, err
+	}
+
+	zlog.Info().Str("key", dyn.Key).Str("output", dyn.Output).Bool("changed", changed).Msg("writing dynamic secret to file")
+
+	written.Record(changed)
+	return written, nil
+}
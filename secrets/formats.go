@@ -0,0 +1,222 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"gopkg.in/yaml.v2"
+)
+
+var dotenvNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var tomlBareKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// encodeSecrets renders the collected secrets of a composite in the format. Keys are always sorted, so the same
+// secrets always produce the same contents.
+func encodeSecrets(format string, data map[string]interface{}) ([]byte, error) {
+	switch format {
+	case util.FormatYAML:
+		return yaml.Marshal(data)
+	case util.FormatDotenv:
+		return encodeDotenv(data)
+	case util.FormatProperties:
+		return encodeProperties(data), nil
+	case util.FormatTOML:
+		return encodeTOML(data)
+	case "", util.FormatJSON:
+		var contents bytes.Buffer
+		if err := json.NewEncoder(&contents).Encode(&data); err != nil {
+			return nil, err
+		}
+		return contents.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func sortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scalarString is how a value is written in formats that only have strings. Values that aren't strings, numbers or
+// booleans (objects stored in the KV store) are written as JSON.
+func scalarString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number, bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}
+}
+
+// encodeDotenv writes KEY="value" lines. Values are double quoted with backslash escapes, and "$" and "`" are
+// escaped so sourcing the file in a shell doesn't expand them. Newlines are written as \n, which dotenv
+// libraries turn back into newlines.
+func encodeDotenv(data map[string]interface{}) ([]byte, error) {
+	var contents strings.Builder
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", `\n`, "\r", `\r`)
+
+	for _, key := range sortedKeys(data) {
+		if !dotenvNameRegex.MatchString(key) {
+			return nil, fmt.Errorf("%q cannot be a dotenv variable name; names must be letters, digits and underscores, and not start with a digit", key)
+		}
+
+		value, err := scalarString(data[key])
+		if err != nil {
+			return nil, fmt.Errorf("could not encode %q: %w", key, err)
+		}
+
+		fmt.Fprintf(&contents, "%s=\"%s\"\n", key, escaper.Replace(value))
+	}
+
+	return []byte(contents.String()), nil
+}
+
+// encodeProperties writes key=value lines as read by java.util.Properties. Properties files are ISO-8859-1, so
+// anything outside of printable ASCII is written as a \uXXXX escape.
+func encodeProperties(data map[string]interface{}) []byte {
+	var contents strings.Builder
+
+	for _, key := range sortedKeys(data) {
+		// Values that can't be encoded as JSON can't come out of Vault either, so the error is impossible.
+		value, _ := scalarString(data[key])
+
+		contents.WriteString(escapeProperty(key, true))
+		contents.WriteString("=")
+		contents.WriteString(escapeProperty(value, false))
+		contents.WriteString("\n")
+	}
+
+	return []byte(contents.String())
+}
+
+func escapeProperty(s string, isKey bool) string {
+	var escaped strings.Builder
+
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			escaped.WriteString(`\\`)
+		case r == '\n':
+			escaped.WriteString(`\n`)
+		case r == '\r':
+			escaped.WriteString(`\r`)
+		case r == '\t':
+			escaped.WriteString(`\t`)
+		case r == '\f':
+			escaped.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			// Spaces end keys, and leading spaces of values are skipped.
+			escaped.WriteString(`\ `)
+		case isKey && (r == '=' || r == ':' || r == '#' || r == '!'):
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&escaped, `\u%04x`, unit)
+			}
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+
+	return escaped.String()
+}
+
+// encodeTOML writes a flat TOML table. Strings, numbers and booleans keep their types, and anything else is
+// written as a string of JSON.
+func encodeTOML(data map[string]interface{}) ([]byte, error) {
+	var contents strings.Builder
+
+	for _, key := range sortedKeys(data) {
+		var value string
+
+		switch v := data[key].(type) {
+		case bool:
+			value = strconv.FormatBool(v)
+		case json.Number:
+			if _, err := v.Int64(); err == nil {
+				value = v.String()
+			} else if f, err := v.Float64(); err == nil {
+				value = strconv.FormatFloat(f, 'g', -1, 64)
+			} else {
+				value = quoteTOML(v.String())
+			}
+		case int, int64:
+			value = fmt.Sprint(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			s, err := scalarString(v)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode %q: %w", key, err)
+			}
+			value = quoteTOML(s)
+		}
+
+		if tomlBareKeyRegex.MatchString(key) {
+			contents.WriteString(key)
+		} else {
+			contents.WriteString(quoteTOML(key))
+		}
+		contents.WriteString(" = ")
+		contents.WriteString(value)
+		contents.WriteString("\n")
+	}
+
+	return []byte(contents.String()), nil
+}
+
+// quoteTOML makes a TOML basic string, escaping quotes, backslashes and control characters.
+func quoteTOML(s string) string {
+	var quoted strings.Builder
+
+	quoted.WriteRune('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			quoted.WriteString(`\"`)
+		case '\\':
+			quoted.WriteString(`\\`)
+		case '\n':
+			quoted.WriteString(`\n`)
+		case '\r':
+			quoted.WriteString(`\r`)
+		case '\t':
+			quoted.WriteString(`\t`)
+		case '\b':
+			quoted.WriteString(`\b`)
+		case '\f':
+			quoted.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&quoted, `\u%04X`, r)
+			} else {
+				quoted.WriteRune(r)
+			}
+		}
+	}
+	quoted.WriteRune('"')
+
+	return quoted.String()
+}
@@ -1,8 +1,8 @@
 package secrets
 
 import (
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"os"
 
@@ -13,21 +13,13 @@ import (
 	zlog "github.com/rs/zerolog/log"
 )
 
-func WriteComposite(composite config.CompositeSecretFile, cache briefcase.SecretsCache) error {
+// WriteComposite writes the secrets of a composite in its format, if that differs from what is already in the file.
+// It returns true if the file was written.
+func WriteComposite(ctx context.Context, composite config.CompositeSecretFile, cache briefcase.SecretsCache) (bool, error) {
 	log := zlog.With().Str("filename", composite.Filename).Logger()
 
 	log.Debug().Interface("compositeCfg", composite).Msg("writing composite secrets file")
 
-	util.MustMkdirAllForFile(composite.Filename)
-
-	file, err := os.OpenFile(composite.Filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, composite.Mode)
-
-	if err != nil {
-		return fmt.Errorf("couldn't open file %q: %w", composite.Filename, err)
-	}
-
-	defer file.Close()
-
 	var kvSecrets []briefcase.SimpleSecret
 
 	// make a copy
@@ -41,79 +33,83 @@ func WriteComposite(composite config.CompositeSecretFile, cache briefcase.Secret
 	data, err := collectSecrets(log, composite, kvSecrets)
 
 	if err != nil {
-		return fmt.Errorf("could not output secrets file: %w", err)
+		return false, fmt.Errorf("could not output secrets file: %w", err)
 	}
 
+	var contents []byte
+
 	if len(data) > 0 {
-		err = json.NewEncoder(file).Encode(&data)
+		contents, err = encodeSecrets(composite.Format, data)
 
 		if err != nil {
-			return fmt.Errorf("failed to save secrets into %q: %w", composite.Filename, err)
+			return false, fmt.Errorf("failed to save secrets into %q: %w", composite.Filename, err)
 		}
 	}
 
-	return nil
+	return writeFileIfChanged(ctx, composite.Filename, composite.Mode, composite.Owner, contents)
 }
 
-func WriteSecretFields(secret config.SecretType, kvSecrets []briefcase.SimpleSecret) (int, error) {
+// WriteSecretFields writes each field of the secret that has an output, counting which files changed.
+func WriteSecretFields(ctx context.Context, secret config.SecretType, kvSecrets []briefcase.SimpleSecret) (Written, error) {
+	var written Written
+
 	mode, err := util.StringToFileMode(secret.Mode)
-	count := 0
 
 	if err != nil {
-		return count, fmt.Errorf("could not parse file mode %q for key %q: %w",
+		return written, fmt.Errorf("could not parse file mode %q for key %q: %w",
 			secret.Mode, secret.Key, err)
 	}
 
 	// output all the field files
 	for _, field := range secret.Fields {
 		if field.Output != "" {
-			if err := writeField(secret, kvSecrets, field, *mode); err != nil {
-				return count, err
+			changed, err := writeField(ctx, secret, kvSecrets, field, *mode)
+			if err != nil {
+				return written, err
 			}
-			count++
+			written.Record(changed)
 		}
 	}
-	return count, nil
+	return written, nil
 }
 
-func writeField(secret config.SecretType, kvSecrets []briefcase.SimpleSecret, field config.SecretFieldType, mode os.FileMode) error {
+func writeField(ctx context.Context, secret config.SecretType, kvSecrets []briefcase.SimpleSecret, field config.SecretFieldType, mode os.FileMode) (bool, error) {
 	value := findSimpleSecretValue(kvSecrets, secret.Key, field.Name)
 
 	if value == nil {
 		if secret.IsMissingOk {
 			zlog.Warn().Str("field", field.Name).Str("key", secret.Key).Str("output", field.Output).Msg("no secret found with key and missingOk=true, so no output will be written")
-		} else {
-			return fmt.Errorf("field %q not found in secret with key %q", field.Name, secret.Key)
+			return false, nil
 		}
+		return false, fmt.Errorf("field %q not found in secret with key %q", field.Name, secret.Key)
+	}
 
-	} else {
-		util.MustMkdirAllForFile(field.Output)
+	var contents []byte
 
-		file, err := os.OpenFile(field.Output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	switch field.Encoding {
+	case util.EncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(fmt.Sprint(value))
 		if err != nil {
-			return fmt.Errorf("couldn't open file %q: %w", field.Output, err)
+			return false, fmt.Errorf("failed to base64 decode field %q for secret %q: %w", field.Name, secret.Key, err)
 		}
+		contents = decoded
+	default:
+		contents = []byte(fmt.Sprint(value))
+	}
 
-		defer file.Close()
-
-		zlog.Info().Str("field", field.Name).Str("key", secret.Key).Str("output", field.Output).Str("encoding", field.Encoding).Msg("writing field to file")
+	owner, err := util.LookupFileOwner(field.FileOwner(secret))
+	if err != nil {
+		return false, fmt.Errorf("could not find owner for field %q of secret %q: %w", field.Name, secret.Key, err)
+	}
 
-		switch field.Encoding {
-		case util.EncodingBase64:
-			decoded, err := base64.StdEncoding.DecodeString(fmt.Sprint(value))
-			if err != nil {
-				return fmt.Errorf("failed to base64 decode field %q for secret %q: %w", field.Name, secret.Key, err)
-			}
-			_, err = fmt.Fprint(file, string(decoded))
-		default:
-			_, err = fmt.Fprint(file, value)
-		}
-		if err != nil {
-			return fmt.Errorf("failed writing secret to file %q: %w", field.Output, err)
-		}
+	changed, err := writeFileIfChanged(ctx, field.Output, mode, *owner, contents)
+	if err != nil {
+		return false, fmt.Errorf("failed writing secret to file %q: %w", field.Output, err)
 	}
 
-	return nil
+	zlog.Info().Str("field", field.Name).Str("key", secret.Key).Str("output", field.Output).Str("encoding", field.Encoding).Bool("changed", changed).Msg("writing field to file")
+
+	return changed, nil
 }
 
 func findSimpleSecretValue(secrets []briefcase.SimpleSecret, key, field string) interface{} {
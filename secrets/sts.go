@@ -1,8 +1,8 @@
 package secrets
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -12,80 +12,48 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func WriteAWSSTSCreds(creds *vaultclient.AWSSTSCredential, awsConfig config.AWSType) error {
+// WriteAWSSTSCreds writes the AWS config and credentials files for the credentials, skipping either file if its
+// contents would not change.
+func WriteAWSSTSCreds(ctx context.Context, creds *vaultclient.AWSSTSCredential, awsConfig config.AWSType) (Written, error) {
+	var written Written
 
 	mode, err := util.StringToFileMode(awsConfig.Mode)
 	if err != nil {
-		return fmt.Errorf("could not parse %q as a file mode: %w", mode, err)
+		return written, fmt.Errorf("could not parse %q as a file mode: %w", mode, err)
 	}
 
-	wipCfgFilename := filepath.Join(awsConfig.OutputPath, "config.wip")
-	wipCredsFilename := filepath.Join(awsConfig.OutputPath, "credentials.wip")
-
-	util.MustMkdirAllForFile(wipCfgFilename)
-
-	if err := writeWIPFiles(wipCfgFilename, wipCredsFilename, creds, awsConfig.Profile, awsConfig.Region, *mode); err != nil {
-		_ = os.Remove(wipCredsFilename)
-		_ = os.Remove(wipCredsFilename)
-		return err
-	}
-
-	cfgFilename := strings.TrimSuffix(wipCfgFilename, ".wip")
-	credsFilename := strings.TrimSuffix(wipCredsFilename, ".wip")
-
-	log.Debug().Strs("filenames", []string{wipCfgFilename, cfgFilename, wipCredsFilename, credsFilename}).Msg("atomically renaming .wip files")
-	err = os.Rename(wipCfgFilename, cfgFilename)
-	if err != nil {
-		return err
-	}
-
-	err = os.Rename(wipCredsFilename, credsFilename)
+	owner, err := util.LookupFileOwner(awsConfig.Owner, awsConfig.Group)
 	if err != nil {
-		return err
+		return written, fmt.Errorf("could not find owner for AWS credentials in %q: %w", awsConfig.OutputPath, err)
 	}
-	return nil
-}
-
-func writeWIPFiles(configFilename, credentialsFilename string,
-	creds *vaultclient.AWSSTSCredential,
-	awsProfile, awsRegion string,
-	mode os.FileMode) error {
-
-	log.Debug().Str("awsConfig", configFilename).Str("awsCredentials", credentialsFilename).Msg("writing AWS files")
-
-	util.MustMkdirAllForFile(configFilename)
 
-	configFile, err := os.OpenFile(configFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, mode)
+	header := strings.TrimSpace(awsConfig.Profile)
 
-	if err != nil {
-		return fmt.Errorf("could not create aws config file at %q: %w", configFilename, err)
-	}
-	defer configFile.Close()
-
-	credsFile, err := os.OpenFile(credentialsFilename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, mode)
-
-	if err != nil {
-		return fmt.Errorf("could not create aws credentials file at %q: %w", credentialsFilename, err)
-	}
-	defer credsFile.Close()
-
-	header := strings.TrimSpace(awsProfile)
-
-	_, err = fmt.Fprintf(credsFile, `[%s]
+	cfgContents := []byte(fmt.Sprintf("[%s]\nregion=%s\n\n", header, awsConfig.Region))
+	credsContents := []byte(fmt.Sprintf(`[%s]
 aws_access_key_id=%s
 aws_secret_access_key=%s
 aws_session_token=%s
 
 `,
-		header, creds.AccessKey, creds.SecretKey, creds.SessionToken)
-	if err != nil {
-		return fmt.Errorf("could not write contents to %q: %w", credentialsFilename, err)
+		header, creds.AccessKey, creds.SecretKey, creds.SessionToken))
+
+	files := []struct {
+		filename string
+		contents []byte
+	}{
+		{filepath.Join(awsConfig.OutputPath, "config"), cfgContents},
+		{filepath.Join(awsConfig.OutputPath, "credentials"), credsContents},
 	}
 
-	_, err = fmt.Fprintf(configFile, "[%s]\nregion=%s\n\n", header, awsRegion)
-	if err != nil {
-		return fmt.Errorf("could not write contents to %q: %w", configFilename, err)
+	for _, file := range files {
+		changed, err := writeFileIfChanged(ctx, file.filename, *mode, *owner, file.contents)
+		if err != nil {
+			return written, err
+		}
+		log.Debug().Str("filename", file.filename).Bool("changed", changed).Msg("writing AWS file")
+		written.Record(changed)
 	}
 
-	return nil
+	return written, nil
 }
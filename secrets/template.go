@@ -1,8 +1,9 @@
 package secrets
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"os"
 	"text/template"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
@@ -11,7 +12,9 @@ import (
 	zlog "github.com/rs/zerolog/log"
 )
 
-func WriteTemplate(tpl config.TemplateType, templates map[string]*template.Template, cache briefcase.SecretsCache) error {
+// WriteTemplate renders the template, and writes it to its output if the result differs from what is already
+// there. It returns true if the output was written.
+func WriteTemplate(ctx context.Context, tpl config.TemplateType, templates map[string]*template.Template, cache briefcase.SecretsCache) (bool, error) {
 
 	log := zlog.With().Str("output", tpl.Output).Logger()
 
@@ -31,31 +34,39 @@ func WriteTemplate(tpl config.TemplateType, templates map[string]*template.Templ
 		}
 	}
 
+	if tpl.Lifetime == util.LifetimeVersion {
+		for _, s := range cache.GetSecrets(util.LifetimeVersion) {
+			tplVars[s.Key+"_"+s.Field] = s.Value
+		}
+	}
+
 	if len(tplVars) == 0 {
 		log.Warn().Msg("no template variables found. this can be because your secrets are missing and missingOk=true, or if lifetimes of your secrets and template aren't right")
 	}
 
 	mode, err := util.StringToFileMode(tpl.Mode)
 	if err != nil {
-		return fmt.Errorf("could not parse file mode %q for template %q: %w", tpl.Mode, tpl.Input, err)
+		return false, fmt.Errorf("could not parse file mode %q for template %q: %w", tpl.Mode, tpl.Input, err)
 	}
 
-	log.Info().Str("input", tpl.Input).Msg("resolving template")
-
-	util.MustMkdirAllForFile(tpl.Output)
-
-	file, err := os.OpenFile(tpl.Output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, *mode)
+	owner, err := util.LookupFileOwner(tpl.Owner, tpl.Group)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("could not find owner for template %q: %w", tpl.Input, err)
 	}
 
-	if err := templates[tpl.Input].Option("missingkey=error").Execute(file, tplVars); err != nil {
-		return fmt.Errorf("failed to write template %q: %w", tpl.Output, err)
+	log.Info().Str("input", tpl.Input).Msg("resolving template")
+
+	var rendered bytes.Buffer
+	if err := templates[tpl.Input].Option("missingkey=error").Execute(&rendered, tplVars); err != nil {
+		return false, fmt.Errorf("failed to write template %q: %w", tpl.Output, err)
 	}
 
-	_ = file.Close()
+	changed, err := writeFileIfChanged(ctx, tpl.Output, *mode, *owner, rendered.Bytes())
+	if err != nil {
+		return false, err
+	}
 
-	log.Debug().Msg("done executing template")
+	log.Debug().Bool("changed", changed).Msg("done executing template")
 
-	return nil
+	return changed, nil
 }
@@ -1,16 +1,17 @@
 package secrets
 
 import (
+	"context"
 	"fmt"
-	"os"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/config"
 	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
 	zlog "github.com/rs/zerolog/log"
 )
 
-func WriteVaultToken(m *metrics.Metrics, tokenCfg config.VaultTokenType, vaultToken string) error {
+func WriteVaultToken(ctx context.Context, m *metrics.Metrics, tokenCfg config.VaultTokenType, vaultToken string) error {
 
 	if tokenCfg.Output == "" {
 		zlog.Warn().Interface("tokenCfg", tokenCfg).Msg("no output file specified to write vault token")
@@ -25,18 +26,19 @@ func WriteVaultToken(m *metrics.Metrics, tokenCfg config.VaultTokenType, vaultTo
 		return fmt.Errorf("could not parse file mode %q for %q: %w", tokenCfg.Mode, tokenCfg.Output, err)
 	}
 
-	util.MustMkdirAllForFile(tokenCfg.Output)
-
-	file, err := os.OpenFile(tokenCfg.Output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, *mode)
+	owner, err := util.LookupFileOwner(tokenCfg.Owner, tokenCfg.Group)
 	if err != nil {
-		return fmt.Errorf("failed to create Vault token file %q: %w", tokenCfg.Output, err)
+		return fmt.Errorf("could not find owner for %q: %w", tokenCfg.Output, err)
 	}
 
-	defer file.Close()
+	if p := plan.Get(ctx); p != nil {
+		p.File(tokenCfg.Output, *mode, *owner, []byte(vaultToken+"\n"))
+		return nil
+	}
 
-	_, err = fmt.Fprintf(file, "%s\n", vaultToken)
+	util.MustMkdirAllForFileOwned(tokenCfg.Output, *owner)
 
-	if err != nil {
+	if err := util.WriteFileAtomic(tokenCfg.Output, []byte(vaultToken+"\n"), *mode, *owner); err != nil {
 		return fmt.Errorf("failed to create Vault token file %q: %w", tokenCfg.Output, err)
 	}
 
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
+)
+
+// Written counts the output files a sync asked to be written, split by whether their contents changed. Files
+// whose contents are unchanged are left alone, so their modification time doesn't wake up anything watching them.
+type Written struct {
+	Changed   int
+	Unchanged int
+}
+
+// Add includes the counts of other.
+func (w *Written) Add(other Written) {
+	w.Changed += other.Changed
+	w.Unchanged += other.Unchanged
+}
+
+// Record counts one file, which changed or not.
+func (w *Written) Record(changed bool) {
+	if changed {
+		w.Changed++
+	} else {
+		w.Unchanged++
+	}
+}
+
+// fileUpToDate returns true if the file exists, holds exactly the contents, and already has the mode and owner it
+// would be written with.
+func fileUpToDate(filename string, mode os.FileMode, owner util.FileOwner, contents []byte) bool {
+	info, err := os.Stat(filename)
+	if err != nil || !util.HasModeAndOwner(info, mode, owner) {
+		return false
+	}
+
+	current, err := ioutil.ReadFile(filename)
+	return err == nil && bytes.Equal(current, contents)
+}
+
+// writeFileIfChanged writes the contents to the file, unless the file already holds them with the same mode and
+// owner. A file that only differs in its mode or owner is rewritten, as that is a change to the output too. It returns
+// true if the file was written. When planning, the file is only recorded in the plan.
+func writeFileIfChanged(ctx context.Context, filename string, mode os.FileMode, owner util.FileOwner, contents []byte) (bool, error) {
+	if p := plan.Get(ctx); p != nil {
+		return p.File(filename, mode, owner, contents), nil
+	}
+
+	if fileUpToDate(filename, mode, owner, contents) {
+		return false, nil
+	}
+
+	util.MustMkdirAllForFileOwned(filename, owner)
+
+	if err := util.WriteFileAtomic(filename, contents, mode, owner); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,122 @@
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Child is a command run as a supervised child process, sharing this process's stdin, stdout and stderr. It can
+// be signalled, stopped, and restarted with a new environment.
+type Child struct {
+	log     zerolog.Logger
+	command []string
+	cmd     *exec.Cmd
+	done    chan struct{}
+}
+
+// Start runs the command (its first element is the program, the rest are its arguments) with the given
+// environment.
+func Start(command []string, env []string) (*Child, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command to run")
+	}
+
+	child := &Child{
+		log:     zlog.With().Str("command", command[0]).Logger(),
+		command: command,
+	}
+
+	if err := child.start(env); err != nil {
+		return nil, err
+	}
+
+	return child, nil
+}
+
+func (c *Child) start(env []string) error {
+	cmd := exec.Command(c.command[0], c.command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start %q: %w", c.command[0], err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// The exit status is read from cmd.ProcessState once done is closed.
+		_ = cmd.Wait()
+		close(done)
+	}()
+
+	c.cmd = cmd
+	c.done = done
+
+	c.log.Info().Int("pid", cmd.Process.Pid).Msg("started command")
+	return nil
+}
+
+// Done is closed when the currently running process exits.
+func (c *Child) Done() <-chan struct{} {
+	return c.done
+}
+
+// ExitCode is the exit code of the process once Done is closed. Processes killed by a signal have an exit code of
+// 128 plus the signal number, as they would in a shell.
+func (c *Child) ExitCode() int {
+	state := c.cmd.ProcessState
+	if state == nil {
+		return -1
+	}
+
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// Signal sends a signal to the running process.
+func (c *Child) Signal(sig os.Signal) error {
+	c.log.Debug().Stringer("signal", sig).Int("pid", c.cmd.Process.Pid).Msg("signalling command")
+	return c.cmd.Process.Signal(sig)
+}
+
+// Stop asks the process to exit with SIGTERM, and kills it if it is still running after the timeout.
+func (c *Child) Stop(timeout time.Duration) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	if err := c.Signal(syscall.SIGTERM); err != nil {
+		c.log.Warn().Err(err).Msg("could not send SIGTERM to command")
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(timeout):
+		c.log.Warn().Str("timeout", timeout.String()).Msg("command did not exit in time, killing it")
+		if err := c.cmd.Process.Kill(); err != nil {
+			c.log.Warn().Err(err).Msg("could not kill command")
+		}
+		<-c.done
+	}
+
+	c.log.Info().Int("exitCode", c.ExitCode()).Msg("command stopped")
+}
+
+// Restart stops the process and runs the command again with a new environment.
+func (c *Child) Restart(env []string, timeout time.Duration) error {
+	c.log.Info().Msg("restarting command")
+	c.Stop(timeout)
+	return c.start(env)
+}
@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartWithNewEnvironment(t *testing.T) {
+	output := path.Join(t.TempDir(), "greeting")
+	command := []string{"sh", "-c", `echo "$GREETING" > ` + output + `; exec sleep 60`}
+
+	child, err := Start(command, []string{"GREETING=hello"})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		greeting, _ := ioutil.ReadFile(output)
+		return string(greeting) == "hello\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, child.Restart([]string{"GREETING=goodbye"}, 5*time.Second))
+
+	assert.Eventually(t, func() bool {
+		greeting, _ := ioutil.ReadFile(output)
+		return string(greeting) == "goodbye\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	child.Stop(5 * time.Second)
+	assert.Equal(t, 128+int(syscall.SIGTERM), child.ExitCode())
+}
+
+func TestExitCode(t *testing.T) {
+	child, err := Start([]string{"sh", "-c", "exit 3"}, nil)
+	assert.NoError(t, err)
+
+	select {
+	case <-child.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("command did not exit")
+	}
+	assert.Equal(t, 3, child.ExitCode())
+}
+
+func TestStopKillsStubbornCommand(t *testing.T) {
+	child, err := Start([]string{"sh", "-c", `trap "" TERM; while true; do sleep 1; done`}, nil)
+	assert.NoError(t, err)
+
+	// give the shell a moment to install its trap
+	time.Sleep(200 * time.Millisecond)
+
+	child.Stop(200 * time.Millisecond)
+	assert.Equal(t, 128+int(syscall.SIGKILL), child.ExitCode())
+}
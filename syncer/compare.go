@@ -5,13 +5,20 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/vault/api"
+
 	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
 	"github.com/hootsuite/vault-ctrl-tool/v2/secrets"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
+	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
+	"github.com/rs/zerolog"
 )
 
-func (s *Syncer) compareSecrets(ctx context.Context, updates *int) error {
+func (s *Syncer) compareSecrets(ctx context.Context, updates *secrets.Written) error {
 	for _, secret := range s.config.VaultConfig.Secrets {
 		log := s.log.With().Interface("secretCfg", secret).Logger()
 		log.Debug().Msg("checking secret")
@@ -23,19 +30,14 @@ func (s *Syncer) compareSecrets(ctx context.Context, updates *int) error {
 		// to rearrange this code.
 		case util.LifetimeVersion:
 
-			simpleSecrets, err := s.readSecret(secret)
+			simpleSecrets, err := s.readVersionedSecret(secret)
 			if err != nil {
 				return err
 			}
 
 			if len(simpleSecrets) > 0 {
 				ss := simpleSecrets[0]
-				if ss.Version == nil {
-					return fmt.Errorf("no version number associated with secret %q and lifetime is %q",
-						secret.Key, util.LifetimeVersion)
-				}
-
-				briefcaseVersion := s.briefcase.VersionScopedSecrets[secret.Path]
+				briefcaseVersion := s.briefcase.SecretVersion(secret)
 
 				log.Debug().Int64("secretVersion", *ss.Version).
 					Int64("briefcaseSecretVersion", briefcaseVersion).
@@ -43,22 +45,25 @@ func (s *Syncer) compareSecrets(ctx context.Context, updates *int) error {
 					Time("now", clock.Now(ctx)).
 					Msg("comparing briefcase version of secret to current version")
 
-				if briefcaseVersion == 0 ||
-					(briefcaseVersion < *ss.Version &&
-						ss.CreatedTime.Add(30*time.Second).Before(clock.Now(ctx))) {
+				if s.newVersionReady(ctx, secret, briefcaseVersion, ss) {
 
-					count, err := secrets.WriteSecretFields(secret, simpleSecrets)
+					written, err := secrets.WriteSecretFields(ctx, secret, simpleSecrets)
 					if err != nil {
 						return fmt.Errorf("could not write secret %q: %w", secret.Path, err)
 					}
-					*updates += count
-
-					if count > 0 {
-						if err := util.TouchFile(secret.TouchFile); err != nil {
+					updates.Add(written)
+
+					if written.Changed > 0 {
+						if p := plan.Get(ctx); p != nil {
+							if secret.TouchFile != "" {
+								p.Action("touch %q", secret.TouchFile)
+							}
+						} else if err := util.TouchFile(secret.TouchFile); err != nil {
 							log.Warn().Str("touchfile", secret.TouchFile).Err(err).Msg("failed to 'touch' touchfile.")
 						}
+						s.queueOnChange(fmt.Sprintf("secret %q", secret.Key), secret.OnChange)
 					}
-					s.briefcase.VersionScopedSecrets[secret.Path] = *ss.Version
+					s.briefcase.EnrollVersionedSecret(secret, *ss.Version)
 				} else {
 					log.Debug().Msg("not updating secret")
 				}
@@ -89,12 +94,15 @@ func (s *Syncer) compareSecrets(ctx context.Context, updates *int) error {
 					kvSecrets = append(kvSecrets, s.briefcase.GetSecrets(util.LifetimeToken)...)
 				}
 
-				count, err := secrets.WriteSecretFields(secret, kvSecrets)
+				written, err := secrets.WriteSecretFields(ctx, secret, kvSecrets)
 				if err != nil {
 					log.Error().Err(err).Msg("failed to write secret")
 					return err
 				}
-				*updates += count
+				updates.Add(written)
+				if written.Changed > 0 {
+					s.queueOnChange(fmt.Sprintf("secret %q", secret.Key), secret.OnChange)
+				}
 				s.briefcase.EnrollSecret(secret)
 			}
 		default:
@@ -104,14 +112,15 @@ func (s *Syncer) compareSecrets(ctx context.Context, updates *int) error {
 	return nil
 }
 
-func (s *Syncer) compareTemplates(updates *int) error {
+func (s *Syncer) compareTemplates(ctx context.Context, updates *secrets.Written) error {
 	for _, tmpl := range s.config.VaultConfig.Templates {
 		log := s.log.With().Interface("tmplCfg", tmpl).Logger()
 		log.Debug().Msg("checking template")
-		if s.briefcase.ShouldRefreshTemplate(tmpl) {
-			if updates != nil {
-				*updates++
+		if tmpl.Lifetime == util.LifetimeVersion {
+			if err := s.compareVersionedTemplate(ctx, log, tmpl, updates); err != nil {
+				return err
 			}
+		} else if s.briefcase.ShouldRefreshTemplate(tmpl) {
 			log.Debug().Msg("refreshing template")
 
 			if tmpl.Lifetime == util.LifetimeToken {
@@ -124,10 +133,17 @@ func (s *Syncer) compareTemplates(updates *int) error {
 				return err
 			}
 
-			if err := secrets.WriteTemplate(tmpl, s.config.Templates, s.briefcase); err != nil {
+			changed, err := secrets.WriteTemplate(ctx, tmpl, s.config.Templates, s.briefcase)
+			if err != nil {
 				log.Error().Err(err).Msg("failed to write template")
 				return err
 			}
+			if updates != nil {
+				updates.Record(changed)
+			}
+			if changed {
+				s.queueOnChange(fmt.Sprintf("template %q", tmpl.Output), tmpl.OnChange)
+			}
 			log.Debug().Msg("enrolling template")
 			s.briefcase.EnrollTemplate(tmpl)
 		}
@@ -135,21 +151,33 @@ func (s *Syncer) compareTemplates(updates *int) error {
 	return nil
 }
 
-func (s *Syncer) compareSSHCertificates(ctx context.Context, updates *int, nextSync time.Time, forceRefreshTTL time.Duration) error {
+func (s *Syncer) compareSSHCertificates(ctx context.Context, updates *secrets.Written, nextSync time.Time, forceRefreshTTL time.Duration) error {
 	for _, ssh := range s.config.VaultConfig.SSHCertificates {
 		log := s.log.With().Interface("sshCfg", ssh).Logger()
 		log.Debug().Msg("checking SSH certificate")
 
 		if s.briefcase.ShouldRefreshSSHCertificate(ssh, nextSync) {
 			if updates != nil {
-				*updates++
+				updates.Changed++
 			}
 			log.Debug().Msg("refreshing ssh certificate")
 
-			if err := s.vaultClient.CreateSSHCertificate(ssh); err != nil {
+			if p := plan.Get(ctx); p != nil {
+				p.Action("issue an SSH certificate for role %q into %q", ssh.VaultRole, ssh.OutputPath)
+				s.queueOnChange(fmt.Sprintf("SSH certificate %q", ssh.OutputPath), ssh.OnChange)
+				continue
+			}
+
+			vaultClient, err := s.clientFor(ssh.Vault)
+			if err != nil {
+				return err
+			}
+
+			if err := vaultClient.CreateSSHCertificate(ssh); err != nil {
 				log.Error().Err(err).Msg("failed to fetch SSH certificate credentials")
 				return err
 			}
+			s.queueOnChange(fmt.Sprintf("SSH certificate %q", ssh.OutputPath), ssh.OnChange)
 
 			if err := s.briefcase.EnrollSSHCertificate(ctx, ssh, forceRefreshTTL); err != nil {
 				log.Error().Err(err).Msg("failed to enroll SSH certificate in briefcase")
@@ -160,35 +188,268 @@ func (s *Syncer) compareSSHCertificates(ctx context.Context, updates *int, nextS
 	return nil
 }
 
-func (s *Syncer) compareAWS(ctx context.Context, updates *int, nextSync time.Time, stsTTL, forceRefreshTTL time.Duration) error {
+func (s *Syncer) comparePKICertificates(ctx context.Context, updates *secrets.Written, nextSync time.Time) error {
+	for _, pki := range s.config.VaultConfig.PKICertificates {
+		log := s.log.With().Interface("pkiCfg", pki).Logger()
+		log.Debug().Msg("checking PKI certificate")
+
+		if s.briefcase.ShouldRefreshPKICertificate(ctx, pki, nextSync) {
+			if updates != nil {
+				updates.Changed++
+			}
+			log.Debug().Msg("issuing pki certificate")
+
+			if p := plan.Get(ctx); p != nil {
+				p.Action("issue a PKI certificate for role %q into %q", pki.VaultRole, pki.OutputPath)
+				s.queueOnChange(fmt.Sprintf("PKI certificate %q", pki.OutputPath), pki.OnChange)
+				continue
+			}
+
+			vaultClient, err := s.clientFor(pki.Vault)
+			if err != nil {
+				return err
+			}
+
+			if err := vaultClient.CreatePKICertificate(pki); err != nil {
+				log.Error().Err(err).Msg("failed to issue PKI certificate")
+				return err
+			}
+			s.queueOnChange(fmt.Sprintf("PKI certificate %q", pki.OutputPath), pki.OnChange)
+
+			if err := s.briefcase.EnrollPKICertificate(pki); err != nil {
+				log.Error().Err(err).Msg("failed to enroll PKI certificate in briefcase")
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) compareAWS(ctx context.Context, updates *secrets.Written, nextSync time.Time, stsTTL, forceRefreshTTL time.Duration) error {
 	for _, aws := range s.config.VaultConfig.AWS {
 		log := s.log.With().Interface("awsCfg", aws).Logger()
 		log.Debug().Msg("checking AWS STS credential")
 
-		if s.briefcase.AWSCredentialShouldRefreshBefore(aws, nextSync) || s.briefcase.AWSCredentialExpiresBefore(aws, nextSync) {
-			if updates != nil {
-				*updates++
-			}
+		drifted := s.briefcase.AWSCredentialOutputsDrifted(aws)
 
+		if drifted || s.briefcase.AWSCredentialShouldRefreshBefore(aws, nextSync) || s.briefcase.AWSCredentialExpiresBefore(aws, nextSync) {
 			log.Debug().
 				Bool("forcedRefreshBeforeNextHearbeat", s.briefcase.AWSCredentialShouldRefreshBefore(aws, nextSync)).
 				Bool("credentialExpiresBeforeNextHeartbeat", s.briefcase.AWSCredentialExpiresBefore(aws, nextSync)).
+				Bool("outputsDrifted", drifted).
 				Msg("refreshing AWS STS credential")
 
-			creds, secret, err := s.vaultClient.FetchAWSSTSCredential(aws, stsTTL)
+			if p := plan.Get(ctx); p != nil {
+				p.Action("issue AWS credentials for role %q into %q", aws.VaultRole, aws.OutputPath)
+				if updates != nil {
+					updates.Changed++
+				}
+				s.queueOnChange(fmt.Sprintf("AWS credentials %q", aws.OutputPath), aws.OnChange)
+				continue
+			}
+
+			vaultClient, err := s.clientFor(aws.Vault)
+			if err != nil {
+				return err
+			}
+
+			creds, secret, err := vaultClient.FetchAWSSTSCredential(aws, stsTTL)
 
 			if err != nil {
 				log.Error().Err(err).Msg("failed to fetch AWS STS credentials")
 				return err
 			}
 
-			if err := secrets.WriteAWSSTSCreds(creds, aws); err != nil {
+			written, err := secrets.WriteAWSSTSCreds(ctx, creds, aws)
+			if err != nil {
 				log.Error().Err(err).Msg("failed to write file with AWS STS credentials")
 				return err
 			}
+			if updates != nil {
+				updates.Add(written)
+			}
+			if written.Changed > 0 {
+				s.queueOnChange(fmt.Sprintf("AWS credentials %q", aws.OutputPath), aws.OnChange)
+			}
 
 			s.briefcase.EnrollAWSCredential(ctx, secret.Secret, aws, forceRefreshTTL)
 		}
 	}
 	return nil
 }
+
+func (s *Syncer) compareDatabases(ctx context.Context, updates *secrets.Written, nextSync time.Time) error {
+	for _, db := range s.config.VaultConfig.Databases {
+		log := s.log.With().Interface("databaseCfg", db).Logger()
+		log.Debug().Msg("checking database credential")
+
+		vaultClient, err := s.clientFor(db.Vault)
+		if err != nil {
+			return err
+		}
+
+		// Renewing keeps the same username and password, so nothing needs to be rewritten. A renewal that fails is
+		// tried again on the next sync, as the credential is still in use. Only once the lease can't be extended past
+		// the next sync is a new credential issued below.
+		if leaseID, due := s.briefcase.ShouldRenewDatabaseCredential(ctx, db, nextSync); due {
+			if p := plan.Get(ctx); p != nil {
+				p.Action("renew the lease of database credentials %q", db.Key)
+			} else if secret, err := s.renewLease(log, vaultClient, db.Namespace, leaseID); err == nil {
+				s.briefcase.RenewedDatabaseCredential(ctx, secret, db)
+			}
+		}
+
+		issued := false
+		if s.briefcase.ShouldIssueDatabaseCredential(db, nextSync) {
+			log.Debug().Msg("issuing database credential")
+
+			if p := plan.Get(ctx); p != nil {
+				p.Action("issue database credentials %q for role %q", db.Key, db.VaultRole)
+				if updates != nil {
+					updates.Changed++
+				}
+				s.queueOnChange(fmt.Sprintf("database credentials %q", db.Key), db.OnChange)
+				continue
+			}
+
+			secret, err := vaultClient.FetchDatabaseCredential(db)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to fetch database credentials")
+				return err
+			}
+
+			if replaced, ok := s.briefcase.DatabaseCredentialLease(db); ok {
+				s.replacedLeases = append(s.replacedLeases, replaced)
+			}
+			s.briefcase.EnrollDatabaseCredential(ctx, secret, db)
+			issued = true
+		} else if !s.briefcase.DatabaseOutputsDrifted(db) {
+			continue
+		}
+
+		written, err := secrets.WriteSecretFields(ctx, config.SecretType{
+			Key:    db.Key,
+			Fields: db.Fields,
+			Mode:   db.Mode,
+			Owner:  db.Owner,
+			Group:  db.Group,
+		}, s.briefcase.DatabaseCredentialFields())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to write database credential")
+			return err
+		}
+		if updates != nil {
+			updates.Add(written)
+		}
+		s.briefcase.EnrollDatabaseOutputs(db)
+
+		// A new credential is a change even without outputs of its own, as templates may use it.
+		if issued || written.Changed > 0 {
+			s.queueOnChange(fmt.Sprintf("database credentials %q", db.Key), db.OnChange)
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) compareDynamicSecrets(ctx context.Context, updates *secrets.Written, nextSync time.Time) error {
+	for _, dyn := range s.config.VaultConfig.Dynamic {
+		log := s.log.With().Str("key", dyn.Key).Str("path", dyn.Path).Logger()
+		log.Debug().Msg("checking dynamic secret")
+
+		vaultClient, err := s.clientFor(dyn.Vault)
+		if err != nil {
+			return err
+		}
+
+		// As with database credentials, a renewal that fails is tried again on the next sync.
+		if leaseID, due := s.briefcase.ShouldRenewDynamicSecret(ctx, dyn, nextSync); due {
+			if p := plan.Get(ctx); p != nil {
+				p.Action("renew the lease of dynamic secret %q", dyn.Key)
+			} else if secret, err := s.renewLease(log, vaultClient, dyn.Namespace, leaseID); err == nil {
+				s.briefcase.RenewedDynamicSecret(ctx, secret, dyn)
+			}
+		}
+
+		// Either there's no secret yet, or its lease expires before the next sync and couldn't be renewed.
+		fetched := false
+		if s.briefcase.ShouldFetchDynamicSecret(dyn, nextSync) {
+			log.Debug().Msg("fetching dynamic secret")
+
+			if p := plan.Get(ctx); p != nil {
+				p.Action("fetch dynamic secret %q from %q", dyn.Key, dyn.Path)
+				if updates != nil {
+					updates.Changed++
+				}
+				s.queueOnChange(fmt.Sprintf("dynamic secret %q", dyn.Key), dyn.OnChange)
+				continue
+			}
+
+			secret, err := vaultClient.FetchDynamicSecret(dyn)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to fetch dynamic secret")
+				return err
+			}
+
+			if replaced, ok := s.briefcase.DynamicSecretLease(dyn); ok {
+				s.replacedLeases = append(s.replacedLeases, replaced)
+			}
+			s.briefcase.EnrollDynamicSecret(ctx, secret, dyn)
+			fetched = true
+		} else if !s.briefcase.DynamicOutputsDrifted(dyn) {
+			continue
+		}
+
+		written, err := secrets.WriteDynamicSecret(ctx, dyn, s.briefcase.DynamicSecretFields())
+		if err != nil {
+			log.Error().Err(err).Msg("failed to write dynamic secret")
+			return err
+		}
+		if updates != nil {
+			updates.Add(written)
+		}
+		s.briefcase.EnrollDynamicOutputs(dyn)
+
+		// A new secret is a change even when the stanza writes nothing itself, as templates may use it.
+		if fetched || written.Changed > 0 {
+			s.queueOnChange(fmt.Sprintf("dynamic secret %q", dyn.Key), dyn.OnChange)
+		}
+	}
+	return nil
+}
+
+// renewLease renews a lease through the Vault connection and namespace that created it. Failures are logged, as
+// the lease is kept and renewed again on the next sync, or replaced once it is about to expire.
+func (s *Syncer) renewLease(log zerolog.Logger, vaultClient vaultclient.VaultClient, namespace, leaseID string) (*api.Secret, error) {
+	log.Debug().Str("leaseID", leaseID).Msg("renewing lease")
+
+	namespacedClient, err := vaultClient.WithNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := namespacedClient.RenewLease(leaseID, 0)
+	if err != nil {
+		log.Warn().Err(err).Str("leaseID", leaseID).Msg("failed to renew lease, it will be tried again on the next sync")
+		return nil, err
+	}
+
+	s.metrics.Increment(metrics.LeaseRenewed)
+	return secret, nil
+}
+
+// revokeReplacedLeases revokes the leases of database credentials and dynamic secrets that were replaced during the
+// sync, so they aren't left behind until they expire. It is only called once the new ones have been written and the
+// onChange hooks have run, as whatever uses the secrets may still hold the old ones until then. This is best-effort.
+func (s *Syncer) revokeReplacedLeases() {
+	for _, lease := range s.replacedLeases {
+		log := s.log.With().Str("kind", lease.Kind).Str("name", lease.Name).Str("leaseID", lease.LeaseID).Logger()
+
+		if err := revokeLease(lease, s.clientFor); err != nil {
+			log.Warn().Err(err).Msg("failed to revoke lease that was replaced, it is left to expire")
+			continue
+		}
+		log.Info().Msg("revoked lease that was replaced")
+	}
+
+	s.replacedLeases = nil
+}
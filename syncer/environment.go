@@ -0,0 +1,87 @@
+package syncer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+// ExecConfig returns the configuration for the command run with --exec.
+func (s *Syncer) ExecConfig() config.ExecType {
+	return s.config.VaultConfig.Exec
+}
+
+// Environment returns the environment variables to inject into the command run with --exec, as "NAME=value"
+// sorted by name. It is called after PerformSync, so leased secrets are already in the briefcase.
+func (s *Syncer) Environment() ([]string, error) {
+	secretsByKey := make(map[string]config.SecretType)
+	for _, secret := range s.config.VaultConfig.Secrets {
+		secretsByKey[secret.Key] = secret
+	}
+
+	var kvSecrets []briefcase.SimpleSecret
+	cachedLifetimes := make(map[util.SecretLifetime]bool)
+	readVersioned := make(map[string]bool)
+
+	for _, env := range s.config.VaultConfig.Exec.Environment {
+		// Database credentials and dynamic secrets are cached alongside token-scoped secrets.
+		lifetime := util.LifetimeToken
+		secret, isSecret := secretsByKey[env.Key]
+		if isSecret {
+			lifetime = secret.Lifetime
+		}
+
+		switch {
+		case lifetime == util.LifetimeVersion && !readVersioned[secret.Key]:
+			// Secrets with a lifetime of "version" are never cached.
+			secretData, err := s.readSecret(secret)
+			if err != nil {
+				return nil, err
+			}
+			kvSecrets = append(kvSecrets, secretData...)
+			readVersioned[secret.Key] = true
+		case lifetime != util.LifetimeVersion && !cachedLifetimes[lifetime]:
+			if err := s.cacheSecrets(lifetime); err != nil {
+				return nil, err
+			}
+			kvSecrets = append(kvSecrets, s.briefcase.GetSecrets(lifetime)...)
+			cachedLifetimes[lifetime] = true
+		}
+	}
+
+	var environment []string
+
+	for _, env := range s.config.VaultConfig.Exec.Environment {
+		value, err := environmentValue(env, kvSecrets)
+		if err != nil {
+			return nil, err
+		}
+		environment = append(environment, env.Name+"="+value)
+	}
+
+	sort.Strings(environment)
+	return environment, nil
+}
+
+func environmentValue(env config.EnvironmentType, kvSecrets []briefcase.SimpleSecret) (string, error) {
+	for _, secret := range kvSecrets {
+		if secret.Key == env.Key && secret.Field == env.Field {
+			value := fmt.Sprint(secret.Value)
+
+			if env.Encoding == util.EncodingBase64 {
+				decoded, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return "", fmt.Errorf("failed to base64 decode field %q of %q for environment variable %q: %w", env.Field, env.Key, env.Name, err)
+				}
+				value = string(decoded)
+			}
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("environment variable %q - field %q not found in secret with key %q", env.Name, env.Field, env.Key)
+}
@@ -0,0 +1,117 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
+)
+
+// queueOnChange remembers what changed, and the hook of the stanza whose outputs were just written, to be run once
+// the sync has written everything. Identical hooks are only queued once.
+func (s *Syncer) queueOnChange(changed string, hook *config.OnChangeType) {
+	s.changed = append(s.changed, changed)
+
+	if hook == nil {
+		return
+	}
+
+	for _, queued := range s.onChange {
+		if reflect.DeepEqual(queued, *hook) {
+			return
+		}
+	}
+
+	s.onChange = append(s.onChange, *hook)
+}
+
+// runOnChangeHooks runs the queued hooks. Failures are logged and counted, but do not fail the sync as the files
+// have already been written.
+func (s *Syncer) runOnChangeHooks() {
+	for _, hook := range s.onChange {
+		var action string
+		var err error
+
+		log := s.log.With().Strs("command", hook.Command).Str("signal", hook.Signal).Str("pidFile", hook.PIDFile).Logger()
+
+		if len(hook.Command) > 0 {
+			action = "command"
+			var output string
+			output, err = runOnChangeCommand(hook)
+			if output != "" {
+				log = log.With().Str("output", output).Logger()
+			}
+		} else {
+			action = "signal"
+			err = signalOnChangePIDFile(hook)
+		}
+
+		s.metrics.OnChangeHookRun(action, err == nil)
+
+		if err != nil {
+			log.Error().Err(err).Msg("onChange hook failed")
+		} else {
+			log.Info().Msg("onChange hook succeeded")
+		}
+	}
+
+	s.onChange = nil
+	s.changed = nil
+}
+
+// planOnChangeHooks records the queued hooks in the plan, instead of running them.
+func (s *Syncer) planOnChangeHooks(p *plan.Plan) {
+	for _, hook := range s.onChange {
+		if len(hook.Command) > 0 {
+			p.Action("run onChange command %q", strings.Join(hook.Command, " "))
+		} else {
+			p.Action("send %s to the process in %q", hook.Signal, hook.PIDFile)
+		}
+	}
+
+	s.onChange = nil
+	s.changed = nil
+}
+
+func runOnChangeCommand(hook config.OnChangeType) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.TimeoutDuration())
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("command did not finish within %s", hook.TimeoutDuration())
+	}
+	return strings.TrimSpace(string(output)), err
+}
+
+func signalOnChangePIDFile(hook config.OnChangeType) error {
+	sig, err := util.ParseSignal(hook.Signal)
+	if err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(hook.PIDFile)
+	if err != nil {
+		return fmt.Errorf("could not read pid file: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("pid file %q does not contain a process id", hook.PIDFile)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	return process.Signal(sig)
+}
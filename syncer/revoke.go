@@ -0,0 +1,53 @@
+package syncer
+
+import (
+	"fmt"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
+	"github.com/rs/zerolog"
+)
+
+// ClientForConnection returns a Vault client, using the token from the briefcase, for the named Vault connection.
+// The default Vault server is "".
+type ClientForConnection func(connection string) (vaultclient.VaultClient, error)
+
+// RevokeLeases revokes every lease tracked in the briefcase through the connection and namespace that created it.
+// Each lease is attempted, and an error is returned if any of them could not be revoked.
+func RevokeLeases(log zerolog.Logger, bc *briefcase.Briefcase, clientFor ClientForConnection) error {
+	leases := bc.TrackedLeases()
+	failures := 0
+
+	for _, lease := range leases {
+		log := log.With().Str("kind", lease.Kind).Str("name", lease.Name).Str("leaseID", lease.LeaseID).
+			Str("connection", lease.Vault).Str("namespace", lease.Namespace).Logger()
+
+		if err := revokeLease(lease, clientFor); err != nil {
+			log.Error().Err(err).Msg("failed to revoke lease")
+			failures++
+		} else {
+			log.Info().Msg("revoked lease")
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("failed to revoke %d of %d leases", failures, len(leases))
+	}
+
+	log.Info().Int("leases", len(leases)).Msg("revoked all leases")
+	return nil
+}
+
+func revokeLease(lease briefcase.TrackedLease, clientFor ClientForConnection) error {
+	vaultClient, err := clientFor(lease.Vault)
+	if err != nil {
+		return err
+	}
+
+	vaultClient, err = vaultClient.WithNamespace(lease.Namespace)
+	if err != nil {
+		return err
+	}
+
+	return vaultClient.RevokeLease(lease.LeaseID)
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/hootsuite/vault-ctrl-tool/v2/config"
 	"github.com/hootsuite/vault-ctrl-tool/v2/secrets"
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/plan"
 	"github.com/hootsuite/vault-ctrl-tool/v2/vaultclient"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -31,6 +32,32 @@ type Syncer struct {
 	vaultClient vaultclient.VaultClient
 	briefcase   *briefcase.Briefcase
 	metrics     *metrics.Metrics
+
+	// connections holds a client for each additional Vault server in the configuration, by connection name.
+	connections map[string]vaultclient.VaultClient
+
+	// onChange holds the hooks of stanzas whose outputs were written during the current sync.
+	onChange []config.OnChangeType
+
+	// changed describes the stanzas whose outputs were written during the current sync.
+	changed []string
+
+	// replacedLeases holds the leases replaced during the current sync, to be revoked after the onChange hooks run.
+	replacedLeases []briefcase.TrackedLease
+
+	// unauthenticated holds the connections that would have authenticated during the current plan, by name. They
+	// have no token, so no secrets can be read through them.
+	unauthenticated map[string]bool
+
+	// versionedSecrets holds the secrets with a lifetime of "version" read during the current sync, by location.
+	versionedSecrets map[string][]briefcase.SimpleSecret
+
+	// minVersionAge is how old new versions of secrets with a lifetime of "version" must be before they're written,
+	// for secrets that don't set "minVersionAge".
+	minVersionAge time.Duration
+
+	// heldBack holds the newer versions of secrets that were too new to write during the current sync, by location.
+	heldBack map[string]heldBackVersion
 }
 
 func NewSyncer(log zerolog.Logger, cfg *config.ControlToolConfig, vaultClient vaultclient.VaultClient, briefcase *briefcase.Briefcase, metrics *metrics.Metrics) *Syncer {
@@ -40,36 +67,62 @@ func NewSyncer(log zerolog.Logger, cfg *config.ControlToolConfig, vaultClient va
 		vaultClient: vaultClient,
 		briefcase:   briefcase,
 		metrics:     metrics,
+		connections: make(map[string]vaultclient.VaultClient),
 	}
 }
 
-func SetupSyncer(flags util.CliFlags, bc *briefcase.Briefcase, m *metrics.Metrics) (*Syncer, error) {
-	log, cfg, vaultClient, err := configureSyncerDependencies(flags)
+// Briefcase returns the briefcase as it was left by the last sync.
+func (s *Syncer) Briefcase() *briefcase.Briefcase {
+	return s.briefcase
+}
+
+// SetConnectionClient sets the client used for stanzas that read from the named Vault connection.
+func (s *Syncer) SetConnectionClient(connection string, vaultClient vaultclient.VaultClient) {
+	s.connections[connection] = vaultClient
+}
+
+// SetupSyncer reads the configuration and makes a Syncer that uses vaultClient for the default Vault server. The
+// client is made by the caller so it can be shared, such as with the briefcase transit key, and kept between syncs.
+func SetupSyncer(flags util.CliFlags, vaultClient vaultclient.VaultClient, bc *briefcase.Briefcase, m *metrics.Metrics) (*Syncer, error) {
+	log, cfg, err := configureSyncerDependencies(flags)
 	if err != nil {
 		return nil, err
 	}
 
 	syncer := NewSyncer(log, cfg, vaultClient, bc, m)
 
+	for _, conn := range cfg.VaultConfig.Connections {
+		connClient, err := vaultclient.NewConnectionVaultClient(conn, flags.ServiceSecretPrefix, flags.VaultClientTimeout, flags.VaultClientRetries)
+		if err != nil {
+			log.Error().Err(err).Str("connection", conn.Name).Msg("could not create vault client for connection")
+			return nil, err
+		}
+		syncer.SetConnectionClient(conn.Name, connClient)
+	}
+
 	return syncer, nil
 }
 
-func configureSyncerDependencies(flags util.CliFlags) (zerolog.Logger, *config.ControlToolConfig, vaultclient.VaultClient, error) {
+func configureSyncerDependencies(flags util.CliFlags) (zerolog.Logger, *config.ControlToolConfig, error) {
 
 	log := log.With().Str("cfg", flags.ConfigFile).Logger()
 
 	cfg, err := config.ReadConfigFile(flags.ConfigFile, flags.ConfigDir, flags.InputPrefix, flags.OutputPrefix)
 	if err != nil {
-		return log, nil, nil, err
+		return log, nil, err
 	}
 
-	vaultClient, err := vaultclient.NewVaultClient(flags.ServiceSecretPrefix, flags.VaultClientTimeout, flags.VaultClientRetries)
+	return log, cfg, nil
+}
+
+// NewVaultClient makes the client for the default Vault server from the command line flags.
+func NewVaultClient(flags util.CliFlags) (vaultclient.VaultClient, error) {
+	vaultClient, err := vaultclient.NewVaultClient(flags.ServiceSecretPrefix, flags.VaultNamespace, flags.VaultClientTimeout, flags.VaultClientRetries)
 	if err != nil {
 		log.Error().Err(err).Msg("could not create vault client")
-		return log, nil, nil, err
+		return nil, err
 	}
-
-	return log, cfg, vaultClient, nil
+	return vaultClient, nil
 }
 
 // PerformSync does primary VCT syncing logic by obtaining a Vault token and checking it's validity.
@@ -88,56 +141,186 @@ func (s *Syncer) GetVaultToken(ctx context.Context, flags util.CliFlags) (vaultt
 // PerformSync does primary VCT syncing logic by obtaining a refreshing dynamic credentials.
 func (s *Syncer) PerformSync(ctx context.Context, vaultToken vaulttoken.VaultToken, nextSync time.Time, flags util.CliFlags) error {
 	s.vaultClient.SetToken(vaultToken.TokenID())
+	s.onChange = nil
+	s.changed = nil
+	s.replacedLeases = nil
+	s.unauthenticated = make(map[string]bool)
 
 	// First we compare the vault token we're using with the one in the briefcase. If it's different, then
 	// we reset the briefcase to start over. We do this here to ease the briefcase compare below. We also
-	// write it to a file if configured at this point
-	if s.briefcase.AuthTokenLease.Token != vaultToken.TokenID() {
+	// write it to a file if configured at this point, or if that file was removed or changed since.
+	tokenChanged := s.briefcase.AuthTokenLease.Token != vaultToken.TokenID()
+	if tokenChanged {
 		s.log.Debug().Msg("briefcase token differs from current token, resetting briefcase")
 		s.briefcase = s.briefcase.ResetBriefcase()
-		if s.config.VaultConfig.VaultToken.Output != "" {
-			if err := secrets.WriteVaultToken(s.metrics, s.config.VaultConfig.VaultToken, vaultToken.TokenID()); err != nil {
-				return fmt.Errorf("could not write vault token: %w", err)
-			}
+	}
+
+	if tokenCfg := s.config.VaultConfig.VaultToken; tokenCfg.Output != "" && (tokenChanged || s.briefcase.VaultTokenOutputDrifted(tokenCfg)) {
+		if err := secrets.WriteVaultToken(ctx, s.metrics, tokenCfg, vaultToken.TokenID()); err != nil {
+			return fmt.Errorf("could not write vault token: %w", err)
 		}
-		if err := s.briefcase.EnrollVaultToken(ctx, vaultToken.Wrapped()); err != nil {
+		s.briefcase.EnrollVaultTokenOutput(tokenCfg)
+	}
+
+	if tokenChanged {
+		wrapped := vaultToken.Wrapped()
+		wrapped.Namespace = s.vaultClient.Namespace()
+		if err := s.briefcase.EnrollVaultToken(ctx, wrapped); err != nil {
 			return fmt.Errorf("could not enroll vault token into briefcase: %w", err)
 		}
 	}
 
 	if s.briefcase.ShouldRefreshVaultToken(ctx) {
-		s.log.Debug().Msg("refreshing vault token against server")
-		secret, err := s.vaultClient.RefreshVaultToken()
-		if err != nil {
-			s.metrics.SidecarSyncErrors.Inc()
-			return fmt.Errorf("could not refresh vault token: %w", err)
-		}
-		s.metrics.Increment(metrics.VaultTokenRefreshed)
+		if p := plan.Get(ctx); p != nil {
+			p.Action("renew the Vault token")
+		} else {
+			s.log.Debug().Msg("refreshing vault token against server")
+			secret, err := s.vaultClient.RefreshVaultToken()
+			if err != nil {
+				s.metrics.SidecarSyncErrors.Inc()
+				return fmt.Errorf("could not refresh vault token: %w", err)
+			}
+			s.metrics.Increment(metrics.VaultTokenRefreshed)
 
-		if err := s.briefcase.EnrollVaultToken(ctx, util.NewWrappedToken(secret, s.briefcase.AuthTokenLease.Renewable)); err != nil {
-			s.metrics.SidecarSyncErrors.Inc()
-			return fmt.Errorf("could not enroll refreshed vault token into briefcase: %w", err)
+			if err := s.briefcase.EnrollVaultToken(ctx, util.NewWrappedToken(secret, s.briefcase.AuthTokenLease.Renewable)); err != nil {
+				s.metrics.SidecarSyncErrors.Inc()
+				return fmt.Errorf("could not enroll refreshed vault token into briefcase: %w", err)
+			}
 		}
 	}
 
-	err := s.compareConfigToBriefcase(ctx, nextSync, flags.STSTTL, flags.ForceRefreshTTL)
+	if err := s.syncConnectionTokens(ctx, flags); err != nil {
+		s.metrics.SidecarSyncErrors.Inc()
+		return err
+	}
+
+	err := s.compareConfigToBriefcase(ctx, nextSync, flags.STSTTL, flags.ForceRefreshTTL, flags.MinVersionAge)
 	if err != nil {
 		s.metrics.SidecarSyncErrors.Inc()
+
+		// Outputs written before the failure stay written, so the hooks of their stanzas are run now rather than
+		// on some later sync, if one ever comes. Replaced leases are kept, as the briefcase isn't saved.
+		if len(s.changed) > 0 && plan.Get(ctx) == nil {
+			s.log.Warn().Strs("changed", s.changed).Err(err).Msg("sync failed after changing some outputs, running their onChange hooks")
+			s.runOnChangeHooks()
+		}
+		s.onChange = nil
+		s.changed = nil
+
 		return fmt.Errorf("could not compare config against briefcase: %w", err)
 	}
 
+	// When planning, nothing is saved and no hooks are run, so the next sync starts from the same briefcase.
+	if p := plan.Get(ctx); p != nil {
+		s.planOnChangeHooks(p)
+		return nil
+	}
+
 	err = s.briefcase.SaveAs(flags.BriefcaseFilename)
 	if err != nil {
 		return fmt.Errorf("could not save briefcase as '%s': %w", flags.BriefcaseFilename, err)
 	}
+
+	s.runOnChangeHooks()
+	s.revokeReplacedLeases()
+
 	return nil
 }
 
+// syncConnectionTokens makes sure each additional Vault connection has a usable token, authenticating if needed
+// and renewing it when it's due, just like the token for the default Vault server.
+func (s *Syncer) syncConnectionTokens(ctx context.Context, flags util.CliFlags) error {
+	for _, conn := range s.config.VaultConfig.Connections {
+		log := s.log.With().Str("connection", conn.Name).Logger()
+
+		vaultClient, err := s.clientFor(conn.Name)
+		if err != nil {
+			return err
+		}
+
+		token := vaulttoken.NewConnectionVaultToken(s.briefcase, vaultClient, conn.Name)
+		if err := token.CheckAndRefresh(); err != nil {
+			if !errors.Is(err, vaulttoken.ErrNoValidVaultTokenAvailable) {
+				log.Error().Err(err).Msg("could not establish vault token for connection")
+				return fmt.Errorf("could not establish vault token for connection %q: %w", conn.Name, err)
+			}
+
+			// A new token would reset the connection's token-scoped outputs, which the plan shows by resetting
+			// them in the briefcase that is never saved.
+			if p := plan.Get(ctx); p != nil {
+				p.Action("authenticate to Vault connection %q", conn.Name)
+				s.unauthenticated[conn.Name] = true
+				s.briefcase.ResetConnection(conn.Name, s.config)
+				continue
+			}
+
+			log.Debug().Msg("no vault token available for connection, performing authentication")
+			secret, err := s.authenticate(vaultClient, conn.AuthFlags(flags))
+			if err != nil {
+				return fmt.Errorf("could not authenticate to connection %q: %w", conn.Name, err)
+			}
+
+			if err := token.Set(secret); err != nil {
+				return err
+			}
+		}
+
+		vaultClient.SetToken(token.TokenID())
+
+		if s.briefcase.AuthToken(conn.Name).Token != token.TokenID() {
+			log.Debug().Msg("briefcase token differs from current token for connection, resetting its token-scoped outputs")
+			s.replacedLeases = append(s.replacedLeases, s.briefcase.ResetConnection(conn.Name, s.config)...)
+			wrapped := token.Wrapped()
+			wrapped.Namespace = vaultClient.Namespace()
+			if err := s.briefcase.EnrollConnectionVaultToken(ctx, conn.Name, wrapped); err != nil {
+				return fmt.Errorf("could not enroll vault token for connection %q into briefcase: %w", conn.Name, err)
+			}
+		}
+
+		if s.briefcase.ShouldRefreshConnectionVaultToken(ctx, conn.Name) {
+			if p := plan.Get(ctx); p != nil {
+				p.Action("renew the Vault token for connection %q", conn.Name)
+				continue
+			}
+
+			log.Debug().Msg("refreshing vault token for connection against server")
+			secret, err := vaultClient.RefreshVaultToken()
+			if err != nil {
+				return fmt.Errorf("could not refresh vault token for connection %q: %w", conn.Name, err)
+			}
+			s.metrics.Increment(metrics.VaultTokenRefreshed)
+
+			if err := s.briefcase.EnrollConnectionVaultToken(ctx, conn.Name, util.NewWrappedToken(secret, s.briefcase.AuthToken(conn.Name).Renewable)); err != nil {
+				return fmt.Errorf("could not enroll refreshed vault token for connection %q into briefcase: %w", conn.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// clientFor returns the client for the named Vault connection; "" is the default Vault server.
+func (s *Syncer) clientFor(connection string) (vaultclient.VaultClient, error) {
+	if connection == "" {
+		return s.vaultClient, nil
+	}
+
+	vaultClient, ok := s.connections[connection]
+	if !ok {
+		return nil, fmt.Errorf("no vault client for connection %q", connection)
+	}
+	return vaultClient, nil
+}
+
 // compareConfigToBriefcase does what it says on the tin. Given the list of secrets expected to exist (listed in the config),
 // compare that to the secrets that are being tracked in the briefcase. If they need to be refreshed, then refresh them
 // and update the briefcase.
-func (s *Syncer) compareConfigToBriefcase(ctx context.Context, nextSync time.Time, stsTTL, forceRefreshTTL time.Duration) error {
-	updates := 0
+func (s *Syncer) compareConfigToBriefcase(ctx context.Context, nextSync time.Time, stsTTL, forceRefreshTTL, minVersionAge time.Duration) error {
+	var updates secrets.Written
+
+	s.versionedSecrets = make(map[string][]briefcase.SimpleSecret)
+	s.heldBack = make(map[string]heldBackVersion)
+	s.briefcase.ForgetCachedSecrets()
+	s.minVersionAge = minVersionAge
 
 	if err := s.compareAWS(ctx, &updates, nextSync, stsTTL, forceRefreshTTL); err != nil {
 		return err
@@ -147,7 +330,19 @@ func (s *Syncer) compareConfigToBriefcase(ctx context.Context, nextSync time.Tim
 		return err
 	}
 
-	if err := s.compareTemplates(&updates); err != nil {
+	if err := s.comparePKICertificates(ctx, &updates, nextSync); err != nil {
+		return err
+	}
+
+	if err := s.compareDatabases(ctx, &updates, nextSync); err != nil {
+		return err
+	}
+
+	if err := s.compareDynamicSecrets(ctx, &updates, nextSync); err != nil {
+		return err
+	}
+
+	if err := s.compareTemplates(ctx, &updates); err != nil {
 		return err
 	}
 
@@ -158,8 +353,11 @@ func (s *Syncer) compareConfigToBriefcase(ctx context.Context, nextSync time.Tim
 	for _, composite := range s.config.Composites {
 		log := s.log.With().Interface("compositeFilename", composite.Filename).Logger()
 		log.Debug().Msg("checking composite secret")
-		if s.briefcase.ShouldRefreshComposite(*composite) {
-			updates++
+		if composite.Lifetime == util.LifetimeVersion {
+			if err := s.compareVersionedComposite(ctx, log, composite, &updates); err != nil {
+				return err
+			}
+		} else if s.briefcase.ShouldRefreshComposite(*composite) {
 			log.Debug().Msg("refreshing composite")
 			if composite.Lifetime == util.LifetimeToken {
 				if err := s.cacheSecrets(util.LifetimeToken); err != nil {
@@ -170,17 +368,27 @@ func (s *Syncer) compareConfigToBriefcase(ctx context.Context, nextSync time.Tim
 				return err
 			}
 
-			if err := secrets.WriteComposite(*composite, s.briefcase); err != nil {
+			changed, err := secrets.WriteComposite(ctx, *composite, s.briefcase)
+			if err != nil {
 				log.Error().Err(err).Msg("failed to write composite json secret")
 				return err
 			}
+			updates.Record(changed)
+			if changed {
+				for _, secret := range composite.Secrets {
+					s.queueOnChange(fmt.Sprintf("composite %q", composite.Filename), secret.OnChange)
+				}
+			}
 			log.Debug().Msg("enrolling composite secret")
 			s.briefcase.EnrollComposite(*composite)
 		}
 	}
 
-	s.metrics.IncrementBy(metrics.SecretUpdates, updates)
-	s.log.Info().Int("updates", updates).Msg("done comparing configuration against briefcase")
+	s.reportHeldBackVersions()
+
+	s.metrics.IncrementBy(metrics.SecretUpdates, updates.Changed)
+	s.metrics.IncrementBy(metrics.SecretsUnchanged, updates.Unchanged)
+	s.log.Info().Int("updates", updates.Changed).Int("unchanged", updates.Unchanged).Msg("done comparing configuration against briefcase")
 	return nil
 }
 
@@ -203,15 +411,8 @@ func (s *Syncer) checkVaultToken(token vaulttoken.VaultToken, flags util.CliFlag
 		if errors.Is(err, vaulttoken.ErrNoValidVaultTokenAvailable) {
 			log.Debug().Err(err).Msg("no vault token already available, performing authentication")
 
-			authenticator, err := vaultclient.NewAuthenticator(s.vaultClient, flags)
+			secret, err := s.authenticate(s.vaultClient, flags)
 			if err != nil {
-				log.Error().Err(err).Msg("unable to create authenticator")
-				return err
-			}
-			log.Debug().Str("authenticator", fmt.Sprintf("%+v", authenticator)).Msg("authenticator created")
-			secret, err := authenticator.Authenticate()
-			if err != nil {
-				log.Error().Err(err).Msg("authentication failed")
 				return err
 			}
 
@@ -221,7 +422,7 @@ func (s *Syncer) checkVaultToken(token vaulttoken.VaultToken, flags util.CliFlag
 				return err
 			}
 
-			log.Info().Str("accessor", accessor).Msg("authentication successful")
+			log.Info().Str("accessor", accessor).Str("authMechanism", secret.AuthMechanism).Msg("authentication successful")
 
 			err = token.Set(secret)
 			if err != nil {
@@ -239,6 +440,55 @@ func (s *Syncer) checkVaultToken(token vaulttoken.VaultToken, flags util.CliFlag
 	return nil
 }
 
+func (s *Syncer) authenticate(vaultClient vaultclient.VaultClient, flags util.CliFlags) (*util.WrappedToken, error) {
+	return Authenticate(vaultClient, flags, s.metrics)
+}
+
+// Authenticate tries each configured authentication mechanism in order, returning the token from the first one
+// that succeeds. The returned token records which mechanism produced it.
+func Authenticate(vaultClient vaultclient.VaultClient, flags util.CliFlags, m *metrics.Metrics) (*util.WrappedToken, error) {
+	mechanisms := flags.AuthMechanisms()
+	if len(mechanisms) == 0 {
+		return nil, fmt.Errorf("no authentication mechanism specified")
+	}
+
+	var failures []string
+	var lastErr error
+
+	for _, mechanism := range mechanisms {
+		log := log.With().Stringer("authMechanism", mechanism).Logger()
+
+		authenticator, err := vaultclient.NewAuthenticatorForMechanism(vaultClient, flags, mechanism)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to create authenticator")
+			return nil, err
+		}
+		log.Debug().Str("authenticator", fmt.Sprintf("%+v", authenticator)).Msg("authenticator created")
+
+		secret, err := authenticator.Authenticate()
+		if err != nil {
+			m.AuthenticationAttempt(mechanism.String(), false)
+			if len(mechanisms) > 1 {
+				log.Warn().Err(err).Msg("authentication failed, trying next mechanism")
+			} else {
+				log.Error().Err(err).Msg("authentication failed")
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", mechanism, err))
+			lastErr = err
+			continue
+		}
+
+		m.AuthenticationAttempt(mechanism.String(), true)
+		secret.AuthMechanism = mechanism.String()
+		return secret, nil
+	}
+
+	if len(failures) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("all %d authentication mechanisms failed: %s", len(failures), strings.Join(failures, "; "))
+}
+
 // cacheSecrets has the job of fetching secrets from Vault, if they're needed. The need is based on a few things, but
 // mostly on the "lifetime" of the secret. Static secrets are only fetched once, token-lifetime are refetched if the
 // token being used changes.
@@ -267,6 +517,12 @@ func (s *Syncer) cacheSecrets(lifetime util.SecretLifetime) error {
 		}
 	}
 
+	// Leased secrets are issued with the token, so they are available alongside token-scoped secrets.
+	if lifetime == util.LifetimeToken {
+		simpleSecrets = append(simpleSecrets, s.briefcase.DatabaseCredentialFields()...)
+		simpleSecrets = append(simpleSecrets, s.briefcase.DynamicSecretFields()...)
+	}
+
 	s.briefcase.StoreSecrets(lifetime, simpleSecrets)
 
 	return nil
@@ -280,7 +536,23 @@ func (s *Syncer) readSecret(secret config.SecretType) ([]briefcase.SimpleSecret,
 
 	key := secret.Key
 
-	log := s.log.With().Str("path", secret.Path).Str("vaultAddr", s.vaultClient.Address()).Logger()
+	if s.unauthenticated[secret.Vault] {
+		return nil, fmt.Errorf("could not read %q: connection %q has no vault token, and planning doesn't authenticate to get one", secret.Path, secret.Vault)
+	}
+
+	vaultClient, err := s.clientFor(secret.Vault)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret.Namespace != "" {
+		vaultClient, err = vaultClient.WithNamespace(secret.Namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log := s.log.With().Str("path", secret.Path).Str("namespace", secret.Namespace).Str("vaultAddr", vaultClient.Address()).Logger()
 
 	// Some secrets require metadata to be processed correctly based on their configuration.
 	if s.config.VaultConfig.ConfigVersion < 2 && secret.NeedsMetadata() {
@@ -294,7 +566,7 @@ func (s *Syncer) readSecret(secret config.SecretType) ([]briefcase.SimpleSecret,
 	var path string
 
 	if !strings.HasPrefix(secret.Path, "/") {
-		path = filepath.Join(s.vaultClient.ServiceSecretPrefix(s.config.VaultConfig.ConfigVersion), secret.Path)
+		path = filepath.Join(vaultClient.ServiceSecretPrefix(s.config.VaultConfig.ConfigVersion), secret.Path)
 	} else {
 		path = secret.Path
 	}
@@ -302,19 +574,18 @@ func (s *Syncer) readSecret(secret config.SecretType) ([]briefcase.SimpleSecret,
 	log.Debug().Msg("reading secret from Vault")
 
 	var response *api.Secret
-	var err error
 
 	if secret.PinnedVersion != nil {
 		log.Debug().Int("pinnedVersion", *secret.PinnedVersion).Msg("fetching specific version")
-		response, err = s.vaultClient.ReadWithData(path, map[string][]string{
+		response, err = vaultClient.ReadWithData(path, map[string][]string{
 			"version": {strconv.Itoa(*secret.PinnedVersion)},
 		})
 	} else {
-		response, err = s.vaultClient.Read(path)
+		response, err = vaultClient.Read(path)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error fetching secret %q from %q: %w", path, s.vaultClient.Address(), err)
+		return nil, fmt.Errorf("error fetching secret %q from %q: %w", path, vaultClient.Address(), err)
 	}
 
 	if response == nil {
@@ -345,7 +616,7 @@ func (s *Syncer) readSecret(secret config.SecretType) ([]briefcase.SimpleSecret,
 
 			// It's a failure if we need metadata to process this secret, and we're not a KVv2 secret.
 			if secret.NeedsMetadata() && (!hasData || !hasMetadata) {
-				return nil, fmt.Errorf("error getting KVv2 secret %q from %q: probably not in a KVv2 path", path, s.vaultClient.Address())
+				return nil, fmt.Errorf("error getting KVv2 secret %q from %q: probably not in a KVv2 path", path, vaultClient.Address())
 			}
 
 			if !(hasData && hasMetadata) {
@@ -376,18 +647,18 @@ func (s *Syncer) readSecret(secret config.SecretType) ([]briefcase.SimpleSecret,
 				}
 				secretVersion = &vers
 			} else {
-				return nil, fmt.Errorf("no version metadata field for secret %q from %q", path, s.vaultClient.Address())
+				return nil, fmt.Errorf("no version metadata field for secret %q from %q", path, vaultClient.Address())
 			}
 
 			if ts, ok := secretMetadata["created_time"]; ok {
 				parsedTime, err := time.Parse(time.RFC3339Nano, ts.(string))
 				if err != nil {
 					return nil, fmt.Errorf("unable to parse created_time timestamp %q for secret %q from %q",
-						ts, path, s.vaultClient.Address())
+						ts, path, vaultClient.Address())
 				}
 				secretCreated = &parsedTime
 			} else {
-				return nil, fmt.Errorf("no created_time field for secret %q from %q", path, s.vaultClient.Address())
+				return nil, fmt.Errorf("no created_time field for secret %q from %q", path, vaultClient.Address())
 			}
 
 		} else {
@@ -0,0 +1,273 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/briefcase"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/metrics"
+	"github.com/hootsuite/vault-ctrl-tool/v2/secrets"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util/clock"
+	"github.com/rs/zerolog"
+)
+
+// heldBackVersion is a newer version of a secret that isn't being written yet, as it is too new.
+type heldBackVersion struct {
+	version    int64
+	behind     int64
+	writableAt time.Time
+}
+
+// newVersionReady returns true if the secret is newer than the enrolled version and old enough to be written out,
+// or if the outputs have fallen more than "maxVersionsBehind" versions behind. Secrets that were never enrolled are
+// always written. Newer versions that aren't written are remembered, so they can be reported once the sync is done.
+func (s *Syncer) newVersionReady(ctx context.Context, secret config.SecretType, enrolled int64, ss briefcase.SimpleSecret) bool {
+	if enrolled == 0 {
+		return true
+	}
+	if enrolled >= *ss.Version {
+		return false
+	}
+
+	writableAt := ss.CreatedTime.Add(secret.MinVersionAgeDuration(s.minVersionAge))
+	if writableAt.Before(clock.Now(ctx)) {
+		return true
+	}
+
+	behind := *ss.Version - enrolled
+	if secret.MaxVersionsBehind > 0 && behind > int64(secret.MaxVersionsBehind) {
+		s.log.Info().Str("key", secret.Key).Int64("version", *ss.Version).Int64("versionsBehind", behind).
+			Int("maxVersionsBehind", secret.MaxVersionsBehind).
+			Msg("writing new version of secret before it is old enough, as outputs are too many versions behind")
+		return true
+	}
+
+	if held, ok := s.heldBack[secret.VaultLocation()]; !ok || behind > held.behind {
+		s.heldBack[secret.VaultLocation()] = heldBackVersion{version: *ss.Version, behind: behind, writableAt: writableAt}
+	}
+	return false
+}
+
+// reportHeldBackVersions logs each secret with a lifetime of "version" that has a newer version too new to be
+// written, and sets how many versions behind each of them is in the metrics.
+func (s *Syncer) reportHeldBackVersions() {
+	reported := make(map[string]bool)
+
+	for _, secret := range s.config.VaultConfig.Secrets {
+		if secret.Lifetime != util.LifetimeVersion || reported[secret.VaultLocation()] {
+			continue
+		}
+		reported[secret.VaultLocation()] = true
+
+		held, ok := s.heldBack[secret.VaultLocation()]
+		s.metrics.HeldBackVersions.WithLabelValues(secret.Key, secret.VaultLocation()).Set(float64(held.behind))
+		if !ok {
+			continue
+		}
+
+		s.metrics.Increment(metrics.VersionsHeldBack)
+		s.log.Info().Str("key", secret.Key).Str("path", secret.Path).Int64("version", held.version).
+			Int64("versionsBehind", held.behind).Time("writableAt", held.writableAt).
+			Msg("holding back new version of secret until it is old enough")
+	}
+}
+
+// versionedSecretConfig finds the configuration of the secret with a lifetime of "version" read from location.
+func (s *Syncer) versionedSecretConfig(location string) config.SecretType {
+	for _, secret := range s.config.VaultConfig.Secrets {
+		if secret.Lifetime == util.LifetimeVersion && secret.VaultLocation() == location {
+			return secret
+		}
+	}
+	return config.SecretType{Path: location}
+}
+
+// readVersionedSecret reads a secret with a lifetime of "version". Templates, composites and the fields of the
+// secret all need the current version, so it is only read from Vault once per sync.
+func (s *Syncer) readVersionedSecret(secret config.SecretType) ([]briefcase.SimpleSecret, error) {
+	if simpleSecrets, ok := s.versionedSecrets[secret.VaultLocation()]; ok {
+		return simpleSecrets, nil
+	}
+
+	simpleSecrets, err := s.readSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(simpleSecrets) > 0 && simpleSecrets[0].Version == nil {
+		return nil, fmt.Errorf("no version number associated with secret %q and lifetime is %q",
+			secret.Key, util.LifetimeVersion)
+	}
+
+	s.versionedSecrets[secret.VaultLocation()] = simpleSecrets
+	return simpleSecrets, nil
+}
+
+// cacheVersionedSecrets reads every secret with a lifetime of "version" into the secrets cache, so templates and
+// composites can use them. It returns the first field of each secret, which carries its version, keyed by where
+// the secret is in Vault. Secrets that are missing (and missingOk) are left out.
+func (s *Syncer) cacheVersionedSecrets() (map[string]briefcase.SimpleSecret, error) {
+	var simpleSecrets []briefcase.SimpleSecret
+	current := make(map[string]briefcase.SimpleSecret)
+
+	for _, secret := range s.config.VaultConfig.Secrets {
+		if secret.Lifetime != util.LifetimeVersion {
+			continue
+		}
+
+		secretData, err := s.readVersionedSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(secretData) > 0 {
+			current[secret.VaultLocation()] = secretData[0]
+		}
+		simpleSecrets = append(simpleSecrets, secretData...)
+	}
+
+	s.briefcase.StoreSecrets(util.LifetimeVersion, simpleSecrets)
+
+	return current, nil
+}
+
+// versionsNeedWriting decides if an output made from versioned secrets needs to be written. Outputs that haven't
+// been written are written right away. After that, they're only rewritten once one of their secrets has a new
+// version, and only when every new version is ready, so a version that's too new is never written early.
+func (s *Syncer) versionsNeedWriting(ctx context.Context, enrolled map[string]int64, exists bool, current map[string]briefcase.SimpleSecret) bool {
+	if !exists {
+		return true
+	}
+
+	changed := false
+	for location, ss := range current {
+		if enrolled[location] >= *ss.Version {
+			continue
+		}
+		if !s.newVersionReady(ctx, s.versionedSecretConfig(location), enrolled[location], ss) {
+			return false
+		}
+		changed = true
+	}
+
+	return changed
+}
+
+// versionNumbers is the version of each secret, keyed by where it is in Vault.
+func versionNumbers(current map[string]briefcase.SimpleSecret) map[string]int64 {
+	versions := make(map[string]int64)
+	for location, ss := range current {
+		versions[location] = *ss.Version
+	}
+	return versions
+}
+
+// templateVersions narrows the versioned secrets down to the ones the template refers to. Templates that use
+// "." on its own (such as with "index") could refer to any of them.
+func (s *Syncer) templateVersions(tmpl config.TemplateType, current map[string]briefcase.SimpleSecret) map[string]briefcase.SimpleSecret {
+	fields, all := config.TemplateFields(s.config.Templates[tmpl.Input])
+	if all {
+		return current
+	}
+
+	referenced := make(map[string]briefcase.SimpleSecret)
+
+	for _, secret := range s.config.VaultConfig.Secrets {
+		ss, ok := current[secret.VaultLocation()]
+		if !ok {
+			continue
+		}
+		for field := range fields {
+			if strings.HasPrefix(field, secret.Key+"_") {
+				referenced[secret.VaultLocation()] = ss
+				break
+			}
+		}
+	}
+
+	return referenced
+}
+
+// compareVersionedTemplate renders a template with a lifetime of "version" when it hasn't been written, or when a
+// secret it uses has a new version that has settled.
+func (s *Syncer) compareVersionedTemplate(ctx context.Context, log zerolog.Logger, tmpl config.TemplateType, updates *secrets.Written) error {
+	current, err := s.cacheVersionedSecrets()
+	if err != nil {
+		return err
+	}
+	current = s.templateVersions(tmpl, current)
+
+	enrolled, exists := s.briefcase.TemplateVersions(tmpl)
+	if !s.versionsNeedWriting(ctx, enrolled, exists, current) {
+		log.Debug().Msg("not updating versioned template")
+		return nil
+	}
+
+	log.Debug().Interface("versions", versionNumbers(current)).Msg("refreshing versioned template")
+
+	if err := s.cacheSecrets(util.LifetimeStatic); err != nil {
+		return err
+	}
+
+	changed, err := secrets.WriteTemplate(ctx, tmpl, s.config.Templates, s.briefcase)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write template")
+		return err
+	}
+	if updates != nil {
+		updates.Record(changed)
+	}
+	if changed {
+		s.queueOnChange(fmt.Sprintf("template %q", tmpl.Output), tmpl.OnChange)
+	}
+
+	s.briefcase.EnrollVersionedTemplate(tmpl, versionNumbers(current))
+	return nil
+}
+
+// compareVersionedComposite writes a composite with a lifetime of "version" when it hasn't been written, or when
+// one of its secrets has a new version that has settled.
+func (s *Syncer) compareVersionedComposite(ctx context.Context, log zerolog.Logger, composite *config.CompositeSecretFile, updates *secrets.Written) error {
+	all, err := s.cacheVersionedSecrets()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]briefcase.SimpleSecret)
+	for _, secret := range composite.Secrets {
+		if ss, ok := all[secret.VaultLocation()]; ok {
+			current[secret.VaultLocation()] = ss
+		}
+	}
+
+	enrolled, exists := s.briefcase.CompositeVersions(*composite)
+	if !s.versionsNeedWriting(ctx, enrolled, exists, current) {
+		log.Debug().Msg("not updating versioned composite")
+		return nil
+	}
+
+	log.Debug().Interface("versions", versionNumbers(current)).Msg("refreshing versioned composite")
+
+	if err := s.cacheSecrets(util.LifetimeStatic); err != nil {
+		return err
+	}
+
+	changed, err := secrets.WriteComposite(ctx, *composite, s.briefcase)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write composite json secret")
+		return err
+	}
+	updates.Record(changed)
+	if changed {
+		for _, secret := range composite.Secrets {
+			s.queueOnChange(fmt.Sprintf("composite %q", composite.Filename), secret.OnChange)
+		}
+	}
+
+	s.briefcase.EnrollVersionedComposite(*composite, versionNumbers(current))
+	return nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	zlog "github.com/rs/zerolog/log"
+)
+
+// WriteFileAtomic replaces filename with the contents, so readers see either the old file or the new one and never
+// an empty or partially written file. The contents go to a temporary file in the same directory, which is synced,
+// given the mode and owner, and renamed over filename. The directory is then synced so the rename survives a crash.
+// The directory must already exist.
+func WriteFileAtomic(filename string, contents []byte, mode os.FileMode, owner FileOwner) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmpFile, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file for %q: %w", filename, err)
+	}
+	tmpFilename := tmpFile.Name()
+
+	// Only cleans up if something below fails, as once renamed the temporary file no longer exists.
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFilename)
+	}()
+
+	if _, err := tmpFile.Write(contents); err != nil {
+		return fmt.Errorf("could not write %q: %w", tmpFilename, err)
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		return fmt.Errorf("could not sync %q: %w", tmpFilename, err)
+	}
+
+	// TempFile always creates files as 0600, and chmod isn't subject to the umask.
+	if err := tmpFile.Chmod(mode); err != nil {
+		return fmt.Errorf("could not set mode of %q to %v: %w", tmpFilename, mode, err)
+	}
+
+	if owner.IsSet() {
+		if err := tmpFile.Chown(owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("could not change owner of %q: %w", tmpFilename, err)
+		}
+	} else {
+		preserveOwner(tmpFile, filename)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("could not close %q: %w", tmpFilename, err)
+	}
+
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return fmt.Errorf("could not rename %q to %q: %w", tmpFilename, filename, err)
+	}
+
+	return syncDir(dir)
+}
+
+// preserveOwner gives the temporary file the owner and group of the file it is replacing, when no owner is
+// configured. Writing in place kept them, so a rename shouldn't quietly change them. This usually needs root, so
+// failing is only logged.
+func preserveOwner(tmpFile *os.File, filename string) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || (int(stat.Uid) == os.Geteuid() && int(stat.Gid) == os.Getegid()) {
+		return
+	}
+
+	if err := tmpFile.Chown(int(stat.Uid), int(stat.Gid)); err != nil {
+		zlog.Debug().Str("filename", filename).Err(err).Msg("could not keep owner of replaced file")
+	}
+}
+
+// syncDir fsyncs a directory, making renames within it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("could not open directory %q: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("could not sync directory %q: %w", dir, err)
+	}
+	return nil
+}
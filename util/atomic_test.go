@@ -0,0 +1,44 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "output")
+
+	if err := WriteFileAtomic(filename, []byte("first"), 0640, NoFileOwner); err != nil {
+		t.Fatalf("Could not write new file: %v", err)
+	}
+
+	// Replacing a read-only file must work, as Vault outputs are often 0400.
+	if err := os.Chmod(filename, 0400); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(filename, []byte("second"), 0600, NoFileOwner); err != nil {
+		t.Fatalf("Could not replace file: %v", err)
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil || string(contents) != "second" {
+		t.Errorf("Expected file to contain %q, not %q (%v).", "second", contents, err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, not %v.", info.Mode().Perm())
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the output file to be left behind, found %d entries (%v).", len(entries), err)
+	}
+}
@@ -6,9 +6,22 @@ const VaultEC2AuthPath = "/v1/auth/aws-ec2/login"
 // Disable this at compile time if you don't use this feature.
 const EnableKubernetesVaultTokenAuthentication = true
 
+// SSHPrivateKey is the name of the output file with the the SSH private key (think: ssh -i id_rsa ....).
+const SSHPrivateKey = "id_rsa"
+
+// SSHPublicKey is the corresponding public key, used for signing.
+const SSHPublicKey = "id_rsa.pub"
+
 // SSHCertificate is public key, signed by Vault.
 const SSHCertificate = "id_rsa-cert.pub"
 
+// Files written for each PKI certificate: the certificate, its private key, the chain of CA certificates that
+// issued it, and the issuing CA certificate on its own.
+const PKICertificate = "cert.pem"
+const PKIPrivateKey = "key.pem"
+const PKIChain = "chain.pem"
+const PKICABundle = "ca.pem"
+
 // SecretLifetime is used to describe secrets lifetime description.
 type SecretLifetime string
 
@@ -27,3 +40,18 @@ const LifetimeVersion SecretLifetime = "version"
 // decoded if they're part of a template / etc / etc.
 const EncodingBase64 = "base64"
 const EncodingNone = "none"
+
+// Secrets written to an "output" file can be in any of these formats. Without one, they're written as JSON.
+const FormatJSON = "json"
+const FormatYAML = "yaml"
+const FormatDotenv = "dotenv"
+const FormatProperties = "properties"
+const FormatTOML = "toml"
+
+// --validate reports problems with the configuration in one of these forms.
+const ValidateOutputHuman = "human"
+const ValidateOutputJSON = "json"
+
+// --status shows what is in the briefcase in one of these forms.
+const StatusOutputTable = "table"
+const StatusOutputJSON = "json"
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -16,21 +17,46 @@ type CliFlags struct {
 	PerformInit             bool          // run in "init" mode
 	PerformSidecar          bool          // run in "sidecar" mode
 	PerformOneShot          bool          // even though running in sidecar mode, only run things once and then exit.
+	PerformPlan             bool          // with "init" or a one shot "sidecar", show what would change without changing it
 	PerformCleanup          bool          // cleanup everything in the leases file
+	PerformExec             bool          // run in "exec" mode, supervising ExecCommand
+	PerformValidate         bool          // check the configuration and report every problem, without contacting Vault
+	ValidateOutput          string        // how --validate reports problems, either "human" or "json"
+	PerformStatus           bool          // show what is tracked in the briefcase, and whether any of it has expired
+	StatusOutput            string        // how --status shows the briefcase, either "table" or "json"
+	ExecCommand             []string      // command (and its arguments) to run in "exec" mode
 	RevokeOnCleanup         bool          // also revoke everything when cleaning up
 	RenewInterval           time.Duration // when in sidecar mode, this is the expected period between checks
 	BriefcaseFilename       string        // absolute location of briefcase
+	BriefcaseKeyFile        string        // encrypt the briefcase with the base64 encoded key in this file
+	BriefcaseKeyEnv         string        // encrypt the briefcase with the base64 encoded key in this environment variable
+	BriefcaseTransitKey     string        // encrypt the briefcase with data keys from this Vault transit key
+	BriefcaseTransitMount   string        // where the transit secrets engine of BriefcaseTransitKey is mounted
 	ShutdownTriggerFile     string        // if this file exists, the sidecar will shutdown
 	VaultTokenArg           string        // v-c-t will accept a vault token as a command line arg
 	EC2AuthEnabled          bool          // use "registered AMI" to authenticate an EC2 instance
 	EC2Nonce                string        // Nonce used for re-authenticating EC2 instances
 	IAMAuthRole             string        // Role to use when performing IAM authentication of EC2 instances
 	IAMVaultAuthBackend     string        // Override IAM auth path in Vault
+	AppRoleRoleID           string        // enables AppRole auth, and sets the role-id to use
+	AppRoleRoleIDFile       string        // enables AppRole auth, and reads the role-id from this file
+	AppRoleSecretIDFile     string        // file containing the AppRole secret-id, re-read on every authentication
+	AppRoleSecretIDWrapped  bool          // is the contents of the secret-id file a response-wrapping token?
+	AppRoleLoginPath        string        // path to use in Vault for AppRole authentication
+	JWTTokenFile            string        // enables JWT auth, and sets the file the JWT is read from on each login
+	JWTAuthRole             string        // role to use with JWT authentication, uses the mount's default_role if empty
+	JWTLoginPath            string        // path to use in Vault for JWT authentication
+	CertAuthClientCert      string        // enables TLS certificate auth, and sets the client certificate file
+	CertAuthClientKey       string        // private key file for the TLS certificate auth client certificate
+	CertAuthRole            string        // named certificate role to use with TLS certificate auth
+	CertLoginPath           string        // path to use in Vault for TLS certificate authentication
+	AuthChain               []string      // ordered list of authentication mechanisms to try until one succeeds
 	ConfigFile              string        // location of vault-config, either relative to input prefix, or absolute
 	ConfigDir               string        // location of vault-config directory, either relative to input prefix, or absolute
 	OutputPrefix            string        // prefix to use when writing output files
 	InputPrefix             string        // prefix to use when looking for input files
 	ServiceSecretPrefix     string        // override prefix for relative KV secrets
+	VaultNamespace          string        // Vault Enterprise namespace to authenticate in, and the parent of any stanza namespaces
 	KubernetesLoginPath     string        // path to use in Vault for Kubernetes authentication
 	ServiceAccountToken     string        // path to the ServiceAccount token file for Kubernetes authentication
 	KubernetesAuthRole      string        // enables Kubernetes auth, and sets role to use with Kubernetes authentication
@@ -43,6 +69,7 @@ type CliFlags struct {
 	VaultClientTimeout      time.Duration // configures HTTP timeouts for Vault client connections.
 	VaultClientRetries      int           // configures HTTP retries for Vault client connections.
 	TerminateOnSyncFailure  bool          // If enabled in sidecar mode, will cause tool to terminate if there is a failure to perform sync.
+	MinVersionAge           time.Duration // how old new versions of secrets with a "version" lifetime must be before they're written.
 }
 
 type RunMode int
@@ -53,6 +80,9 @@ const (
 	ModeSidecar
 	ModeOneShotSidecar
 	ModeCleanup
+	ModeExec
+	ModeValidate
+	ModeStatus
 	ModeUnknown
 )
 
@@ -62,9 +92,69 @@ const (
 	EC2AMIAuth AuthMechanismType = iota
 	EC2IAMAuth
 	KubernetesAuth
+	AppRoleAuth
+	JWTAuth
+	CertAuth
 	UnknownAuth
 )
 
+var authMechanismNames = map[AuthMechanismType]string{
+	EC2AMIAuth:     "ec2",
+	EC2IAMAuth:     "iam",
+	KubernetesAuth: "kubernetes",
+	AppRoleAuth:    "approle",
+	JWTAuth:        "jwt",
+	CertAuth:       "cert",
+	UnknownAuth:    "unknown",
+}
+
+func (m AuthMechanismType) String() string {
+	if name, ok := authMechanismNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("AuthMechanismType(%d)", int(m))
+}
+
+// ParseAuthMechanism turns the name of an authentication mechanism (as used with --auth-chain) into its type.
+func ParseAuthMechanism(name string) (AuthMechanismType, error) {
+	for mechanism, mechanismName := range authMechanismNames {
+		if mechanism != UnknownAuth && strings.EqualFold(strings.TrimSpace(name), mechanismName) {
+			return mechanism, nil
+		}
+	}
+	return UnknownAuth, fmt.Errorf("unknown authentication mechanism %q", name)
+}
+
+// AuthMechanisms returns the authentication mechanisms to try, in order. If --auth-chain is not used, this is
+// just the single mechanism implied by the other flags.
+func (f *CliFlags) AuthMechanisms() []AuthMechanismType {
+	if len(f.AuthChain) == 0 {
+		if mechanism := f.AuthMechanism(); mechanism != UnknownAuth {
+			return []AuthMechanismType{mechanism}
+		}
+		return nil
+	}
+
+	var mechanisms []AuthMechanismType
+	for _, name := range f.AuthChain {
+		// names are validated in ProcessFlags
+		if mechanism, err := ParseAuthMechanism(name); err == nil {
+			mechanisms = append(mechanisms, mechanism)
+		}
+	}
+	return mechanisms
+}
+
+// UsesAuthMechanism returns true if the specified mechanism is one of the mechanisms that may be tried.
+func (f *CliFlags) UsesAuthMechanism(mechanism AuthMechanismType) bool {
+	for _, m := range f.AuthMechanisms() {
+		if m == mechanism {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *CliFlags) AuthMechanism() AuthMechanismType {
 	if f.KubernetesAuthRole != "" {
 		return KubernetesAuth
@@ -78,6 +168,18 @@ func (f *CliFlags) AuthMechanism() AuthMechanismType {
 		return EC2IAMAuth
 	}
 
+	if f.AppRoleRoleID != "" || f.AppRoleRoleIDFile != "" {
+		return AppRoleAuth
+	}
+
+	if f.JWTTokenFile != "" {
+		return JWTAuth
+	}
+
+	if f.CertAuthClientCert != "" {
+		return CertAuth
+	}
+
 	return UnknownAuth
 }
 
@@ -100,11 +202,24 @@ func (f *CliFlags) RunMode() RunMode {
 	if f.PerformCleanup {
 		return ModeCleanup
 	}
+
+	if f.PerformExec {
+		return ModeExec
+	}
+
+	if f.PerformValidate {
+		return ModeValidate
+	}
+
+	if f.PerformStatus {
+		return ModeStatus
+	}
 	return ModeUnknown
 }
 
 func ProcessFlags(args []string) (*CliFlags, error) {
 	var flags CliFlags
+	var authChain string
 
 	app := kingpin.New("vault-ctrl-tool", "A handy tool for interacting with HashiCorp Vault\n\n"+
 		"Boolean flags can be disabled through using the complement flag by prefixing it with 'no-' (for example: '--no-token-renewable).")
@@ -115,14 +230,32 @@ func ProcessFlags(args []string) (*CliFlags, error) {
 	app.Flag("output-prefix", "Path to prefix to all output files (such as /etc/secrets)").StringVar(&flags.OutputPrefix)
 	app.Flag("input-prefix", "Path to prefix on all files being read; including the config file. Only the main config file (--config-file) will have his root values read. Those in the config directory will be ignored.").StringVar(&flags.InputPrefix)
 	app.Flag("secret-prefix", "Vault path to prepend to secrets with relative paths").StringVar(&flags.ServiceSecretPrefix)
+	app.Flag("vault-namespace", "Vault Enterprise namespace to authenticate in; namespaces in the config file are children of this namespace. Overrides VAULT_NAMESPACE environment variable").Default("").StringVar(&flags.VaultNamespace)
 
 	app.Flag("renew-interval", "Interval to renew credentials").Default("9m").DurationVar(&flags.RenewInterval)
 	app.Flag("leases-file", "Full path to briefcase file.").Default("/tmp/vault-leases/vault-ctrl-tool.leases").StringVar(&flags.BriefcaseFilename)
+	app.Flag("briefcase-key-file", "Encrypt the leases file with the base64 encoded 256 bit key in this file (such as from \"openssl rand -base64 32\").").StringVar(&flags.BriefcaseKeyFile)
+	app.Flag("briefcase-key-env", "Encrypt the leases file with the base64 encoded 256 bit key in this environment variable.").StringVar(&flags.BriefcaseKeyEnv)
+	app.Flag("briefcase-transit-key", "Encrypt the leases file with data keys from this Vault transit key.").StringVar(&flags.BriefcaseTransitKey)
+	app.Flag("briefcase-transit-mount", "Where the transit secrets engine used by --briefcase-transit-key is mounted.").Default("transit").StringVar(&flags.BriefcaseTransitMount)
 	app.Flag("shutdown-trigger-file", "When running as a daemon, the presence of this file will cause the daemon to stop").StringVar(&flags.ShutdownTriggerFile)
+	app.Flag("plan", "Combined with --init or --sidecar --one-shot, show which files would be written and which credentials issued, without changing anything.").Default("false").BoolVar(&flags.PerformPlan)
 	app.Flag("one-shot", "Combined with --sidecar, will perform one iteration of work and exit. For crontabs, etc.").Default("false").BoolVar(&flags.PerformOneShot)
 
 	app.Flag("cleanup", "Using the leases file, erase any created output files.").Default("false").BoolVar(&flags.PerformCleanup)
-	app.Flag("revoke", "During --cleanup, revoke the Vault authentication token.").Default("false").BoolVar(&flags.RevokeOnCleanup)
+	app.Flag("revoke", "During --cleanup, revoke every lease in the briefcase, then the Vault authentication tokens.").Default("false").BoolVar(&flags.RevokeOnCleanup)
+
+	// Exec options
+	app.Flag("exec", "Sync like --init, then run the command after '--' with secrets in its environment, syncing in the background like --sidecar.").Default("false").BoolVar(&flags.PerformExec)
+	app.Arg("command", "Command (and arguments) to run with --exec.").StringsVar(&flags.ExecCommand)
+
+	// Validate options
+	app.Flag("validate", "Check --config and --config-dir, including templates, report every problem found and exit. Vault is not contacted.").Default("false").BoolVar(&flags.PerformValidate)
+	app.Flag("validate-output", "How --validate reports problems, either \"human\" or \"json\".").Default(ValidateOutputHuman).EnumVar(&flags.ValidateOutput, ValidateOutputHuman, ValidateOutputJSON)
+
+	// Status options
+	app.Flag("status", "Show everything tracked in the leases file and when it expires, then exit. Exits with 1 if anything has expired, or will before the next --renew-interval.").Default("false").BoolVar(&flags.PerformStatus)
+	app.Flag("status-output", "How --status shows the leases file, either \"table\" or \"json\".").Default(StatusOutputTable).EnumVar(&flags.StatusOutput, StatusOutputTable, StatusOutputJSON)
 
 	// Sidecar options
 	app.Flag("sidecar", "Run in side-car mode, refreshing leases as needed.").Default("false").BoolVar(&flags.PerformSidecar)
@@ -130,6 +263,7 @@ func ProcessFlags(args []string) (*CliFlags, error) {
 	app.Flag("vault-token", "Vault token to use during initialization; overrides VAULT_TOKEN environment variable").StringVar(&flags.VaultTokenArg)
 	app.Flag("token-renewable", "Is the token supplied on the command line renewable?").Default("true").BoolVar(&flags.CliVaultTokenRenewable)
 	app.Flag("force-refresh-ttl", "If set, secrets will be refreshed after this period regardless of whether they are set to expire (just uses tokenn TTL if zero)").Default("0s").DurationVar(&flags.ForceRefreshTTL)
+	app.Flag("min-version-age", "How old a new version of a secret with a lifetime of \"version\" must be before it is written, unless the secret sets \"minVersionAge\"").Default("30s").DurationVar(&flags.MinVersionAge)
 
 	// Kubernetes Authentication
 	app.Flag("k8s-token-file", "Service account token path").Default("/var/run/secrets/kubernetes.io/serviceaccount/token").StringVar(&flags.ServiceAccountToken)
@@ -144,6 +278,27 @@ func ProcessFlags(args []string) (*CliFlags, error) {
 	app.Flag("iam-auth-role", "The role used to perform iam authentication").Default("").StringVar(&flags.IAMAuthRole)
 	app.Flag("iam-vault-auth-backend", "The name of the auth backend in Vault to perform iam authentication against. Defaults to `aws`.").Default("aws").StringVar(&flags.IAMVaultAuthBackend)
 
+	// AppRole Authentication
+	app.Flag("approle-role-id", "AppRole role-id to authenticate with").Default("").StringVar(&flags.AppRoleRoleID)
+	app.Flag("approle-role-id-file", "File containing the AppRole role-id to authenticate with").Default("").StringVar(&flags.AppRoleRoleIDFile)
+	app.Flag("approle-secret-id-file", "File containing the AppRole secret-id. It is re-read each time the tool authenticates.").Default("").StringVar(&flags.AppRoleSecretIDFile)
+	app.Flag("approle-secret-id-wrapped", "The AppRole secret-id file contains a response-wrapping token which must be unwrapped to get the secret-id. Only with --init or --sidecar --one-shot.").Default("false").BoolVar(&flags.AppRoleSecretIDWrapped)
+	app.Flag("approle-login-path", "The name of the auth backend in Vault to perform AppRole authentication against. Defaults to `approle`.").Default("approle").StringVar(&flags.AppRoleLoginPath)
+
+	// JWT/OIDC Authentication
+	app.Flag("jwt-token-file", "File containing a signed JWT to authenticate with. It is re-read each time the tool authenticates.").Default("").StringVar(&flags.JWTTokenFile)
+	app.Flag("jwt-auth-role", "JWT authentication role, if not set the default_role of the auth backend is used").Default("").StringVar(&flags.JWTAuthRole)
+	app.Flag("jwt-login-path", "The name of the auth backend in Vault to perform JWT authentication against. Defaults to `jwt`.").Default("jwt").StringVar(&flags.JWTLoginPath)
+
+	// TLS Certificate Authentication
+	app.Flag("cert-auth-client-cert", "PEM encoded client certificate used to authenticate to Vault. It is re-read each time the tool authenticates.").Default("").StringVar(&flags.CertAuthClientCert)
+	app.Flag("cert-auth-client-key", "PEM encoded private key of the client certificate. It is re-read each time the tool authenticates.").Default("").StringVar(&flags.CertAuthClientKey)
+	app.Flag("cert-auth-role", "Named certificate role to authenticate against, if not set Vault will try all roles").Default("").StringVar(&flags.CertAuthRole)
+	app.Flag("cert-login-path", "The name of the auth backend in Vault to perform TLS certificate authentication against. Defaults to `cert`.").Default("cert").StringVar(&flags.CertLoginPath)
+
+	// Authentication fallback
+	app.Flag("auth-chain", "Comma separated, ordered list of authentication mechanisms to try until one succeeds (ec2, iam, kubernetes, approle, jwt, cert). Each mechanism still needs its own flags.").Default("").StringVar(&authChain)
+
 	// STS Authentication
 	app.Flag("sts-ttl", "The TTL to use for generating AWS STS tokens, if set to zero then will not override TTL. Defaults to 0").Default("0s").DurationVar(&flags.STSTTL)
 
@@ -173,8 +328,34 @@ func ProcessFlags(args []string) (*CliFlags, error) {
 		return nil, fmt.Errorf("could not parse arguments: %w", err)
 	}
 
-	if flags.EC2AuthEnabled && flags.IAMAuthRole != "" {
-		return nil, errors.New("specify exactly one of --ec2-auth or --iam-auth-role")
+	if authChain != "" {
+		if err := flags.setAuthChain(authChain); err != nil {
+			return nil, err
+		}
+	} else if flags.EC2AuthEnabled && flags.IAMAuthRole != "" {
+		return nil, errors.New("specify exactly one of --ec2-auth or --iam-auth-role, or use --auth-chain")
+	}
+
+	if flags.AppRoleRoleID != "" && flags.AppRoleRoleIDFile != "" {
+		return nil, errors.New("specify at most one of --approle-role-id or --approle-role-id-file")
+	}
+
+	if flags.AppRoleSecretIDWrapped && flags.AppRoleSecretIDFile == "" {
+		return nil, errors.New("the --approle-secret-id-wrapped flag requires --approle-secret-id-file")
+	}
+
+	if (flags.CertAuthClientCert == "") != (flags.CertAuthClientKey == "") {
+		return nil, errors.New("specify both --cert-auth-client-cert and --cert-auth-client-key")
+	}
+
+	briefcaseKeys := 0
+	for _, key := range []string{flags.BriefcaseKeyFile, flags.BriefcaseKeyEnv, flags.BriefcaseTransitKey} {
+		if key != "" {
+			briefcaseKeys++
+		}
+	}
+	if briefcaseKeys > 1 {
+		return nil, errors.New("specify only one of --briefcase-key-file, --briefcase-key-env or --briefcase-transit-key")
 	}
 
 	actions := 0
@@ -201,9 +382,89 @@ func ProcessFlags(args []string) (*CliFlags, error) {
 		}
 	}
 
+	if flags.PerformExec {
+		actions++
+		if flags.PerformOneShot {
+			return nil, errors.New("the --one-shot flag can only be used in --sidecar mode")
+		}
+		if len(flags.ExecCommand) == 0 {
+			return nil, errors.New("the --exec flag requires a command to run after '--'")
+		}
+	} else if len(flags.ExecCommand) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q - a command can only be run with --exec", flags.ExecCommand[0])
+	}
+
+	if flags.PerformValidate {
+		actions++
+		if flags.PerformOneShot {
+			return nil, errors.New("the --one-shot flag can only be used in --sidecar mode")
+		}
+	}
+
+	if flags.PerformStatus {
+		actions++
+		if flags.PerformOneShot {
+			return nil, errors.New("the --one-shot flag can only be used in --sidecar mode")
+		}
+	}
+
 	if actions != 1 {
-		return nil, errors.New("specify exactly one of --init, --sidecar, --version  or --cleanup flags")
+		return nil, errors.New("specify exactly one of --init, --sidecar, --exec, --validate, --status, --version  or --cleanup flags")
+	}
+
+	if flags.PerformPlan && flags.RunMode() != ModeInit && flags.RunMode() != ModeOneShotSidecar {
+		return nil, errors.New("the --plan flag can only be used with --init or --sidecar --one-shot")
+	}
+
+	// A wrapping token can only be unwrapped once, but the secret-id file is re-read whenever the tool authenticates,
+	// which a long running sidecar or exec does without anything writing a fresh wrapping token first.
+	if flags.AppRoleSecretIDWrapped && (flags.RunMode() == ModeSidecar || flags.RunMode() == ModeExec) {
+		return nil, errors.New("the --approle-secret-id-wrapped flag can only be used with --init or --sidecar --one-shot")
 	}
 
 	return &flags, nil
 }
+
+// setAuthChain parses the value of --auth-chain and makes sure each listed mechanism has the flags it needs.
+func (f *CliFlags) setAuthChain(authChain string) error {
+	seen := make(map[AuthMechanismType]bool)
+
+	for _, name := range strings.Split(authChain, ",") {
+		mechanism, err := ParseAuthMechanism(name)
+		if err != nil {
+			return fmt.Errorf("invalid --auth-chain: %w", err)
+		}
+
+		if seen[mechanism] {
+			return fmt.Errorf("invalid --auth-chain: %q is listed more than once", mechanism)
+		}
+		seen[mechanism] = true
+
+		switch mechanism {
+		case EC2IAMAuth:
+			if f.IAMAuthRole == "" {
+				return errors.New("the iam mechanism in --auth-chain requires --iam-auth-role")
+			}
+		case KubernetesAuth:
+			if f.KubernetesAuthRole == "" {
+				return errors.New("the kubernetes mechanism in --auth-chain requires --k8s-auth-role")
+			}
+		case AppRoleAuth:
+			if f.AppRoleRoleID == "" && f.AppRoleRoleIDFile == "" {
+				return errors.New("the approle mechanism in --auth-chain requires --approle-role-id or --approle-role-id-file")
+			}
+		case JWTAuth:
+			if f.JWTTokenFile == "" {
+				return errors.New("the jwt mechanism in --auth-chain requires --jwt-token-file")
+			}
+		case CertAuth:
+			if f.CertAuthClientCert == "" {
+				return errors.New("the cert mechanism in --auth-chain requires --cert-auth-client-cert")
+			}
+		}
+
+		f.AuthChain = append(f.AuthChain, mechanism.String())
+	}
+
+	return nil
+}
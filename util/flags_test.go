@@ -0,0 +1,161 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppRoleAuthMechanism(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--approle-role-id", "my-role", "--approle-secret-id-file", "/tmp/secret-id"})
+	assert.NoError(t, err)
+	assert.Equal(t, AppRoleAuth, flags.AuthMechanism())
+	assert.Equal(t, "approle", flags.AppRoleLoginPath)
+
+	flags, err = ProcessFlags([]string{"--init", "--approle-role-id-file", "/tmp/role-id"})
+	assert.NoError(t, err)
+	assert.Equal(t, AppRoleAuth, flags.AuthMechanism())
+}
+
+func TestInvalidAppRoleFlags(t *testing.T) {
+	_, err := ProcessFlags([]string{"--init", "--approle-role-id", "my-role", "--approle-role-id-file", "/tmp/role-id"})
+	assert.Error(t, err, "role-id and role-id-file must not both be specified")
+
+	_, err = ProcessFlags([]string{"--init", "--approle-role-id", "my-role", "--approle-secret-id-wrapped"})
+	assert.Error(t, err, "a wrapped secret-id needs a secret-id file")
+
+	wrapped := []string{"--approle-role-id", "my-role", "--approle-secret-id-file", "/tmp/secret-id", "--approle-secret-id-wrapped"}
+
+	_, err = ProcessFlags(append([]string{"--init"}, wrapped...))
+	assert.NoError(t, err)
+
+	_, err = ProcessFlags(append([]string{"--sidecar", "--one-shot"}, wrapped...))
+	assert.NoError(t, err)
+
+	_, err = ProcessFlags(append([]string{"--sidecar"}, wrapped...))
+	assert.Error(t, err, "a wrapped secret-id can't be unwrapped again by a sidecar")
+
+	_, err = ProcessFlags(append(append([]string{"--exec"}, wrapped...), "--", "true"))
+	assert.Error(t, err, "a wrapped secret-id can't be unwrapped again by exec")
+}
+
+func TestJWTAuthMechanism(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--jwt-token-file", "/var/run/jwt", "--jwt-auth-role", "example"})
+	assert.NoError(t, err)
+	assert.Equal(t, JWTAuth, flags.AuthMechanism())
+	assert.Equal(t, "jwt", flags.JWTLoginPath)
+}
+
+func TestCertAuthMechanism(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--cert-auth-client-cert", "host.crt", "--cert-auth-client-key", "host.key"})
+	assert.NoError(t, err)
+	assert.Equal(t, CertAuth, flags.AuthMechanism())
+	assert.Equal(t, "cert", flags.CertLoginPath)
+
+	_, err = ProcessFlags([]string{"--init", "--cert-auth-client-cert", "host.crt"})
+	assert.Error(t, err, "a client certificate without a key must be rejected")
+}
+
+func TestAuthChain(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--auth-chain", "kubernetes, iam,approle",
+		"--k8s-auth-role", "example", "--iam-auth-role", "example", "--approle-role-id", "my-role"})
+	assert.NoError(t, err)
+	assert.Equal(t, []AuthMechanismType{KubernetesAuth, EC2IAMAuth, AppRoleAuth}, flags.AuthMechanisms())
+	assert.True(t, flags.UsesAuthMechanism(KubernetesAuth))
+	assert.False(t, flags.UsesAuthMechanism(EC2AMIAuth))
+
+	// --ec2-auth and --iam-auth-role can be combined in a chain.
+	flags, err = ProcessFlags([]string{"--init", "--auth-chain", "ec2,iam", "--ec2-auth", "--iam-auth-role", "example"})
+	assert.NoError(t, err)
+	assert.Equal(t, []AuthMechanismType{EC2AMIAuth, EC2IAMAuth}, flags.AuthMechanisms())
+
+	// Without a chain, the single mechanism implied by the flags is used.
+	flags, err = ProcessFlags([]string{"--init", "--iam-auth-role", "example"})
+	assert.NoError(t, err)
+	assert.Equal(t, []AuthMechanismType{EC2IAMAuth}, flags.AuthMechanisms())
+}
+
+func TestInvalidAuthChain(t *testing.T) {
+	_, err := ProcessFlags([]string{"--init", "--auth-chain", "kubernetes,magic", "--k8s-auth-role", "example"})
+	assert.Error(t, err, "unknown mechanisms must be rejected")
+
+	_, err = ProcessFlags([]string{"--init", "--auth-chain", "kubernetes,iam", "--k8s-auth-role", "example"})
+	assert.Error(t, err, "mechanisms missing their flags must be rejected")
+
+	_, err = ProcessFlags([]string{"--init", "--auth-chain", "ec2,ec2"})
+	assert.Error(t, err, "mechanisms must not be repeated")
+
+	_, err = ProcessFlags([]string{"--init", "--ec2-auth", "--iam-auth-role", "example"})
+	assert.Error(t, err, "ec2 and iam cannot be combined without a chain")
+}
+
+func TestExecMode(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--exec", "--vault-token", "unit-test-token", "--", "my-app", "--port", "8080"})
+	assert.NoError(t, err)
+	assert.Equal(t, ModeExec, flags.RunMode())
+	assert.Equal(t, []string{"my-app", "--port", "8080"}, flags.ExecCommand)
+
+	_, err = ProcessFlags([]string{"--exec"})
+	assert.Error(t, err, "--exec needs a command")
+
+	_, err = ProcessFlags([]string{"--init", "--", "my-app"})
+	assert.Error(t, err, "a command is only allowed with --exec")
+
+	_, err = ProcessFlags([]string{"--exec", "--sidecar", "--", "my-app"})
+	assert.Error(t, err, "--exec is its own run mode")
+}
+
+func TestPlanFlag(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--plan"})
+	assert.NoError(t, err)
+	assert.True(t, flags.PerformPlan)
+
+	_, err = ProcessFlags([]string{"--sidecar", "--one-shot", "--plan"})
+	assert.NoError(t, err)
+
+	_, err = ProcessFlags([]string{"--sidecar", "--plan"})
+	assert.Error(t, err, "--plan needs --one-shot in sidecar mode")
+
+	_, err = ProcessFlags([]string{"--cleanup", "--plan"})
+	assert.Error(t, err, "--plan can't be used with --cleanup")
+}
+
+func TestValidateFlag(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--validate"})
+	assert.NoError(t, err)
+	assert.Equal(t, ModeValidate, flags.RunMode())
+	assert.Equal(t, ValidateOutputHuman, flags.ValidateOutput)
+
+	flags, err = ProcessFlags([]string{"--validate", "--validate-output", "json"})
+	assert.NoError(t, err)
+	assert.Equal(t, ValidateOutputJSON, flags.ValidateOutput)
+
+	_, err = ProcessFlags([]string{"--validate", "--validate-output", "xml"})
+	assert.Error(t, err, "only human and json output is supported")
+
+	_, err = ProcessFlags([]string{"--validate", "--init"})
+	assert.Error(t, err, "--validate is its own run mode")
+}
+
+func TestStatusFlag(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--status"})
+	assert.NoError(t, err)
+	assert.Equal(t, ModeStatus, flags.RunMode())
+	assert.Equal(t, StatusOutputTable, flags.StatusOutput)
+
+	flags, err = ProcessFlags([]string{"--status", "--status-output", "json"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusOutputJSON, flags.StatusOutput)
+
+	_, err = ProcessFlags([]string{"--status", "--sidecar"})
+	assert.Error(t, err, "--status is its own run mode")
+}
+
+func TestBriefcaseKeyFlags(t *testing.T) {
+	flags, err := ProcessFlags([]string{"--init", "--briefcase-transit-key", "briefcase"})
+	assert.NoError(t, err)
+	assert.Equal(t, "transit", flags.BriefcaseTransitMount)
+
+	_, err = ProcessFlags([]string{"--init", "--briefcase-key-file", "key", "--briefcase-key-env", "KEY"})
+	assert.Error(t, err, "only one briefcase key can be used")
+}
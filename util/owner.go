@@ -0,0 +1,112 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// FileOwner is the numeric user and group given to output files, and to the directories created for them. An ID of
+// -1 leaves it alone, as with os.Chown.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// NoFileOwner leaves both the user and group of files alone.
+var NoFileOwner = FileOwner{UID: -1, GID: -1}
+
+// IsSet returns true if either the user or the group is to be changed.
+func (owner FileOwner) IsSet() bool {
+	return owner.UID != -1 || owner.GID != -1
+}
+
+// HasModeAndOwner returns true if the file already has the mode and owner it would be written with. The parts of
+// the owner that are left alone always match.
+func HasModeAndOwner(info os.FileInfo, mode os.FileMode, owner FileOwner) bool {
+	if info.Mode().Perm() != mode.Perm() {
+		return false
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if (owner.UID != -1 && int(stat.Uid) != owner.UID) || (owner.GID != -1 && int(stat.Gid) != owner.GID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LookupFileOwner turns an owner and group, each a name or a numeric ID, into a FileOwner. An empty owner or group
+// is left alone.
+func LookupFileOwner(owner, group string) (*FileOwner, error) {
+	fileOwner := NoFileOwner
+
+	if owner != "" {
+		if uid, err := strconv.Atoi(owner); err == nil {
+			fileOwner.UID = uid
+		} else {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return nil, fmt.Errorf("could not find owner %q: %w", owner, err)
+			}
+			if fileOwner.UID, err = strconv.Atoi(u.Uid); err != nil {
+				return nil, fmt.Errorf("owner %q has a non-numeric uid %q", owner, u.Uid)
+			}
+		}
+	}
+
+	if group != "" {
+		if gid, err := strconv.Atoi(group); err == nil {
+			fileOwner.GID = gid
+		} else {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return nil, fmt.Errorf("could not find group %q: %w", group, err)
+			}
+			if fileOwner.GID, err = strconv.Atoi(g.Gid); err != nil {
+				return nil, fmt.Errorf("group %q has a non-numeric gid %q", group, g.Gid)
+			}
+		}
+	}
+
+	if fileOwner.UID < -1 || fileOwner.GID < -1 {
+		return nil, fmt.Errorf("owner %q and group %q must not be negative", owner, group)
+	}
+
+	return &fileOwner, nil
+}
+
+// MkdirAllOwned is os.MkdirAll, except the directories it creates are given to the owner. Directories that
+// already exist are left alone.
+func MkdirAllOwned(dir string, perm os.FileMode, owner FileOwner) error {
+	// Find the directories that don't exist yet, from the deepest up.
+	var missing []string
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		if _, err := os.Stat(current); err == nil {
+			break
+		}
+		missing = append(missing, current)
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	if !owner.IsSet() {
+		return nil
+	}
+
+	for _, created := range missing {
+		if err := os.Chown(created, owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("could not change owner of directory %q: %w", created, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupFileOwner(t *testing.T) {
+	if owner, err := LookupFileOwner("", ""); err != nil || *owner != NoFileOwner {
+		t.Errorf("An empty owner and group must be left alone, not %v (%v).", owner, err)
+	}
+
+	if owner, err := LookupFileOwner("1001", "2002"); err != nil || *owner != (FileOwner{UID: 1001, GID: 2002}) {
+		t.Errorf("Numeric IDs must be used as they are, not %v (%v).", owner, err)
+	}
+
+	if owner, err := LookupFileOwner("root", ""); err != nil || *owner != (FileOwner{UID: 0, GID: -1}) {
+		t.Errorf("The owner root must be uid 0, not %v (%v).", owner, err)
+	}
+
+	if _, err := LookupFileOwner("no-such-user-for-vault-ctrl-tool", ""); err == nil {
+		t.Error("Unknown owners must be an error.")
+	}
+
+	if _, err := LookupFileOwner("", "-5"); err == nil {
+		t.Error("Negative IDs must be an error.")
+	}
+}
+
+func TestMkdirAllOwned(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "a", "b")
+
+	// Giving directories to the current user works without root.
+	owner := FileOwner{UID: os.Geteuid(), GID: os.Getegid()}
+	if err := MkdirAllOwned(dir, 0700, owner); err != nil {
+		t.Fatalf("Could not create directories: %v", err)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Expected %q to be a directory (%v).", dir, err)
+	}
+}
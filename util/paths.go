@@ -32,7 +32,12 @@ func AbsolutePath(prefix string, filename string) string {
 }
 
 func MustMkdirAllForFile(filename string) {
-	err := os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	MustMkdirAllForFileOwned(filename, NoFileOwner)
+}
+
+// MustMkdirAllForFileOwned creates the directories needed for the file, giving the ones it creates to the owner.
+func MustMkdirAllForFileOwned(filename string, owner FileOwner) {
+	err := MkdirAllOwned(filepath.Dir(filename), os.ModePerm, owner)
 	if err != nil {
 		log.Fatal().Str("filename", filename).Err(err).Msg("failed to create all needed directories")
 	}
@@ -0,0 +1,207 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+// A Plan records what a sync would change, without changing it. Like a clock, a Plan is "injected" via a
+// context.Context. Code that writes files, issues credentials or otherwise changes things calls "plan.Get(ctx)"
+// first, and records what it would have done when a Plan is returned.
+
+var contextKey = "vctPlan"
+
+// Set creates a new Context that plans instead of changing anything.
+func Set(ctx context.Context, p *Plan) context.Context {
+	return context.WithValue(ctx, &contextKey, p)
+}
+
+// Get returns the Plan to record changes in, or nil if changes are to be made.
+func Get(ctx context.Context) *Plan {
+	if p, ok := ctx.Value(&contextKey).(*Plan); ok {
+		return p
+	}
+	return nil
+}
+
+// FileChange is what would happen to an output file.
+type FileChange string
+
+const (
+	Create    FileChange = "create"
+	Rewrite   FileChange = "rewrite"
+	Unchanged FileChange = "unchanged"
+)
+
+// File is an output file the sync would write. Only the number of lines added and removed is kept, so a plan never
+// shows the contents of a secret.
+type File struct {
+	Filename string
+	Change   FileChange
+	Added    int
+	Removed  int
+}
+
+// plannedFile is a File, along with what is in it now and what the sync would write to it.
+type plannedFile struct {
+	File
+	existed  bool
+	original []byte
+	planned  []byte
+	// attributesMatch is true if the file already has the mode and owner it would be written with.
+	attributesMatch bool
+}
+
+type Plan struct {
+	mutex   sync.Mutex
+	files   map[string]*plannedFile
+	actions []string
+}
+
+func NewPlan() *Plan {
+	return &Plan{
+		files: make(map[string]*plannedFile),
+	}
+}
+
+// File records that filename would be written with contents, mode and owner, and returns true if that changes the
+// file. As when writing it, a file whose contents are the same but whose mode or owner differ is rewritten. Files
+// written more than once in a sync are compared against what was planned for them before.
+func (p *Plan) File(filename string, mode os.FileMode, owner util.FileOwner, contents []byte) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	file, seen := p.files[filename]
+	if !seen {
+		file = &plannedFile{File: File{Filename: filename}}
+		if original, err := ioutil.ReadFile(filename); err == nil {
+			file.existed = true
+			file.original = original
+			file.planned = original
+			if info, err := os.Stat(filename); err == nil {
+				file.attributesMatch = util.HasModeAndOwner(info, mode, owner)
+			}
+		}
+		p.files[filename] = file
+	}
+
+	changed := !(seen || file.existed) || !bytes.Equal(file.planned, contents) || !(seen || file.attributesMatch)
+	file.planned = contents
+
+	switch {
+	case !file.existed:
+		file.Change = Create
+		file.Added, file.Removed = diffLines(nil, contents)
+	case bytes.Equal(file.original, contents) && file.attributesMatch:
+		file.Change = Unchanged
+		file.Added, file.Removed = 0, 0
+	default:
+		file.Change = Rewrite
+		file.Added, file.Removed = diffLines(file.original, contents)
+	}
+
+	return changed
+}
+
+// Action records something the sync would do other than write an output file, such as issuing a credential.
+func (p *Plan) Action(format string, args ...interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.actions = append(p.actions, fmt.Sprintf(format, args...))
+}
+
+// Files returns the output files the sync would write, sorted by name.
+func (p *Plan) Files() []File {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var files []File
+	for _, file := range p.files {
+		files = append(files, file.File)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Filename < files[j].Filename })
+	return files
+}
+
+// Actions returns everything other than writing output files the sync would do, in order.
+func (p *Plan) Actions() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]string(nil), p.actions...)
+}
+
+// Summary writes the plan for people to read. File contents are never shown, only how many lines would change.
+func (p *Plan) Summary(w io.Writer) error {
+	files := p.Files()
+	actions := p.Actions()
+
+	counts := make(map[FileChange]int)
+	for _, file := range files {
+		counts[file.Change]++
+	}
+
+	var sb strings.Builder
+
+	for _, file := range files {
+		switch file.Change {
+		case Create:
+			fmt.Fprintf(&sb, "  + %s (create, %d lines)\n", file.Filename, file.Added)
+		case Rewrite:
+			fmt.Fprintf(&sb, "  ~ %s (rewrite, +%d -%d lines)\n", file.Filename, file.Added, file.Removed)
+		case Unchanged:
+			fmt.Fprintf(&sb, "  = %s (unchanged)\n", file.Filename)
+		}
+	}
+
+	for _, action := range actions {
+		fmt.Fprintf(&sb, "  ! %s\n", action)
+	}
+
+	fmt.Fprintf(&sb, "Plan: %d to create, %d to rewrite, %d unchanged, %d other actions. Secret values are not shown.\n",
+		counts[Create], counts[Rewrite], counts[Unchanged], len(actions))
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// diffLines counts the lines only in after (added) and only in before (removed), ignoring their order.
+func diffLines(before, after []byte) (int, int) {
+	lines := make(map[string]int)
+	for _, line := range splitLines(before) {
+		lines[line]++
+	}
+
+	added := 0
+	for _, line := range splitLines(after) {
+		if lines[line] > 0 {
+			lines[line]--
+		} else {
+			added++
+		}
+	}
+
+	removed := 0
+	for _, count := range lines {
+		removed += count
+	}
+
+	return added, removed
+}
+
+func splitLines(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+}
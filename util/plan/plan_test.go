@@ -0,0 +1,71 @@
+package plan
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	same := filepath.Join(dir, "same")
+	chmod := filepath.Join(dir, "chmod")
+	created := filepath.Join(dir, "created")
+
+	assert.NoError(t, ioutil.WriteFile(existing, []byte("user=app\npassword=hunter2\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(same, []byte("unchanged"), 0600))
+	assert.NoError(t, ioutil.WriteFile(chmod, []byte("unchanged"), 0644))
+
+	p := NewPlan()
+	assert.True(t, p.File(existing, 0600, util.NoFileOwner, []byte("user=app\npassword=correct horse\n")))
+	assert.False(t, p.File(same, 0600, util.NoFileOwner, []byte("unchanged")))
+	assert.True(t, p.File(created, 0600, util.NoFileOwner, []byte("one\ntwo\n")))
+
+	// A file with the same contents but a different mode is rewritten, as it would be by a sync.
+	assert.True(t, p.File(chmod, 0600, util.NoFileOwner, []byte("unchanged")))
+
+	// Writing the same contents again during a sync doesn't change the file again.
+	assert.False(t, p.File(created, 0600, util.NoFileOwner, []byte("one\ntwo\n")))
+
+	assert.Equal(t, []File{
+		{Filename: chmod, Change: Rewrite},
+		{Filename: created, Change: Create, Added: 2},
+		{Filename: existing, Change: Rewrite, Added: 1, Removed: 1},
+		{Filename: same, Change: Unchanged},
+	}, p.Files())
+
+	// Nothing was written.
+	_, err := ioutil.ReadFile(created)
+	assert.Error(t, err)
+	contents, _ := ioutil.ReadFile(existing)
+	assert.Equal(t, "user=app\npassword=hunter2\n", string(contents))
+}
+
+func TestPlanSummaryRedactsValues(t *testing.T) {
+	dir := t.TempDir()
+
+	p := NewPlan()
+	p.File(filepath.Join(dir, "password"), 0600, util.NoFileOwner, []byte("hunter2"))
+	p.Action("issue AWS credentials for role %q into %q", "example", "/etc/aws")
+
+	var summary strings.Builder
+	assert.NoError(t, p.Summary(&summary))
+
+	assert.NotContains(t, summary.String(), "hunter2")
+	assert.Contains(t, summary.String(), "+ "+filepath.Join(dir, "password")+" (create, 1 lines)")
+	assert.Contains(t, summary.String(), `! issue AWS credentials for role "example" into "/etc/aws"`)
+	assert.Contains(t, summary.String(), "Plan: 1 to create, 0 to rewrite, 0 unchanged, 1 other actions.")
+}
+
+func TestGet(t *testing.T) {
+	assert.Nil(t, Get(context.Background()))
+
+	p := NewPlan()
+	assert.Same(t, p, Get(Set(context.Background(), p)))
+}
@@ -5,6 +5,10 @@ import "github.com/hashicorp/vault/api"
 type WrappedToken struct {
 	*api.Secret
 	Renewable bool
+	// AuthMechanism is the name of the mechanism that created this token, if the tool authenticated to get it.
+	AuthMechanism string
+	// Namespace is the Vault Enterprise namespace the token belongs to, empty for the root namespace.
+	Namespace string
 }
 
 func NewWrappedToken(secret *api.Secret, renewable bool) *WrappedToken {
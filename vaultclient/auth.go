@@ -35,19 +35,53 @@ type kubernetesAuthenticator struct {
 	k8sLoginPath        string
 	k8sAuthRole         string
 }
+
+type approleAuthenticator struct {
+	authenticator
+	// approle
+	roleID          string
+	roleIDFile      string
+	secretIDFile    string
+	secretIDWrapped bool
+	loginPath       string
+}
+
+type jwtAuthenticator struct {
+	authenticator
+	// jwt
+	jwtTokenFile string
+	jwtLoginPath string
+	jwtAuthRole  string
+}
+
+type certAuthenticator struct {
+	authenticator
+	// cert
+	clientCert    string
+	clientKey     string
+	certRole      string
+	certLoginPath string
+}
+
 type Authenticator interface {
 	Authenticate() (*util.WrappedToken, error)
 }
 
+// NewAuthenticator creates an Authenticator for the single authentication mechanism implied by the CLI flags.
 func NewAuthenticator(client VaultClient, cliFlags util.CliFlags) (Authenticator, error) {
-	log := zlog.With().Str("vaultAddr", client.Address()).Logger()
+	return NewAuthenticatorForMechanism(client, cliFlags, cliFlags.AuthMechanism())
+}
+
+// NewAuthenticatorForMechanism creates an Authenticator for a specific authentication mechanism, using the CLI
+// flags for its settings. This is used when walking through an --auth-chain.
+func NewAuthenticatorForMechanism(client VaultClient, cliFlags util.CliFlags, mechanism util.AuthMechanismType) (Authenticator, error) {
+	log := zlog.With().Str("vaultAddr", client.Address()).Stringer("authMechanism", mechanism).Logger()
 
 	shared := authenticator{
 		log:         log,
 		vaultClient: client,
 	}
 
-	mechanism := cliFlags.AuthMechanism()
 	switch mechanism {
 	case util.EC2IAMAuth:
 		region := os.Getenv("AWS_DEFAULT_REGION")
@@ -76,6 +110,33 @@ func NewAuthenticator(client VaultClient, cliFlags util.CliFlags) (Authenticator
 			k8sAuthRole:         cliFlags.KubernetesAuthRole,
 		}
 		return authn, nil
+	case util.AppRoleAuth:
+		authn := &approleAuthenticator{
+			authenticator:   shared,
+			roleID:          cliFlags.AppRoleRoleID,
+			roleIDFile:      cliFlags.AppRoleRoleIDFile,
+			secretIDFile:    cliFlags.AppRoleSecretIDFile,
+			secretIDWrapped: cliFlags.AppRoleSecretIDWrapped,
+			loginPath:       cliFlags.AppRoleLoginPath,
+		}
+		return authn, nil
+	case util.JWTAuth:
+		authn := &jwtAuthenticator{
+			authenticator: shared,
+			jwtTokenFile:  cliFlags.JWTTokenFile,
+			jwtLoginPath:  cliFlags.JWTLoginPath,
+			jwtAuthRole:   cliFlags.JWTAuthRole,
+		}
+		return authn, nil
+	case util.CertAuth:
+		authn := &certAuthenticator{
+			authenticator: shared,
+			clientCert:    cliFlags.CertAuthClientCert,
+			clientKey:     cliFlags.CertAuthClientKey,
+			certRole:      cliFlags.CertAuthRole,
+			certLoginPath: cliFlags.CertLoginPath,
+		}
+		return authn, nil
 	case util.UnknownAuth:
 		return nil, fmt.Errorf("no authentication mechanism specified")
 	default:
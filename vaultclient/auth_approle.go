@@ -0,0 +1,122 @@
+package vaultclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+func (auth *approleAuthenticator) Authenticate() (*util.WrappedToken, error) {
+	secret, err := auth.performAppRoleAuth()
+	if err != nil {
+		auth.log.Error().Err(err).Msg("approle authentication failed")
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (auth *approleAuthenticator) performAppRoleAuth() (*util.WrappedToken, error) {
+
+	roleID, err := auth.readRoleID()
+	if err != nil {
+		return nil, err
+	}
+
+	loginData := map[string]interface{}{
+		"role_id": roleID,
+	}
+
+	// The secret-id is re-read every time so that something outside the tool can rotate it.
+	if auth.secretIDFile != "" {
+		secretID, err := auth.readSecretID()
+		if err != nil {
+			return nil, err
+		}
+		loginData["secret_id"] = secretID
+	}
+
+	auth.log.Info().Str("authPath", auth.loginPath).Bool("secretIDWrapped", auth.secretIDWrapped).Msg("authenticating")
+
+	secret, err := auth.vaultClient.Delegate().Logical().Write(fmt.Sprintf("auth/%s/login", auth.loginPath), loginData)
+	if err != nil {
+		return nil, fmt.Errorf("could not authenticate to vault using approle authentication: %w", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("empty response from approle login")
+	}
+
+	return util.NewWrappedToken(secret, true), nil
+}
+
+func (auth *approleAuthenticator) readRoleID() (string, error) {
+	if auth.roleID != "" {
+		return auth.roleID, nil
+	}
+
+	roleIDBytes, err := ioutil.ReadFile(auth.roleIDFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read approle role-id file %q: %w", auth.roleIDFile, err)
+	}
+
+	roleID := strings.TrimSpace(string(roleIDBytes))
+	if roleID == "" {
+		return "", fmt.Errorf("approle role-id file %q is empty", auth.roleIDFile)
+	}
+	return roleID, nil
+}
+
+func (auth *approleAuthenticator) readSecretID() (string, error) {
+	auth.log.Info().Str("secretIDFile", auth.secretIDFile).Msg("reading approle secret-id")
+
+	secretIDBytes, err := ioutil.ReadFile(auth.secretIDFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read approle secret-id file %q: %w", auth.secretIDFile, err)
+	}
+
+	secretID := strings.TrimSpace(string(secretIDBytes))
+	if secretID == "" {
+		return "", fmt.Errorf("approle secret-id file %q is empty", auth.secretIDFile)
+	}
+
+	if !auth.secretIDWrapped {
+		return secretID, nil
+	}
+
+	return auth.unwrapSecretID(secretID)
+}
+
+// unwrapSecretID exchanges a response-wrapping token for the secret-id it wraps. This is done as a raw request
+// so the wrapping token is used as the client token, regardless of whatever token the client currently holds.
+func (auth *approleAuthenticator) unwrapSecretID(wrappingToken string) (string, error) {
+	auth.log.Debug().Msg("unwrapping approle secret-id")
+
+	req := auth.vaultClient.Delegate().NewRequest(http.MethodPut, "/v1/sys/wrapping/unwrap")
+	req.ClientToken = wrappingToken
+
+	resp, err := auth.vaultClient.Delegate().RawRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap approle secret-id from %q: %w", auth.secretIDFile, err)
+	}
+
+	var body api.Secret
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error parsing unwrap response: %w", err)
+	}
+
+	secretID, ok := body.Data["secret_id"].(string)
+	if !ok || secretID == "" {
+		return "", errors.New("unwrapped response did not contain a secret_id")
+	}
+
+	return secretID, nil
+}
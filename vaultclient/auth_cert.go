@@ -0,0 +1,84 @@
+package vaultclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+func (auth *certAuthenticator) Authenticate() (*util.WrappedToken, error) {
+	secret, err := auth.performCertAuth()
+	if err != nil {
+		auth.log.Error().Err(err).Msg("tls certificate authentication failed")
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+func (auth *certAuthenticator) performCertAuth() (*util.WrappedToken, error) {
+
+	loginClient, err := auth.newLoginClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var loginData map[string]interface{}
+	if auth.certRole != "" {
+		loginData = map[string]interface{}{
+			"name": auth.certRole,
+		}
+	}
+
+	auth.log.Info().Str("authPath", auth.certLoginPath).Str("certRole", auth.certRole).Msg("authenticating")
+
+	secret, err := loginClient.Logical().Write(fmt.Sprintf("auth/%s/login", auth.certLoginPath), loginData)
+	if err != nil {
+		return nil, fmt.Errorf("could not authenticate to vault using tls certificate authentication: %w", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("empty response from tls certificate login")
+	}
+
+	return util.NewWrappedToken(secret, true), nil
+}
+
+// newLoginClient builds a Vault client that presents the configured client certificate. The certificate and key are
+// loaded from disk every time so a rotated machine certificate is picked up the next time authentication happens. A
+// separate client (with a copy of the shared client's transport) is used so the certificate never leaks into the
+// shared client, while its TLS settings (such as the CA certificate of a connection) and timeout still apply. Headers,
+// including any namespace, are copied from the shared client.
+func (auth *certAuthenticator) newLoginClient() (*api.Client, error) {
+	auth.log.Info().Str("clientCert", auth.clientCert).Str("clientKey", auth.clientKey).Msg("loading client certificate")
+
+	conf := auth.vaultClient.Delegate().CloneConfig()
+
+	shared := conf.HttpClient
+	transport, ok := shared.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("could not copy the Vault client's transport, it is a %T", shared.Transport)
+	}
+	conf.HttpClient = &http.Client{
+		Transport:     transport.Clone(),
+		CheckRedirect: shared.CheckRedirect,
+		Timeout:       shared.Timeout,
+	}
+
+	if err := conf.ConfigureTLS(&api.TLSConfig{
+		ClientCert: auth.clientCert,
+		ClientKey:  auth.clientKey,
+	}); err != nil {
+		return nil, fmt.Errorf("could not load client certificate %q with key %q: %w", auth.clientCert, auth.clientKey, err)
+	}
+
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Vault client for tls certificate authentication: %w", err)
+	}
+	client.ClearToken()
+	client.SetHeaders(auth.vaultClient.Delegate().Headers())
+
+	return client, nil
+}
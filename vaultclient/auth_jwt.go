@@ -0,0 +1,68 @@
+package vaultclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+func (auth *jwtAuthenticator) Authenticate() (*util.WrappedToken, error) {
+	secret, err := auth.performJWTAuth()
+	if err != nil {
+		auth.log.Error().Err(err).Msg("jwt authentication failed")
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// performJWTAuth reads the JWT from disk every time it is called. Workload identity systems (SPIFFE, Nomad,
+// projected ServiceAccount tokens, etc) rewrite this file with short-lived tokens, so it must never be cached.
+func (auth *jwtAuthenticator) performJWTAuth() (*util.WrappedToken, error) {
+	type login struct {
+		JWT  string `json:"jwt"`
+		Role string `json:"role,omitempty"`
+	}
+
+	auth.log.Info().Str("jwtTokenFile", auth.jwtTokenFile).Msg("reading jwt")
+
+	tokenBytes, err := ioutil.ReadFile(auth.jwtTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read jwt file %q: %w", auth.jwtTokenFile, err)
+	}
+
+	jwt := strings.TrimSpace(string(tokenBytes))
+	if jwt == "" {
+		return nil, fmt.Errorf("jwt file %q is empty", auth.jwtTokenFile)
+	}
+
+	auth.log.Info().Str("authPath", auth.jwtLoginPath).Str("jwtRole", auth.jwtAuthRole).Msg("authenticating")
+
+	req := auth.vaultClient.Delegate().NewRequest(http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", auth.jwtLoginPath))
+	err = req.SetJSONBody(&login{JWT: jwt, Role: auth.jwtAuthRole})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JSON body: %w", err)
+	}
+
+	resp, err := auth.vaultClient.Delegate().RawRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform JWT auth request: %w", err)
+	}
+
+	var body api.Secret
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+
+	return util.NewWrappedToken(&body, true), nil
+}
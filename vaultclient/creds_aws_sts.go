@@ -19,7 +19,12 @@ func (vc *wrappedVaultClient) FetchAWSSTSCredential(awsConfig config.AWSType, st
 
 	path := filepath.Join(awsConfig.VaultMountPoint, "creds", awsConfig.VaultRole)
 
-	log := vc.log.With().Str("path", path).
+	client, err := vc.namespaced(awsConfig.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log := client.log.With().Str("path", path).
 		Str("outputPath", awsConfig.OutputPath).Logger()
 
 	log.Info().Msg("fetching AWS STS credentials")
@@ -31,7 +36,7 @@ func (vc *wrappedVaultClient) FetchAWSSTSCredential(awsConfig config.AWSType, st
 		}
 	}
 
-	result, err := vc.Delegate().Logical().Write(path, data)
+	result, err := client.Delegate().Logical().Write(path, data)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to fetch AWS credentials")
 		return nil, nil, fmt.Errorf("could not fetch AWS credentials from %q: %w", path, err)
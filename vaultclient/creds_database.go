@@ -0,0 +1,40 @@
+package vaultclient
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+)
+
+// FetchDatabaseCredential asks the database secrets engine for a new username and password. The returned secret
+// has the lease that must be renewed to keep the credential alive.
+func (vc *wrappedVaultClient) FetchDatabaseCredential(dbConfig config.DatabaseType) (*api.Secret, error) {
+
+	path := filepath.Join(dbConfig.VaultMountPoint, "creds", dbConfig.VaultRole)
+
+	client, err := vc.namespaced(dbConfig.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	log := client.log.With().Str("path", path).Str("key", dbConfig.Key).Logger()
+
+	log.Info().Msg("fetching database credentials")
+
+	result, err := client.Delegate().Logical().Read(path)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to fetch database credentials")
+		return nil, fmt.Errorf("could not fetch database credentials from %q: %w", path, err)
+	}
+
+	if result == nil || result.LeaseID == "" {
+		return nil, fmt.Errorf("no leased credentials returned from %q", path)
+	}
+
+	log.Debug().Interface("username", result.Data["username"]).Str("leaseID", result.LeaseID).
+		Int("leaseDuration", result.LeaseDuration).Msg("received database credentials")
+
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package vaultclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+)
+
+// FetchDynamicSecret reads from (or writes to) the path of a dynamic stanza. The returned secret must be leased,
+// as that's what lets it be renewed rather than fetched on every sync.
+func (vc *wrappedVaultClient) FetchDynamicSecret(dynConfig config.DynamicType) (*api.Secret, error) {
+
+	path := strings.TrimPrefix(dynConfig.Path, "/")
+
+	client, err := vc.namespaced(dynConfig.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	log := client.log.With().Str("path", path).Str("key", dynConfig.Key).Str("method", dynConfig.Method).Logger()
+
+	log.Info().Msg("fetching dynamic secret")
+
+	var result *api.Secret
+	if dynConfig.Method == config.DynamicMethodWrite {
+		data := make(map[string]interface{}, len(dynConfig.Data))
+		for k, v := range dynConfig.Data {
+			data[k] = v
+		}
+		result, err = client.Delegate().Logical().Write(path, data)
+	} else {
+		result, err = client.Delegate().Logical().Read(path)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("failed to fetch dynamic secret")
+		return nil, fmt.Errorf("could not fetch dynamic secret from %q: %w", path, err)
+	}
+
+	if result == nil || result.LeaseID == "" {
+		return nil, fmt.Errorf("no leased secret returned from %q", path)
+	}
+
+	log.Debug().Str("leaseID", result.LeaseID).Int("leaseDuration", result.LeaseDuration).
+		Bool("renewable", result.Renewable).Msg("received dynamic secret")
+
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package vaultclient
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hootsuite/vault-ctrl-tool/v2/config"
+	"github.com/hootsuite/vault-ctrl-tool/v2/util"
+)
+
+// CreatePKICertificate asks the PKI secrets engine to issue a certificate, and writes the certificate, private key,
+// CA chain and issuing CA into the output path of the stanza.
+func (vc *wrappedVaultClient) CreatePKICertificate(pkiConfig config.PKICertificateType) error {
+
+	path := filepath.Join(pkiConfig.VaultMountPoint, "issue", pkiConfig.VaultRole)
+
+	client, err := vc.namespaced(pkiConfig.Namespace)
+	if err != nil {
+		return err
+	}
+
+	log := client.log.With().Str("path", path).Str("commonName", pkiConfig.CommonName).
+		Str("outputPath", pkiConfig.OutputPath).Logger()
+
+	mode, err := util.StringToFileMode(pkiConfig.Mode)
+	if err != nil {
+		return fmt.Errorf("could not parse file mode %q for pki certificate %q: %w", pkiConfig.Mode, pkiConfig.CommonName, err)
+	}
+
+	owner, err := util.LookupFileOwner(pkiConfig.Owner, pkiConfig.Group)
+	if err != nil {
+		return fmt.Errorf("could not find owner for PKI certificate in %q: %w", pkiConfig.OutputPath, err)
+	}
+
+	data := map[string]interface{}{
+		"common_name": pkiConfig.CommonName,
+	}
+	if len(pkiConfig.AltNames) > 0 {
+		data["alt_names"] = strings.Join(pkiConfig.AltNames, ",")
+	}
+	if len(pkiConfig.IPSans) > 0 {
+		data["ip_sans"] = strings.Join(pkiConfig.IPSans, ",")
+	}
+	if pkiConfig.TTL != "" {
+		data["ttl"] = pkiConfig.TTL
+	}
+
+	log.Info().Msg("issuing PKI certificate")
+
+	resp, err := client.Delegate().Logical().Write(path, data)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to issue PKI certificate")
+		return fmt.Errorf("could not issue PKI certificate from %q: %w", path, err)
+	}
+
+	if resp == nil {
+		return fmt.Errorf("no certificate returned from %q", path)
+	}
+
+	certificate, _ := resp.Data["certificate"].(string)
+	privateKey, _ := resp.Data["private_key"].(string)
+	issuingCA, _ := resp.Data["issuing_ca"].(string)
+
+	if certificate == "" || privateKey == "" {
+		return fmt.Errorf("did not receive a certificate and private key from Vault at %q issuing from %q", vc.Address(), path)
+	}
+
+	// Older versions of Vault leave out ca_chain when the issuing CA is a root.
+	var chain []string
+	if caChain, ok := resp.Data["ca_chain"].([]interface{}); ok {
+		for _, ca := range caChain {
+			if pem, ok := ca.(string); ok {
+				chain = append(chain, pem)
+			}
+		}
+	}
+	if len(chain) == 0 && issuingCA != "" {
+		chain = append(chain, issuingCA)
+	}
+
+	if err := util.MkdirAllOwned(pkiConfig.OutputPath, 0700, *owner); err != nil {
+		return fmt.Errorf("could not make directory path %q: %w", pkiConfig.OutputPath, err)
+	}
+
+	files := []struct {
+		filename string
+		contents string
+	}{
+		{util.PKIPrivateKey, privateKey},
+		{util.PKIChain, strings.Join(chain, "\n")},
+		{util.PKICABundle, issuingCA},
+		// The certificate goes last, as it's what is read back to determine when it expires.
+		{util.PKICertificate, certificate},
+	}
+
+	for _, f := range files {
+		filename := filepath.Join(pkiConfig.OutputPath, f.filename)
+		log.Debug().Str("filename", filename).Msg("writing PKI file")
+
+		if err := util.WriteFileAtomic(filename, []byte(strings.TrimSpace(f.contents)+"\n"), *mode, *owner); err != nil {
+			return err
+		}
+	}
+
+	log.Info().Interface("serialNumber", resp.Data["serial_number"]).Msg("wrote PKI certificate")
+
+	return nil
+}
@@ -7,9 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
-	"syscall"
 
 	"github.com/hootsuite/vault-ctrl-tool/v2/util"
 
@@ -18,37 +16,41 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// SSHPrivateKey is the name of the output file with the the SSH private key (think: ssh -i id_rsa ....).
-const SSHPrivateKey = "id_rsa"
+func (vc *wrappedVaultClient) CreateSSHCertificate(ssh config.SSHCertificateType) error {
 
-// SSHPublicKey is the corresponding public key, used for signing.
-const SSHPublicKey = "id_rsa.pub"
+	client, err := vc.namespaced(ssh.Namespace)
+	if err != nil {
+		return err
+	}
 
-func (vc *wrappedVaultClient) CreateSSHCertificate(ssh config.SSHCertificateType) error {
+	log := client.log.With().Str("vaultRole", ssh.VaultRole).Logger()
 
-	log := vc.log.With().Str("vaultRole", ssh.VaultRole).Logger()
+	privateKeyFilename := filepath.Join(ssh.OutputPath, util.SSHPrivateKey)
+	publicKeyFilename := filepath.Join(ssh.OutputPath, util.SSHPublicKey)
 
-	privateKeyFilename := filepath.Join(ssh.OutputPath, SSHPrivateKey)
-	publicKeyFilename := filepath.Join(ssh.OutputPath, SSHPublicKey)
+	owner, err := util.LookupFileOwner(ssh.Owner, ssh.Group)
+	if err != nil {
+		return fmt.Errorf("could not find owner for SSH certificate in %q: %w", ssh.OutputPath, err)
+	}
 
 	// I'd use util.MustMakeDirAllForFile, but I want to set the directory permission
-	if err := os.MkdirAll(ssh.OutputPath, 0700); err != nil {
+	if err := util.MkdirAllOwned(ssh.OutputPath, 0700, *owner); err != nil {
 		return fmt.Errorf("could not make directory path %q: %w", ssh.OutputPath, err)
 	}
 
 	log.Info().Str("privateKey", privateKeyFilename).Str("publicKey", publicKeyFilename).Msg("generating SSH keypair")
 
-	if err := vc.generateKeyPair(privateKeyFilename, publicKeyFilename); err != nil {
+	if err := client.generateKeyPair(privateKeyFilename, publicKeyFilename, *owner); err != nil {
 		return fmt.Errorf("failed to generate SSH keys: %w", err)
 	}
-	if err := vc.signKey(log, ssh.OutputPath, ssh.VaultMount, ssh.VaultRole); err != nil {
+	if err := client.signKey(log, ssh.OutputPath, ssh.VaultMount, ssh.VaultRole, *owner); err != nil {
 		return fmt.Errorf("failed to sign SSH key: %w", err)
 	}
 
 	return nil
 }
 
-func (vc *wrappedVaultClient) generateKeyPair(privateKeyFilename, publicKeyFilename string) error {
+func (vc *wrappedVaultClient) generateKeyPair(privateKeyFilename, publicKeyFilename string, owner util.FileOwner) error {
 
 	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
 	if err != nil {
@@ -56,15 +58,9 @@ func (vc *wrappedVaultClient) generateKeyPair(privateKeyFilename, publicKeyFilen
 	}
 
 	// Write a SSH private key..
-	privateKeyFile, err := os.OpenFile(privateKeyFilename, syscall.O_RDWR|syscall.O_CREAT|syscall.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("could not create private key file %q: %w", privateKeyFilename, err)
-	}
-	defer privateKeyFile.Close()
-
 	privateKeyPEM := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
-	if err := pem.Encode(privateKeyFile, privateKeyPEM); err != nil {
-		return fmt.Errorf("could not PEM encode private key %q: %w", privateKeyFilename, err)
+	if err := util.WriteFileAtomic(privateKeyFilename, pem.EncodeToMemory(privateKeyPEM), 0600, owner); err != nil {
+		return fmt.Errorf("could not write private key file %q: %w", privateKeyFilename, err)
 	}
 
 	// Write SSH public key..
@@ -73,7 +69,7 @@ func (vc *wrappedVaultClient) generateKeyPair(privateKeyFilename, publicKeyFilen
 		return fmt.Errorf("could not create public SSH key %q: %w", publicKeyFilename, err)
 	}
 
-	err = ioutil.WriteFile(publicKeyFilename, ssh.MarshalAuthorizedKey(pub), 0600)
+	err = util.WriteFileAtomic(publicKeyFilename, ssh.MarshalAuthorizedKey(pub), 0600, owner)
 	if err != nil {
 		return fmt.Errorf("could not write public SSH key %q: %w", publicKeyFilename, err)
 	}
@@ -81,12 +77,12 @@ func (vc *wrappedVaultClient) generateKeyPair(privateKeyFilename, publicKeyFilen
 	return nil
 }
 
-func (vc *wrappedVaultClient) signKey(log zerolog.Logger, outputPath string, vaultMount string, vaultRole string) error {
+func (vc *wrappedVaultClient) signKey(log zerolog.Logger, outputPath string, vaultMount string, vaultRole string, owner util.FileOwner) error {
 	log.Debug().Str("outputPath", outputPath).Str("vaultMount", vaultMount).Msg("signing SSH keys")
 
 	vaultSSH := vc.Delegate().SSHWithMountPoint(vaultMount)
 
-	publicKeyFilename := filepath.Join(outputPath, SSHPublicKey)
+	publicKeyFilename := filepath.Join(outputPath, util.SSHPublicKey)
 	certificateFilename := filepath.Join(outputPath, util.SSHCertificate)
 
 	publicKeyBytes, err := ioutil.ReadFile(publicKeyFilename)
@@ -113,7 +109,7 @@ func (vc *wrappedVaultClient) signKey(log zerolog.Logger, outputPath string, vau
 
 	log.Info().Str("certificateFile", certificateFilename).Msg("writing SSH certificate")
 
-	if err := ioutil.WriteFile(certificateFilename, []byte(signedKeyString), 0600); err != nil {
+	if err := util.WriteFileAtomic(certificateFilename, []byte(signedKeyString), 0600, owner); err != nil {
 		return fmt.Errorf("could not write certificate file: %w", err)
 	}
 
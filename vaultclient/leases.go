@@ -0,0 +1,20 @@
+package vaultclient
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// RenewLease extends the lease of a dynamic secret. An increment of zero asks for the default TTL. Vault never
+// extends a lease past its max TTL, so callers must check the returned lease duration.
+func (vc *wrappedVaultClient) RenewLease(leaseID string, increment time.Duration) (*api.Secret, error) {
+	vc.log.Debug().Str("leaseID", leaseID).Str("increment", increment.String()).Msg("renewing lease")
+	return vc.delegate.Sys().Renew(leaseID, int(increment.Seconds()))
+}
+
+// RevokeLease revokes the lease of a dynamic secret, invalidating the secret.
+func (vc *wrappedVaultClient) RevokeLease(leaseID string) error {
+	vc.log.Debug().Str("leaseID", leaseID).Msg("revoking lease")
+	return vc.delegate.Sys().Revoke(leaseID)
+}
@@ -52,6 +52,20 @@ func (mr *MockVaultClientMockRecorder) Address() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Address", reflect.TypeOf((*MockVaultClient)(nil).Address))
 }
 
+// CreatePKICertificate mocks base method.
+func (m *MockVaultClient) CreatePKICertificate(pkiConfig config.PKICertificateType) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePKICertificate", pkiConfig)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePKICertificate indicates an expected call of CreatePKICertificate.
+func (mr *MockVaultClientMockRecorder) CreatePKICertificate(pkiConfig interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePKICertificate", reflect.TypeOf((*MockVaultClient)(nil).CreatePKICertificate), pkiConfig)
+}
+
 // CreateSSHCertificate mocks base method.
 func (m *MockVaultClient) CreateSSHCertificate(sshConfig config.SSHCertificateType) error {
 	m.ctrl.T.Helper()
@@ -96,6 +110,50 @@ func (mr *MockVaultClientMockRecorder) FetchAWSSTSCredential(awsConfig, stsTTL i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchAWSSTSCredential", reflect.TypeOf((*MockVaultClient)(nil).FetchAWSSTSCredential), awsConfig, stsTTL)
 }
 
+// FetchDatabaseCredential mocks base method.
+func (m *MockVaultClient) FetchDatabaseCredential(dbConfig config.DatabaseType) (*api.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchDatabaseCredential", dbConfig)
+	ret0, _ := ret[0].(*api.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchDatabaseCredential indicates an expected call of FetchDatabaseCredential.
+func (mr *MockVaultClientMockRecorder) FetchDatabaseCredential(dbConfig interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchDatabaseCredential", reflect.TypeOf((*MockVaultClient)(nil).FetchDatabaseCredential), dbConfig)
+}
+
+// FetchDynamicSecret mocks base method.
+func (m *MockVaultClient) FetchDynamicSecret(dynConfig config.DynamicType) (*api.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchDynamicSecret", dynConfig)
+	ret0, _ := ret[0].(*api.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchDynamicSecret indicates an expected call of FetchDynamicSecret.
+func (mr *MockVaultClientMockRecorder) FetchDynamicSecret(dynConfig interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchDynamicSecret", reflect.TypeOf((*MockVaultClient)(nil).FetchDynamicSecret), dynConfig)
+}
+
+// Namespace mocks base method.
+func (m *MockVaultClient) Namespace() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Namespace")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Namespace indicates an expected call of Namespace.
+func (mr *MockVaultClientMockRecorder) Namespace() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Namespace", reflect.TypeOf((*MockVaultClient)(nil).Namespace))
+}
+
 // Read mocks base method.
 func (m *MockVaultClient) Read(arg0 string) (*api.Secret, error) {
 	m.ctrl.T.Helper()
@@ -141,6 +199,35 @@ func (mr *MockVaultClientMockRecorder) RefreshVaultToken() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshVaultToken", reflect.TypeOf((*MockVaultClient)(nil).RefreshVaultToken))
 }
 
+// RenewLease mocks base method.
+func (m *MockVaultClient) RenewLease(leaseID string, increment time.Duration) (*api.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewLease", leaseID, increment)
+	ret0, _ := ret[0].(*api.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewLease indicates an expected call of RenewLease.
+func (mr *MockVaultClientMockRecorder) RenewLease(leaseID, increment interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewLease", reflect.TypeOf((*MockVaultClient)(nil).RenewLease), leaseID, increment)
+}
+
+// RevokeLease mocks base method.
+func (m *MockVaultClient) RevokeLease(leaseID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeLease", leaseID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeLease indicates an expected call of RevokeLease.
+func (mr *MockVaultClientMockRecorder) RevokeLease(leaseID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeLease", reflect.TypeOf((*MockVaultClient)(nil).RevokeLease), leaseID)
+}
+
 // ServiceSecretPrefix mocks base method.
 func (m *MockVaultClient) ServiceSecretPrefix(configVersion int) string {
 	m.ctrl.T.Helper()
@@ -167,6 +254,37 @@ func (mr *MockVaultClientMockRecorder) SetToken(token interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetToken", reflect.TypeOf((*MockVaultClient)(nil).SetToken), token)
 }
 
+// TransitDataKey mocks base method.
+func (m *MockVaultClient) TransitDataKey(mount, name string) ([]byte, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransitDataKey", mount, name)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// TransitDataKey indicates an expected call of TransitDataKey.
+func (mr *MockVaultClientMockRecorder) TransitDataKey(mount, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransitDataKey", reflect.TypeOf((*MockVaultClient)(nil).TransitDataKey), mount, name)
+}
+
+// TransitDecrypt mocks base method.
+func (m *MockVaultClient) TransitDecrypt(mount, name, ciphertext string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransitDecrypt", mount, name, ciphertext)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TransitDecrypt indicates an expected call of TransitDecrypt.
+func (mr *MockVaultClientMockRecorder) TransitDecrypt(mount, name, ciphertext interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransitDecrypt", reflect.TypeOf((*MockVaultClient)(nil).TransitDecrypt), mount, name, ciphertext)
+}
+
 // VerifyVaultToken mocks base method.
 func (m *MockVaultClient) VerifyVaultToken(vaultToken string) (*api.Secret, error) {
 	m.ctrl.T.Helper()
@@ -181,3 +299,18 @@ func (mr *MockVaultClientMockRecorder) VerifyVaultToken(vaultToken interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyVaultToken", reflect.TypeOf((*MockVaultClient)(nil).VerifyVaultToken), vaultToken)
 }
+
+// WithNamespace mocks base method.
+func (m *MockVaultClient) WithNamespace(namespace string) (vaultclient.VaultClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithNamespace", namespace)
+	ret0, _ := ret[0].(vaultclient.VaultClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WithNamespace indicates an expected call of WithNamespace.
+func (mr *MockVaultClientMockRecorder) WithNamespace(namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithNamespace", reflect.TypeOf((*MockVaultClient)(nil).WithNamespace), namespace)
+}
@@ -0,0 +1,66 @@
+package vaultclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// TransitDataKey asks the transit secrets engine at mount for a new data key, encrypted with the named transit key.
+// Both the data key and its encrypted form are returned, the data key is never stored by Vault.
+func (vc *wrappedVaultClient) TransitDataKey(mount, name string) ([]byte, string, error) {
+	path := fmt.Sprintf("%s/datakey/plaintext/%s", strings.Trim(mount, "/"), name)
+
+	log := vc.log.With().Str("path", path).Logger()
+	log.Debug().Msg("generating transit data key")
+
+	result, err := vc.Delegate().Logical().Write(path, map[string]interface{}{"bits": 256})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate transit data key")
+		return nil, "", fmt.Errorf("could not generate data key from %q: %w", path, err)
+	}
+
+	if result == nil || result.Data == nil {
+		return nil, "", fmt.Errorf("no data key returned from %q", path)
+	}
+
+	plaintext, _ := result.Data["plaintext"].(string)
+	ciphertext, _ := result.Data["ciphertext"].(string)
+	if plaintext == "" || ciphertext == "" {
+		return nil, "", fmt.Errorf("incomplete data key returned from %q", path)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not decode data key returned from %q: %w", path, err)
+	}
+
+	return key, ciphertext, nil
+}
+
+// TransitDecrypt decrypts ciphertext made by the named transit key at mount, such as a data key from
+// TransitDataKey.
+func (vc *wrappedVaultClient) TransitDecrypt(mount, name string, ciphertext string) ([]byte, error) {
+	path := fmt.Sprintf("%s/decrypt/%s", strings.Trim(mount, "/"), name)
+
+	log := vc.log.With().Str("path", path).Logger()
+	log.Debug().Msg("decrypting with transit key")
+
+	result, err := vc.Delegate().Logical().Write(path, map[string]interface{}{"ciphertext": ciphertext})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to decrypt with transit key")
+		return nil, fmt.Errorf("could not decrypt with %q: %w", path, err)
+	}
+
+	if result == nil || result.Data == nil {
+		return nil, fmt.Errorf("nothing returned from %q", path)
+	}
+
+	plaintext, _ := result.Data["plaintext"].(string)
+	decrypted, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode plaintext returned from %q: %w", path, err)
+	}
+
+	return decrypted, nil
+}
@@ -2,6 +2,7 @@ package vaultclient
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/api"
@@ -14,11 +15,21 @@ import (
 const SecretsServicePathV1 = "/secret/application-config/services/"
 const SecretsServicePathV2 = "/kv/data/application-config/services/"
 
+// namespaceHeader is the header Vault Enterprise uses to select the namespace of a request.
+const namespaceHeader = "X-Vault-Namespace"
+
 type VaultClient interface {
 	VerifyVaultToken(vaultToken string) (*api.Secret, error)
 	Delegate() *api.Client
 	FetchAWSSTSCredential(awsConfig config.AWSType, stsTTL time.Duration) (*AWSSTSCredential, *util.WrappedToken, error)
 	CreateSSHCertificate(sshConfig config.SSHCertificateType) error
+	CreatePKICertificate(pkiConfig config.PKICertificateType) error
+	FetchDatabaseCredential(dbConfig config.DatabaseType) (*api.Secret, error)
+	FetchDynamicSecret(dynConfig config.DynamicType) (*api.Secret, error)
+	RenewLease(leaseID string, increment time.Duration) (*api.Secret, error)
+	RevokeLease(leaseID string) error
+	TransitDataKey(mount, name string) ([]byte, string, error)
+	TransitDecrypt(mount, name string, ciphertext string) ([]byte, error)
 	RefreshVaultToken() (*api.Secret, error)
 	ServiceSecretPrefix(configVersion int) string
 
@@ -26,6 +37,9 @@ type VaultClient interface {
 	ReadWithData(string, map[string][]string) (*api.Secret, error)
 	Read(string) (*api.Secret, error)
 	SetToken(token string)
+
+	Namespace() string
+	WithNamespace(namespace string) (VaultClient, error)
 }
 
 type wrappedVaultClient struct {
@@ -34,8 +48,9 @@ type wrappedVaultClient struct {
 	log           zerolog.Logger
 }
 
-// NewVaultClient constructs a new VaultClient implementation.
-func NewVaultClient(secretsPrefix string, clientTimeout time.Duration, clientRetries int) (VaultClient, error) {
+// NewVaultClient constructs a new VaultClient implementation. If namespace is not empty, all requests (including
+// authentication) are made in that Vault Enterprise namespace, otherwise VAULT_NAMESPACE is honoured.
+func NewVaultClient(secretsPrefix string, namespace string, clientTimeout time.Duration, clientRetries int) (VaultClient, error) {
 	conf := api.DefaultConfig()
 	// Requests are twice with a jitter backoff.
 	conf.MaxRetries = clientRetries
@@ -45,6 +60,7 @@ func NewVaultClient(secretsPrefix string, clientTimeout time.Duration, clientRet
 		Int("vaultClientMaxRetries", clientRetries).
 		Int("vaultClientTimeoutSeconds", int(clientTimeout.Seconds())).
 		Str("secretsPrefix", secretsPrefix).
+		Str("namespace", namespace).
 		Msg("creating Vault client")
 
 	client, err := api.NewClient(conf)
@@ -52,13 +68,62 @@ func NewVaultClient(secretsPrefix string, clientTimeout time.Duration, clientRet
 		return nil, fmt.Errorf("could not create Vault client: %w", err)
 	}
 
+	if namespace != "" {
+		client.SetNamespace(strings.Trim(namespace, "/"))
+	}
+
+	return newWrappedVaultClient(client, secretsPrefix), nil
+}
+
+// NewConnectionVaultClient constructs a VaultClient for one of the additional Vault servers listed in the
+// "connections" section of the configuration file. VAULT_TOKEN and VAULT_NAMESPACE belong to the default Vault
+// server, so they are not used here.
+func NewConnectionVaultClient(conn config.VaultConnectionType, secretsPrefix string, clientTimeout time.Duration, clientRetries int) (VaultClient, error) {
+	conf := api.DefaultConfig()
+	conf.MaxRetries = clientRetries
+	conf.Timeout = clientTimeout
+	conf.Address = conn.Address
+
+	if conn.CACert != "" {
+		if err := conf.ConfigureTLS(&api.TLSConfig{CACert: conn.CACert}); err != nil {
+			return nil, fmt.Errorf("could not configure TLS for Vault connection %q: %w", conn.Name, err)
+		}
+	}
+
+	zlog.Debug().
+		Str("connection", conn.Name).
+		Str("address", conn.Address).
+		Str("secretsPrefix", secretsPrefix).
+		Str("namespace", conn.Namespace).
+		Msg("creating Vault client for connection")
+
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Vault client for connection %q: %w", conn.Name, err)
+	}
+
+	client.ClearToken()
+	headers := client.Headers()
+	headers.Del(namespaceHeader)
+	client.SetHeaders(headers)
+	if conn.Namespace != "" {
+		client.SetNamespace(conn.Namespace)
+	}
+
+	return newWrappedVaultClient(client, secretsPrefix), nil
+}
+
+func newWrappedVaultClient(client *api.Client, secretsPrefix string) *wrappedVaultClient {
 	log := zlog.With().Str("vaultAddr", client.Address()).Logger()
+	if ns := client.Headers().Get(namespaceHeader); ns != "" {
+		log = log.With().Str("vaultNamespace", ns).Logger()
+	}
 
 	return &wrappedVaultClient{
 		secretsPrefix: secretsPrefix,
 		delegate:      client,
 		log:           log,
-	}, nil
+	}
 }
 
 func (vc *wrappedVaultClient) Delegate() *api.Client {
@@ -72,6 +137,45 @@ func (vc *wrappedVaultClient) Address() string {
 func (vc *wrappedVaultClient) SetToken(token string) {
 	vc.delegate.SetToken(token)
 }
+
+// Namespace returns the Vault Enterprise namespace requests are made in, or an empty string for the root namespace.
+func (vc *wrappedVaultClient) Namespace() string {
+	return vc.delegate.Headers().Get(namespaceHeader)
+}
+
+// WithNamespace returns a client that makes requests in a child namespace of this client's namespace, using the
+// same token. If the namespace is empty, the client itself is returned.
+func (vc *wrappedVaultClient) WithNamespace(namespace string) (VaultClient, error) {
+	return vc.namespaced(namespace)
+}
+
+func (vc *wrappedVaultClient) namespaced(namespace string) (*wrappedVaultClient, error) {
+	namespace = strings.Trim(namespace, "/")
+	if namespace == "" {
+		return vc, nil
+	}
+
+	fullNamespace := namespace
+	if parent := strings.Trim(vc.Namespace(), "/"); parent != "" {
+		fullNamespace = parent + "/" + namespace
+	}
+
+	client, err := vc.delegate.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("could not create Vault client for namespace %q: %w", fullNamespace, err)
+	}
+
+	// Clone only copies headers in some configurations, and picks up VAULT_TOKEN rather than the current token.
+	client.SetHeaders(vc.delegate.Headers())
+	client.SetNamespace(fullNamespace)
+	client.SetToken(vc.delegate.Token())
+
+	return &wrappedVaultClient{
+		delegate:      client,
+		secretsPrefix: vc.secretsPrefix,
+		log:           vc.log.With().Str("vaultNamespace", fullNamespace).Logger(),
+	}, nil
+}
 func (vc *wrappedVaultClient) ReadWithData(path string, data map[string][]string) (*api.Secret, error) {
 	return vc.delegate.Logical().ReadWithData(path, data)
 }
@@ -38,6 +38,9 @@ type vaultTokenManager struct {
 	briefcase            *briefcase.Briefcase
 	vaultTokenCliArg     string
 	tokenRenewableCliArg bool
+
+	// connection is the name of the Vault connection whose briefcase token is checked; "" is the default server.
+	connection string
 }
 
 // NewVaultToken constructs an implementation of VaultToken which uses provided parameters.
@@ -53,6 +56,20 @@ func NewVaultToken(briefcase *briefcase.Briefcase, vaultClient vaultclient.Vault
 	}
 }
 
+// NewConnectionVaultToken constructs an implementation of VaultToken for one of the additional Vault connections
+// in the configuration file. Only the token for that connection in the briefcase is considered, as the command line
+// and VAULT_TOKEN hold tokens for the default Vault server.
+func NewConnectionVaultToken(briefcase *briefcase.Briefcase, vaultClient vaultclient.VaultClient, connection string) VaultToken {
+	log := zlog.With().Str("vaultAddr", vaultClient.Address()).Str("connection", connection).Logger()
+
+	return &vaultTokenManager{
+		log:         log,
+		briefcase:   briefcase,
+		vaultClient: vaultClient,
+		connection:  connection,
+	}
+}
+
 // Secret returns the underlying token secret.
 func (vt *vaultTokenManager) Secret() *api.Secret {
 	return vt.validToken.Secret
@@ -114,21 +131,27 @@ func (vt *vaultTokenManager) CheckAndRefresh() error {
 // and checks with the vault server if the token is still good, optionally refreshing it. If there isn't a vault
 // token around, it returns ErrNoValidVaultTokenAvailable.
 func (vt *vaultTokenManager) determineVaultToken() (*util.WrappedToken, error) {
-	if vt.briefcase != nil && vt.briefcase.AuthTokenLease.Token != "" {
+	if vt.briefcase != nil && vt.briefcase.AuthToken(vt.connection).Token != "" {
+		lease := vt.briefcase.AuthToken(vt.connection)
 		log := vt.log.With().Str("source", "briefcase").Logger()
 
-		log.Info().Str("accessor", vt.briefcase.AuthTokenLease.Accessor).Msg("testing if token is usable")
+		log.Info().Str("accessor", lease.Accessor).Msg("testing if token is usable")
 
-		secret, err := vt.tryToken(log, vt.briefcase.AuthTokenLease.Token)
+		secret, err := vt.tryToken(log, lease.Token)
 		if err != nil {
-			log.Warn().Str("accessor", vt.briefcase.AuthTokenLease.Accessor).Err(err).Msg("current briefcase token is not usable")
+			log.Warn().Str("accessor", lease.Accessor).Err(err).Msg("current briefcase token is not usable")
 		} else {
 			accessor, _ := secret.TokenAccessor()
 			log.Debug().Str("accessor", accessor).Msg("current briefcase token is usable")
-			return util.NewWrappedToken(secret, vt.briefcase.AuthTokenLease.Renewable), nil
+			return util.NewWrappedToken(secret, lease.Renewable), nil
 		}
 	}
 
+	if vt.connection != "" {
+		vt.log.Debug().Msg("no current vault token available for connection")
+		return nil, ErrNoValidVaultTokenAvailable
+	}
+
 	if vt.vaultTokenCliArg != "" {
 		log := zlog.With().Str("source", "cli-arg").Logger()
 		log.Info().Msg("testing if --vault-token is usable")